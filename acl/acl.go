@@ -0,0 +1,205 @@
+package acl
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+type Right uint8
+
+const (
+	RightProduce Right = 1 << iota
+	RightConsume
+	RightAdmin
+)
+
+var rightNames = map[string]Right{
+	"produce": RightProduce,
+	"consume": RightConsume,
+	"admin":   RightAdmin,
+}
+
+func (r Right) String() string {
+	names := make([]string, 0)
+	for _, name := range []string{"produce", "consume", "admin"} {
+		if r&rightNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Rule grants rights on the topics and lines matching the patterns. The
+// patterns are in the syntax of path.Match, and an empty line pattern
+// matches all lines of the topics.
+type Rule struct {
+	Topic  string   `json:"topic"`
+	Line   string   `json:"line,omitempty"`
+	Rights []string `json:"rights"`
+	rights Right
+}
+
+// User is a client identified by its token. A user with an empty token is
+// the anonymous user, whose rules apply to the unauthenticated clients.
+type User struct {
+	Name  string  `json:"name"`
+	Token string  `json:"token"`
+	Rules []*Rule `json:"rules"`
+}
+
+type ACL struct {
+	users     []*User
+	anonymous *User
+}
+
+// Load reads an ACL file like:
+//
+//	{"users": [{"name": "alice", "token": "secret",
+//		"rules": [{"topic": "foo", "line": "x", "rights": ["consume"]}]}]}
+func Load(file string) (*ACL, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf struct {
+		Users []*User `json:"users"`
+	}
+	err = json.Unmarshal(data, &conf)
+	if err != nil {
+		return nil, err
+	}
+	return New(conf.Users)
+}
+
+func New(users []*User) (*ACL, error) {
+	a := new(ACL)
+	for _, u := range users {
+		for _, rule := range u.Rules {
+			if _, err := path.Match(rule.Topic, ""); err != nil {
+				return nil, NewError(
+					ErrBadRequest,
+					`bad topic pattern of `+u.Name+`: `+rule.Topic,
+				)
+			}
+			if _, err := path.Match(rule.Line, ""); err != nil {
+				return nil, NewError(
+					ErrBadRequest,
+					`bad line pattern of `+u.Name+`: `+rule.Line,
+				)
+			}
+			rule.rights = 0
+			for _, name := range rule.Rights {
+				right, ok := rightNames[name]
+				if !ok {
+					return nil, NewError(
+						ErrBadRequest,
+						`unknown right of `+u.Name+`: `+name,
+					)
+				}
+				rule.rights |= right
+			}
+		}
+		if u.Token == "" {
+			a.anonymous = u
+			continue
+		}
+		a.users = append(a.users, u)
+	}
+	return a, nil
+}
+
+// Authenticate returns the user of the token. The name is checked too if
+// it is not empty.
+func (a *ACL) Authenticate(name, token string) (*User, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	var found *User
+	for _, u := range a.users {
+		if subtle.ConstantTimeCompare([]byte(u.Token), []byte(token)) == 1 {
+			found = u
+		}
+	}
+	if found == nil || (name != "" && name != found.Name) {
+		return nil, NewError(
+			ErrUnauthorized,
+			`bad name or token`,
+		)
+	}
+	return found, nil
+}
+
+func splitKey(key string) (topic, line string) {
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	topic = parts[0]
+	if len(parts) > 1 {
+		line = parts[1]
+	}
+	return
+}
+
+func (rule *Rule) match(topic, line string) bool {
+	if ok, _ := path.Match(rule.Topic, topic); !ok {
+		return false
+	}
+	if rule.Line == "" || rule.Line == "*" {
+		return true
+	}
+	if line == "" {
+		// a rule of some lines does not cover the whole topic
+		return false
+	}
+	ok, _ := path.Match(rule.Line, line)
+	return ok
+}
+
+// Authorize checks if the user has the right on the key, which may be a
+// topic, a line or a message id. A nil user is the anonymous user, and
+// the admin right implies the others. A nil ACL authorizes everything.
+func (a *ACL) Authorize(u *User, right Right, key string) error {
+	if a == nil {
+		return nil
+	}
+	if u == nil {
+		u = a.anonymous
+	}
+	if u == nil {
+		return NewError(
+			ErrUnauthorized,
+			`authentication required`,
+		)
+	}
+
+	topic, line := splitKey(key)
+	for _, rule := range u.Rules {
+		if rule.rights&(right|RightAdmin) == 0 {
+			continue
+		}
+		if rule.match(topic, line) {
+			return nil
+		}
+	}
+	return NewError(
+		ErrForbidden,
+		u.Name+` has no `+right.String()+` right on `+key,
+	)
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+func FromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(contextKey{}).(*User)
+	return u
+}
@@ -0,0 +1,94 @@
+package acl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/buaazp/uq/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const aclConf = `{"users": [
+	{"name": "alice", "token": "a1", "rules": [
+		{"topic": "foo", "rights": ["produce"]},
+		{"topic": "foo", "line": "x*", "rights": ["consume"]}
+	]},
+	{"name": "root", "token": "r1", "rules": [
+		{"topic": "*", "rights": ["admin"]}
+	]},
+	{"name": "anonymous", "token": "", "rules": [
+		{"topic": "pub", "rights": ["consume"]}
+	]}
+]}`
+
+func errorCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.ErrorCode
+	}
+	return 0
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Test Load ACL", t, func() {
+		dir, err := ioutil.TempDir("", "uq-acl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := path.Join(dir, "acl.json")
+		err = ioutil.WriteFile(file, []byte(aclConf), 0644)
+		So(err, ShouldBeNil)
+		a, err := Load(file)
+		So(err, ShouldBeNil)
+		So(a, ShouldNotBeNil)
+
+		_, err = New([]*User{{Name: "bad", Token: "b", Rules: []*Rule{{Topic: "foo", Rights: []string{"write"}}}}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	Convey("Test Authenticate And Authorize", t, func() {
+		dir, err := ioutil.TempDir("", "uq-acl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := path.Join(dir, "acl.json")
+		ioutil.WriteFile(file, []byte(aclConf), 0644)
+		a, err := Load(file)
+		So(err, ShouldBeNil)
+
+		_, err = a.Authenticate("", "bad")
+		So(errorCode(err), ShouldEqual, ErrUnauthorized)
+		_, err = a.Authenticate("root", "a1")
+		So(errorCode(err), ShouldEqual, ErrUnauthorized)
+		alice, err := a.Authenticate("alice", "a1")
+		So(err, ShouldBeNil)
+		root, err := a.Authenticate("", "r1")
+		So(err, ShouldBeNil)
+
+		So(a.Authorize(alice, RightProduce, "foo"), ShouldBeNil)
+		So(a.Authorize(alice, RightConsume, "foo/x1"), ShouldBeNil)
+		So(a.Authorize(alice, RightConsume, "foo/x1/0"), ShouldBeNil)
+		So(errorCode(a.Authorize(alice, RightConsume, "foo/y")), ShouldEqual, ErrForbidden)
+		So(errorCode(a.Authorize(alice, RightConsume, "foo")), ShouldEqual, ErrForbidden)
+		So(errorCode(a.Authorize(alice, RightAdmin, "foo")), ShouldEqual, ErrForbidden)
+		So(a.Authorize(root, RightConsume, "bar/y"), ShouldBeNil)
+
+		So(a.Authorize(nil, RightConsume, "pub/x"), ShouldBeNil)
+		So(errorCode(a.Authorize(nil, RightProduce, "pub")), ShouldEqual, ErrForbidden)
+
+		var none *ACL
+		So(none.Authorize(nil, RightAdmin, "foo"), ShouldBeNil)
+
+		req, _ := http.NewRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer a1")
+		u, err := a.AuthenticateRequest(req)
+		So(err, ShouldBeNil)
+		So(u, ShouldEqual, alice)
+		req.Header.Set("Authorization", "Basic a1")
+		_, err = a.AuthenticateRequest(req)
+		So(errorCode(err), ShouldEqual, ErrUnauthorized)
+	})
+}
@@ -0,0 +1,36 @@
+package acl
+
+import (
+	"net/http"
+	"strings"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+// AuthenticateRequest authenticates the bearer token of a http request. A
+// request without token is served as the anonymous user.
+func (a *ACL) AuthenticateRequest(req *http.Request) (*User, error) {
+	auth := req.Header.Get("Authorization")
+	if a == nil || auth == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, NewError(
+			ErrUnauthorized,
+			`bearer token required`,
+		)
+	}
+	return a.Authenticate("", strings.TrimSpace(auth[len("Bearer "):]))
+}
+
+// MethodRight returns the right needed by a request of the queue api:
+// PUT creates, POST pushes, GET pops and DELETE confirms.
+func MethodRight(method string) Right {
+	switch method {
+	case "PUT":
+		return RightAdmin
+	case "POST":
+		return RightProduce
+	}
+	return RightConsume
+}
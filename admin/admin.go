@@ -1,6 +1,35 @@
 package admin
 
+import (
+	"io"
+
+	"github.com/buaazp/uq/queue"
+)
+
 type AdminServer interface {
 	ListenAndServe() error
 	Stop()
 }
+
+// Replica takes over the topics replicated from other nodes.
+type Replica interface {
+	Takeover(leader, topic string) error
+}
+
+// Backup writes a snapshot of the queue as an archive.
+type Backup interface {
+	Backup(w io.Writer) error
+}
+
+// Exporter exports the topics to a portable format and imports them.
+type Exporter interface {
+	Export(topic string, w io.Writer) error
+	Import(topic string, r io.Reader) ([]queue.IDRange, error)
+}
+
+// Migrator drains this node and migrates its topics to other nodes.
+type Migrator interface {
+	Drain(draining bool)
+	Draining() bool
+	Migrate(topic, addr string) ([]queue.IDRange, error)
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+)
+
+const ClusterStatTimeout time.Duration = 5 * time.Second
+
+// ClusterStat is the stat of a topic or line on every node of the
+// cluster, with the counts summed up in Total.
+type ClusterStat struct {
+	Name   string                      `json:"name"`
+	Total  *queue.QueueStat            `json:"total"`
+	Nodes  map[string]*queue.QueueStat `json:"nodes"`
+	Errors map[string]string           `json:"errors,omitempty"`
+}
+
+// SetCluster enables the cluster stat, which fans out to the admin
+// servers listed by the function.
+func (h *HttpEntry) SetCluster(admins func() ([]string, error)) {
+	h.admins = admins
+}
+
+// nodeStat gets the local stat of the key from the admin server addr.
+func (h *HttpEntry) nodeStat(req *http.Request, addr, key string) (*queue.QueueStat, error) {
+	scheme := "http"
+	if h.tlsConfig != nil {
+		scheme = "https"
+	}
+	nodeReq, err := http.NewRequest("GET", scheme+"://"+addr+adminPrefixV1+"/stat"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		nodeReq.Header.Set("Authorization", auth)
+	}
+	resp, err := h.clusterClient.Do(nodeReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := new(Error)
+		if json.Unmarshal(data, e) != nil || e.ErrorCode == 0 {
+			return nil, NewError(
+				ErrInternalError,
+				strings.TrimSpace(string(data)),
+			)
+		}
+		return nil, e
+	}
+	qs := new(queue.QueueStat)
+	err = json.Unmarshal(data, qs)
+	if err != nil {
+		return nil, err
+	}
+	return qs, nil
+}
+
+func (h *HttpEntry) clusterStat(req *http.Request, key string) (*ClusterStat, error) {
+	admins, err := h.admins()
+	if err != nil {
+		return nil, NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+
+	cs := new(ClusterStat)
+	cs.Name = strings.Trim(key, "/")
+	cs.Nodes = make(map[string]*queue.QueueStat)
+	cs.Errors = make(map[string]string)
+	errs := make([]error, len(admins))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, addr := range admins {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			qs, err := h.nodeStat(req, addr, key)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[i] = err
+				cs.Errors[addr] = err.Error()
+				return
+			}
+			cs.Nodes[addr] = qs
+		}(i, addr)
+	}
+	wg.Wait()
+
+	// sum up in the order of the nodes
+	sort.Strings(admins)
+	for _, addr := range admins {
+		if qs, ok := cs.Nodes[addr]; ok {
+			cs.Total = sumStat(cs.Total, qs)
+		}
+	}
+	if cs.Total == nil {
+		// no node has the key, or none is alive
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, NewError(
+			ErrInternalError,
+			`no node in the cluster`,
+		)
+	}
+	return cs, nil
+}
+
+// sumStat adds the counts of qs to total. The lines are matched by name.
+func sumStat(total, qs *queue.QueueStat) *queue.QueueStat {
+	if total == nil {
+		total = &queue.QueueStat{
+			Name:    qs.Name,
+			Type:    qs.Type,
+			Recycle: qs.Recycle,
+		}
+	}
+	total.Head += qs.Head
+	total.IHead += qs.IHead
+	total.Tail += qs.Tail
+	total.Count += qs.Count
+	total.Throttled += qs.Throttled
+	total.Bytes += qs.Bytes
+	for _, line := range qs.Lines {
+		var sum *queue.QueueStat
+		for _, l := range total.Lines {
+			if l.Name == line.Name {
+				sum = l
+				break
+			}
+		}
+		if sum == nil {
+			total.Lines = append(total.Lines, sumStat(nil, line))
+			continue
+		}
+		sumStat(sum, line)
+	}
+	return total
+}
+
+// clusterStatHandler serves 'GET /v1/admin/stat/<key>?cluster=1'.
+func (h *HttpEntry) clusterStatHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if h.admins == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`cluster not enabled`,
+		))
+		return
+	}
+
+	cs, err := h.clusterStat(req, key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+	data, err := json.Marshal(cs)
+	if err != nil {
+		writeErrorHttp(w, NewError(
+			ErrInternalError,
+			err.Error(),
+		))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+)
+
+// ImportResult is the result of importing a topic. IDs map the exported
+// message ids to the ones appended, and are empty if the ids are kept.
+type ImportResult struct {
+	Topic string          `json:"topic"`
+	IDs   []queue.IDRange `json:"ids,omitempty"`
+}
+
+// SetExporter enables exporting and importing the topics.
+func (h *HttpEntry) SetExporter(e Exporter) {
+	h.exporter = e
+}
+
+func exportTopic(key string) (string, error) {
+	topic := strings.Trim(key, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return "", NewError(
+			ErrBadRequest,
+			`export needs a topic`,
+		)
+	}
+	return topic, nil
+}
+
+// exportHandler serves 'GET /v1/admin/export/<topic>', which streams the
+// topic as NDJSON.
+func (h *HttpEntry) exportHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method != "GET" {
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.exporter == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`export not enabled`,
+		))
+		return
+	}
+	topic, err := exportTopic(key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+topic+`.ndjson"`)
+	err = h.exporter.Export(topic, w)
+	if e, ok := err.(*Error); ok {
+		// failed before streaming
+		writeErrorHttp(w, e)
+	} else if err != nil {
+		log.Printf("export error: %s", err)
+	}
+}
+
+// importHandler serves 'POST /v1/admin/import/<topic>' with the NDJSON
+// made by export in the body.
+func (h *HttpEntry) importHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.exporter == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`export not enabled`,
+		))
+		return
+	}
+	topic, err := exportTopic(key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+
+	ids, err := h.exporter.Import(topic, req.Body)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+	writeJson(w, &ImportResult{Topic: topic, IDs: ids})
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+)
+
+// MigrateResult is the result of migrating a topic. IDs map the message
+// ids to the ones on the target, and are empty if the ids are preserved.
+type MigrateResult struct {
+	Topic string          `json:"topic"`
+	To    string          `json:"to"`
+	IDs   []queue.IDRange `json:"ids,omitempty"`
+}
+
+// SetMigrator enables draining this node and migrating its topics.
+func (h *HttpEntry) SetMigrator(m Migrator) {
+	h.migrator = m
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeErrorHttp(w, NewError(
+			ErrInternalError,
+			err.Error(),
+		))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// drainHandler serves 'POST /v1/admin/drain' to refuse the pushes,
+// 'DELETE /v1/admin/drain' to accept them again, and 'GET' to check.
+func (h *HttpEntry) drainHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if h.migrator == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`migration not enabled`,
+		))
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		writeJson(w, map[string]bool{"draining": h.migrator.Draining()})
+	case "POST":
+		h.migrator.Drain(true)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		h.migrator.Drain(false)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+	}
+}
+
+// migrateHandler serves 'POST /v1/admin/migrate/<topic>' with the replica
+// address of the target node in 'to'.
+func (h *HttpEntry) migrateHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.migrator == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`migration not enabled`,
+		))
+		return
+	}
+
+	to := req.FormValue("to")
+	topic := strings.Trim(key, "/")
+	if to == "" || topic == "" || strings.Contains(topic, "/") {
+		writeErrorHttp(w, NewError(
+			ErrBadRequest,
+			`migrate needs a topic and a target`,
+		))
+		return
+	}
+	ids, err := h.migrator.Migrate(topic, to)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+	writeJson(w, &MigrateResult{Topic: topic, To: to, IDs: ids})
+}
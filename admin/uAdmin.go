@@ -1,11 +1,13 @@
 package admin
 
 import (
+	"crypto/tls"
 	"log"
-	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/buaazp/uq/acl"
 	"github.com/buaazp/uq/queue"
 	. "github.com/buaazp/uq/utils"
 )
@@ -19,18 +21,34 @@ type HttpEntry struct {
 	host         string
 	port         int
 	adminMux     map[string]func(http.ResponseWriter, *http.Request, string)
+	access       *acl.ACL
 	server       *http.Server
+	tlsConfig    *tls.Config
+	unixPath     string
 	stopListener *StopListener
 	messageQueue queue.MessageQueue
+	replica      Replica
+	migrator     Migrator
+	backup       Backup
+	exporter     Exporter
+
+	admins        func() ([]string, error)
+	clusterClient *http.Client
 }
 
 func NewAdminServer(host string, port int, messageQueue queue.MessageQueue) (*HttpEntry, error) {
 	h := new(HttpEntry)
 
 	h.adminMux = map[string]func(http.ResponseWriter, *http.Request, string){
-		"/stat":  h.statHandler,
-		"/empty": h.emptyHandler,
-		"/rm":    h.rmHandler,
+		"/stat":     h.statHandler,
+		"/empty":    h.emptyHandler,
+		"/rm":       h.rmHandler,
+		"/takeover": h.takeoverHandler,
+		"/drain":    h.drainHandler,
+		"/migrate":  h.migrateHandler,
+		"/backup":   h.backupHandler,
+		"/export":   h.exportHandler,
+		"/import":   h.importHandler,
 	}
 
 	addr := Addrcat(host, port)
@@ -42,15 +60,53 @@ func NewAdminServer(host string, port int, messageQueue queue.MessageQueue) (*Ht
 	h.port = port
 	h.server = server
 	h.messageQueue = messageQueue
+	h.clusterClient = &http.Client{Timeout: ClusterStatTimeout}
 
 	return h, nil
 }
 
+// SetUnixSocket listens on the unix socket path too. With a zero port it
+// listens on the unix socket only.
+func (h *HttpEntry) SetUnixSocket(path string) {
+	h.unixPath = path
+}
+
+// SetTLSConfig serves the connections over TLS. The config may verify
+// the client certificates too.
+func (h *HttpEntry) SetTLSConfig(config *tls.Config) {
+	h.tlsConfig = config
+}
+
+// SetReplica enables taking over the topics replicated to this node.
+func (h *HttpEntry) SetReplica(r Replica) {
+	h.replica = r
+}
+
+// SetBackup enables the online backup of the queue.
+func (h *HttpEntry) SetBackup(b Backup) {
+	h.backup = b
+}
+
+// SetACL sets the access control of the admin server. Clients
+// authenticate with the bearer token in the Authorization header.
+func (h *HttpEntry) SetACL(access *acl.ACL) {
+	h.access = access
+}
+
 func (h *HttpEntry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if !AllowMethod(w, req.Method, "HEAD", "GET", "POST", "PUT", "DELETE") {
 		return
 	}
 
+	if h.access != nil {
+		u, err := h.access.AuthenticateRequest(req)
+		if err != nil {
+			writeErrorHttp(w, err)
+			return
+		}
+		req = req.WithContext(acl.NewContext(req.Context(), u))
+	}
+
 	if strings.HasPrefix(req.URL.Path, queuePrefixV1) {
 		key := req.URL.Path[len(queuePrefixV1):]
 		h.queueHandler(w, req, key)
@@ -65,7 +121,23 @@ func (h *HttpEntry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	return
 }
 
+func (h *HttpEntry) authorize(req *http.Request, right acl.Right, key string) error {
+	if h.access == nil {
+		return nil
+	}
+	return h.access.Authorize(acl.FromContext(req.Context()), right, key)
+}
+
 func (h *HttpEntry) queueHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method == "PUT" {
+		key = req.FormValue("topic") + "/" + req.FormValue("line")
+	}
+	err := h.authorize(req, acl.MethodRight(req.Method), key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+
 	switch req.Method {
 	case "PUT":
 		h.addHandler(w, req, key)
@@ -83,8 +155,18 @@ func (h *HttpEntry) queueHandler(w http.ResponseWriter, req *http.Request, key s
 
 func (h *HttpEntry) adminHandler(w http.ResponseWriter, req *http.Request, key string) {
 	for prefix, handler := range h.adminMux {
-		if strings.HasPrefix(key, prefix) {
+		// match on the segment boundary, so that /statx is not /stat
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
 			key = key[len(prefix):]
+			right := acl.RightAdmin
+			if prefix == "/stat" {
+				right = acl.RightConsume
+			}
+			err := h.authorize(req, right, key)
+			if err != nil {
+				writeErrorHttp(w, err)
+				return
+			}
 			handler(w, req, key)
 			return
 		}
@@ -178,6 +260,11 @@ func (h *HttpEntry) statHandler(w http.ResponseWriter, req *http.Request, key st
 		return
 	}
 
+	if req.FormValue("cluster") != "" {
+		h.clusterStatHandler(w, req, key)
+		return
+	}
+
 	qs, err := h.messageQueue.Stat(key)
 	if err != nil {
 		writeErrorHttp(w, err)
@@ -227,20 +314,77 @@ func (h *HttpEntry) rmHandler(w http.ResponseWriter, req *http.Request, key stri
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *HttpEntry) takeoverHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.replica == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`replication not enabled`,
+		))
+		return
+	}
+
+	leader := req.FormValue("leader")
+	topic := strings.Trim(key, "/")
+	if leader == "" || topic == "" {
+		writeErrorHttp(w, NewError(
+			ErrBadRequest,
+			`takeover needs a leader and a topic`,
+		))
+		return
+	}
+	err := h.replica.Takeover(leader, topic)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// backupHandler serves 'GET /v1/admin/backup', which streams a snapshot
+// of the queue as a tar.gz archive.
+func (h *HttpEntry) backupHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method != "GET" {
+		http.Error(w, "405 Method Not Allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.backup == nil {
+		writeErrorHttp(w, NewError(
+			ErrNotFound,
+			`backup not enabled`,
+		))
+		return
+	}
+
+	name := "uq-" + time.Now().Format("20060102150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	err := h.backup.Backup(w)
+	if e, ok := err.(*Error); ok {
+		// failed before streaming
+		writeErrorHttp(w, e)
+	} else if err != nil {
+		// the archive is cut short, as the status is sent
+		log.Printf("backup error: %s", err)
+	}
+}
+
 func (h *HttpEntry) ListenAndServe() error {
-	addr := Addrcat(h.host, h.port)
-	l, err := net.Listen("tcp", addr)
+	ls, err := ListenAll(h.host, h.port, h.unixPath)
 	if err != nil {
 		return err
 	}
 
-	stopListener, err := NewStopListener(l)
+	stopListener, err := NewTLSStopListener(h.tlsConfig, ls...)
 	if err != nil {
 		return err
 	}
 	h.stopListener = stopListener
 
-	log.Printf("admin server serving at %s...", addr)
+	log.Printf("admin server serving at %s...", h.stopListener)
 	return h.server.Serve(h.stopListener)
 }
 
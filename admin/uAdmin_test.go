@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/buaazp/uq/queue"
 	"github.com/buaazp/uq/store"
@@ -181,6 +183,180 @@ func TestAdminRemove(t *testing.T) {
 	})
 }
 
+func TestAdminClusterStat(t *testing.T) {
+	Convey("Test Admin Cluster Stat Api", t, func() {
+		resp, err := client.Get("http://127.0.0.1:8800/v1/admin/stat/cs?cluster=1")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		peerStorage, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		peerQueue, err := queue.NewUnitedQueue(peerStorage, "127.0.0.1", 8807, nil, "uq")
+		So(err, ShouldBeNil)
+		defer peerQueue.Close()
+		peer, err := NewAdminServer("127.0.0.1", 8807, peerQueue)
+		So(err, ShouldBeNil)
+		go peer.ListenAndServe()
+		defer peer.Stop()
+		time.Sleep(100 * time.Millisecond)
+
+		for i, q := range []queue.MessageQueue{messageQueue, peerQueue} {
+			So(q.Create("cs", ""), ShouldBeNil)
+			So(q.Create("cs/x", ""), ShouldBeNil)
+			for j := 0; j <= i; j++ {
+				So(q.Push("cs", []byte("1")), ShouldBeNil)
+			}
+		}
+		_, _, err = peerQueue.Pop("cs/x")
+		So(err, ShouldBeNil)
+
+		entrance.(*HttpEntry).SetCluster(func() ([]string, error) {
+			return []string{"127.0.0.1:8800", "127.0.0.1:8807", "127.0.0.1:8817"}, nil
+		})
+		defer entrance.(*HttpEntry).SetCluster(nil)
+
+		resp, err = client.Get("http://127.0.0.1:8800/v1/admin/stat/cs?cluster=1")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		data, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		var cs ClusterStat
+		err = json.Unmarshal(data, &cs)
+		So(err, ShouldBeNil)
+		So(cs.Name, ShouldEqual, "cs")
+		So(len(cs.Nodes), ShouldEqual, 2)
+		So(cs.Nodes["127.0.0.1:8807"].Tail, ShouldEqual, 2)
+		So(cs.Errors, ShouldContainKey, "127.0.0.1:8817")
+		So(cs.Total.Tail, ShouldEqual, 3)
+		So(len(cs.Total.Lines), ShouldEqual, 1)
+		So(cs.Total.Lines[0].Head, ShouldEqual, 1)
+		So(cs.Total.Lines[0].Count, ShouldEqual, 2)
+
+		resp, err = client.Get("http://127.0.0.1:8800/v1/admin/stat/none?cluster=1")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestAdminTakeover(t *testing.T) {
+	Convey("Test Admin Takeover Api", t, func() {
+		resp, err := client.PostForm(
+			"http://127.0.0.1:8800/v1/admin/takeover/foo",
+			url.Values{"leader": {"127.0.0.1:8808"}},
+		)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		entrance.(*HttpEntry).SetReplica(messageQueue.(Replica))
+		defer entrance.(*HttpEntry).SetReplica(nil)
+		resp, err = client.PostForm(
+			"http://127.0.0.1:8800/v1/admin/takeover/foo",
+			url.Values{"leader": {"127.0.0.1:8808"}},
+		)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestAdminDrain(t *testing.T) {
+	Convey("Test Admin Drain And Migrate Api", t, func() {
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:8800/v1/admin/drain", nil)
+		resp, err := client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		entrance.(*HttpEntry).SetMigrator(messageQueue.(Migrator))
+		defer entrance.(*HttpEntry).SetMigrator(nil)
+		resp, err = client.Post("http://127.0.0.1:8800/v1/admin/drain", "", nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		body, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldEqual, `{"draining":true}`)
+
+		resp, err = client.Post(
+			"http://127.0.0.1:8800/v1/queues/foo",
+			"application/x-www-form-urlencoded",
+			bytes.NewBufferString("value=drained"),
+		)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+
+		req, _ = http.NewRequest("DELETE", "http://127.0.0.1:8800/v1/admin/drain", nil)
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		So(messageQueue.(Migrator).Draining(), ShouldBeFalse)
+
+		resp, err = client.PostForm("http://127.0.0.1:8800/v1/admin/migrate/foo", nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func TestAdminBackup(t *testing.T) {
+	Convey("Test Admin Backup Api", t, func() {
+		resp, err := client.Get("http://127.0.0.1:8800/v1/admin/backup")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		entrance.(*HttpEntry).SetBackup(messageQueue.(Backup))
+		defer entrance.(*HttpEntry).SetBackup(nil)
+		resp, err = client.Get("http://127.0.0.1:8800/v1/admin/backup")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/gzip")
+
+		ms, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		err = queue.Restore(ms, resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestAdminExport(t *testing.T) {
+	Convey("Test Admin Export Api", t, func() {
+		resp, err := client.Get("http://127.0.0.1:8800/v1/admin/export/foo")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		entrance.(*HttpEntry).SetExporter(messageQueue.(Exporter))
+		defer entrance.(*HttpEntry).SetExporter(nil)
+		resp, err = client.Get("http://127.0.0.1:8800/v1/admin/export/foo")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+
+		resp, err = client.Post(
+			"http://127.0.0.1:8800/v1/admin/import/foo2",
+			"application/x-ndjson",
+			bytes.NewReader(data),
+		)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		result := new(ImportResult)
+		err = json.NewDecoder(resp.Body).Decode(result)
+		resp.Body.Close()
+		So(err, ShouldBeNil)
+		So(result.Topic, ShouldEqual, "foo2")
+		So(result.IDs, ShouldBeEmpty)
+
+		resp, err = client.Get("http://127.0.0.1:8800/v1/admin/export/none")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+		resp, err = client.Post("http://127.0.0.1:8800/v1/admin/import/foo/x", "", nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
 func TestCloseAdmin(t *testing.T) {
 	Convey("Test Close Admin", t, func() {
 		entrance.Stop()
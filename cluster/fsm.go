@@ -0,0 +1,275 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	opSet    string = "set"
+	opDel    string = "del"
+	opCreate string = "create"
+	opRemove string = "remove"
+
+	prefixServers string = "servers/"
+	prefixTopics  string = "topics/"
+
+	watchBufferSize int = 1024
+)
+
+var errWatchOverflow = errors.New("raft watch overflowed")
+
+// Command is a change of the cluster replicated by raft.
+type Command struct {
+	Op    string
+	Key   string
+	Value string
+}
+
+// fsm keeps the cluster like etcd does:
+//
+//	servers/127.0.0.1:8808 = <expiry in unix nanoseconds> <admin address>
+//	topics/foo = max-messages=1000,policy=reject
+//	topics/foo/z = 10s
+//
+// Deleting a topic deletes its lines too. The topics and lines are created
+// only if they are not existed, and their lines only if the topics are,
+// and they are removed only if they are existed.
+type fsm struct {
+	mu       sync.RWMutex
+	data     map[string]string
+	watchers map[*watcher]bool
+}
+
+// watcher buffers the events of a watch. It is closed when the buffer
+// overflows, so that the watch fails and the topics are pulled again.
+type watcher struct {
+	events chan queue.Event
+	closed bool
+}
+
+func newFSM() *fsm {
+	f := new(fsm)
+	f.data = make(map[string]string)
+	f.watchers = make(map[*watcher]bool)
+	return f
+}
+
+func topicEvent(typ, key, value string) (queue.Event, bool) {
+	if !strings.HasPrefix(key, prefixTopics) {
+		return queue.Event{}, false
+	}
+	return queue.Event{
+		Type:  typ,
+		Key:   strings.TrimPrefix(key, prefixTopics),
+		Value: value,
+	}, true
+}
+
+// registryError returns the error of creating or removing the topic or
+// line of key which is existed or not.
+func registryError(key string, existed bool) error {
+	isLine := strings.Contains(strings.TrimPrefix(key, prefixTopics), "/")
+	switch {
+	case isLine && existed:
+		return NewError(ErrLineExisted, `cluster registry`)
+	case isLine:
+		return NewError(ErrLineNotExisted, `cluster registry`)
+	case existed:
+		return NewError(ErrTopicExisted, `cluster registry`)
+	}
+	return NewError(ErrTopicNotExisted, `cluster registry`)
+}
+
+// notify sends the event to the watchers. The lock is held.
+func (f *fsm) notify(e queue.Event) {
+	for w := range f.watchers {
+		if w.closed {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			w.closed = true
+			close(w.events)
+		}
+	}
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var cmd Command
+	err := json.Unmarshal(l.Data, &cmd)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd.Op {
+	case opCreate:
+		if _, ok := f.data[cmd.Key]; ok {
+			return registryError(cmd.Key, true)
+		}
+		if parent := path.Dir(cmd.Key); parent+"/" != prefixTopics {
+			if _, ok := f.data[parent]; !ok {
+				return registryError(parent, false)
+			}
+		}
+		f.set(cmd.Key, cmd.Value)
+	case opRemove:
+		if _, ok := f.data[cmd.Key]; !ok {
+			return registryError(cmd.Key, false)
+		}
+		f.del(cmd.Key)
+	case opSet:
+		f.set(cmd.Key, cmd.Value)
+	case opDel:
+		f.del(cmd.Key)
+	}
+	return nil
+}
+
+// set sets the key and notifies the watchers. The lock is held.
+func (f *fsm) set(key, value string) {
+	old, ok := f.data[key]
+	f.data[key] = value
+	if ok && old == value {
+		return
+	}
+	if e, ok := topicEvent(queue.EventCreate, key, value); ok {
+		f.notify(e)
+	}
+}
+
+// del deletes the key and its children, and notifies the watchers. The
+// lock is held.
+func (f *fsm) del(key string) {
+	_, ok := f.data[key]
+	if !ok {
+		return
+	}
+	delete(f.data, key)
+	for k := range f.data {
+		if strings.HasPrefix(k, key+"/") {
+			delete(f.data, k)
+		}
+	}
+	if e, ok := topicEvent(queue.EventRemove, key, ""); ok {
+		f.notify(e)
+	}
+}
+
+func (f *fsm) get(prefix string) map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data := make(map[string]string)
+	for key, value := range f.data {
+		if strings.HasPrefix(key, prefix) {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// topicEvents lists the topics and lines as create events, the topics
+// before their lines.
+func topicEvents(data map[string]string) []queue.Event {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	events := make([]queue.Event, 0, len(keys))
+	for _, key := range keys {
+		if e, ok := topicEvent(queue.EventCreate, key, data[key]); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (f *fsm) watch() *watcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &watcher{events: make(chan queue.Event, watchBufferSize)}
+	f.watchers[w] = true
+	return w
+}
+
+func (f *fsm) unwatch(w *watcher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.watchers, w)
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+	}
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{f.get("")}, nil
+}
+
+// Restore replaces the cluster by the snapshot, and notifies the watchers
+// of the differences.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	data := make(map[string]string)
+	err := json.NewDecoder(rc).Decode(&data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old := f.data
+	f.data = data
+	for key := range old {
+		if _, ok := data[key]; ok {
+			continue
+		}
+		if e, ok := topicEvent(queue.EventRemove, key, ""); ok {
+			f.notify(e)
+		}
+	}
+	added := make(map[string]string)
+	for key, value := range data {
+		if oldValue, ok := old[key]; !ok || oldValue != value {
+			added[key] = value
+		}
+	}
+	for _, e := range topicEvents(added) {
+		f.notify(e)
+	}
+	return nil
+}
+
+type fsmSnapshot struct {
+	data map[string]string
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s.data)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
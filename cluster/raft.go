@@ -0,0 +1,383 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const (
+	RaftTimeout       time.Duration = 10 * time.Second
+	RaftLeaderPolling time.Duration = 100 * time.Millisecond
+	RaftMaxPool       int           = 3
+	RaftSnapshots     int           = 2
+
+	// RaftServerTTL is how long a registered server is alive without
+	// registering again.
+	RaftServerTTL time.Duration = 2 * queue.CoordRegisterInterval
+)
+
+var (
+	errNoLeader       = errors.New("raft leader not elected")
+	errForwardTimeout = errors.New("raft forward timeout")
+)
+
+// Raft coordinates a cluster of uq servers by an embedded raft, so that
+// no etcd is needed. All the servers of the cluster are the raft peers.
+// The commands are forwarded to the leader, and the followers read their
+// local state.
+type Raft struct {
+	addr    string
+	raft    *raft.Raft
+	fsm     *fsm
+	layer   *streamLayer
+	store   *raftboltdb.BoltStore
+	clients map[string]*rpc.Client
+	mu      sync.Mutex
+
+	// the topics pulled or watched, to tell the ones removed since
+	known     map[string]bool
+	knownLock sync.Mutex
+}
+
+// NewRaft starts the raft peer listening on addr, which is its id too. The
+// cluster of the peers is bootstrapped if dir has no raft state. Blank
+// peers are skipped, so a single node may have none. The peers share the
+// secret, which the connections to addr should send first. They are
+// served by tls if serverTLS is set, and the peers are dialed by
+// clientTLS.
+func NewRaft(addr string, peers []string, dir, secret string, serverTLS, clientTLS *tls.Config) (*Raft, error) {
+	if secret == "" || len(secret) > connSecretMax {
+		return nil, errRaftSecret
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	store, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := raft.NewFileSnapshotStore(dir, RaftSnapshots, os.Stderr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if serverTLS != nil {
+		ln = tls.NewListener(ln, serverTLS)
+	}
+
+	r := new(Raft)
+	r.addr = addr
+	r.fsm = newFSM()
+	r.store = store
+	r.clients = make(map[string]*rpc.Client)
+	r.known = make(map[string]bool)
+
+	server := rpc.NewServer()
+	server.RegisterName("Raft", &forwardService{r})
+	r.layer = newStreamLayer(ln, server, secret, clientTLS)
+	transport := raft.NewNetworkTransport(r.layer, RaftMaxPool, RaftTimeout, os.Stderr)
+
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(addr)
+	config.LogOutput = os.Stderr
+	config.LogLevel = "WARN"
+
+	hasState, err := raft.HasExistingState(store, store, snaps)
+	if err != nil {
+		r.layer.Close()
+		store.Close()
+		return nil, err
+	}
+	r.raft, err = raft.NewRaft(config, r.fsm, store, store, snaps, transport)
+	if err != nil {
+		r.layer.Close()
+		store.Close()
+		return nil, err
+	}
+
+	if !hasState {
+		configuration := raft.Configuration{}
+		self := false
+		for _, peer := range peers {
+			if peer == "" {
+				continue
+			}
+			self = self || peer == addr
+			configuration.Servers = append(configuration.Servers, raft.Server{
+				ID:      raft.ServerID(peer),
+				Address: raft.ServerAddress(peer),
+			})
+		}
+		if !self {
+			configuration.Servers = append(configuration.Servers, raft.Server{
+				ID:      raft.ServerID(addr),
+				Address: raft.ServerAddress(addr),
+			})
+		}
+		err = r.raft.BootstrapCluster(configuration).Error()
+		if err != nil && err != raft.ErrCantBootstrap {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// apply applies the command on the leader, waiting for one to be elected.
+func (r *Raft) apply(cmd *Command) error {
+	deadline := time.Now().Add(RaftTimeout)
+	for {
+		if r.raft.State() == raft.Leader {
+			return r.applyLocal(cmd)
+		}
+		leader, _ := r.raft.LeaderWithID()
+		if leader != "" {
+			return r.forward(string(leader), cmd)
+		}
+		if time.Now().After(deadline) {
+			return errNoLeader
+		}
+		time.Sleep(RaftLeaderPolling)
+	}
+}
+
+func (r *Raft) applyLocal(cmd *Command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	future := r.raft.Apply(data, RaftTimeout)
+	err = future.Error()
+	if err != nil {
+		return err
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// forward applies the command on the leader, at most RaftTimeout. The
+// client is closed if it times out, so that it is dialed again.
+func (r *Raft) forward(leader string, cmd *Command) error {
+	r.mu.Lock()
+	client, ok := r.clients[leader]
+	if !ok {
+		conn, err := r.layer.dial(leader, connForward, RaftTimeout)
+		if err != nil {
+			r.mu.Unlock()
+			return err
+		}
+		client = rpc.NewClient(conn)
+		r.clients[leader] = client
+	}
+	r.mu.Unlock()
+
+	var reply ForwardReply
+	args := &ForwardArgs{Secret: r.layer.secret, Command: cmd}
+	var err error
+	select {
+	case call := <-client.Go("Raft.Apply", args, &reply, make(chan *rpc.Call, 1)).Done:
+		err = call.Error
+	case <-time.After(RaftTimeout):
+		client.Close()
+		err = errForwardTimeout
+	}
+	if err == rpc.ErrShutdown || err == errForwardTimeout {
+		r.mu.Lock()
+		if r.clients[leader] == client {
+			delete(r.clients, leader)
+		}
+		r.mu.Unlock()
+	}
+	if err == nil && reply.Error != nil {
+		return reply.Error
+	}
+	return err
+}
+
+// ForwardArgs is a command forwarded to the leader with the secret.
+type ForwardArgs struct {
+	Secret  string
+	Command *Command
+}
+
+// ForwardReply keeps the error of a forwarded command with its code,
+// which is lost by the rpc errors.
+type ForwardReply struct {
+	Error *Error
+}
+
+type forwardService struct {
+	r *Raft
+}
+
+// Apply applies the command forwarded by a follower.
+func (s *forwardService) Apply(args *ForwardArgs, reply *ForwardReply) error {
+	if !s.r.layer.authorize(args.Secret) {
+		reply.Error = NewError(
+			ErrUnauthorized,
+			`raft secret`,
+		)
+		return nil
+	}
+	if s.r.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	err := s.r.applyLocal(args.Command)
+	if e, ok := err.(*Error); ok {
+		reply.Error = e
+		return nil
+	}
+	return err
+}
+
+func (r *Raft) Register(addr, admin string) error {
+	expiry := time.Now().Add(RaftServerTTL).UnixNano()
+	value := strconv.FormatInt(expiry, 10)
+	if admin != "" {
+		value += " " + admin
+	}
+	return r.apply(&Command{opSet, prefixServers + addr, value})
+}
+
+func (r *Raft) UnRegister(addr string) error {
+	return r.apply(&Command{opDel, prefixServers + addr, ""})
+}
+
+func (r *Raft) Servers() ([]string, error) {
+	servers := make([]string, 0)
+	for key := range r.aliveServers() {
+		servers = append(servers, strings.TrimPrefix(key, prefixServers))
+	}
+	return servers, nil
+}
+
+func (r *Raft) Admins() ([]string, error) {
+	admins := make([]string, 0)
+	for _, admin := range r.aliveServers() {
+		if admin != "" {
+			admins = append(admins, admin)
+		}
+	}
+	return admins, nil
+}
+
+// aliveServers returns the admin addresses of the servers not expired by
+// their keys.
+func (r *Raft) aliveServers() map[string]string {
+	now := time.Now().UnixNano()
+	alive := make(map[string]string)
+	for key, value := range r.fsm.get(prefixServers) {
+		parts := strings.SplitN(value, " ", 2)
+		expiry, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || expiry < now {
+			continue
+		}
+		alive[key] = ""
+		if len(parts) > 1 {
+			alive[key] = parts[1]
+		}
+	}
+	return alive
+}
+
+func (r *Raft) RegisterTopic(topic, options string) error {
+	return r.apply(&Command{opCreate, prefixTopics + topic, options})
+}
+
+func (r *Raft) UnRegisterTopic(topic string) error {
+	return r.apply(&Command{opRemove, prefixTopics + topic, ""})
+}
+
+func (r *Raft) RegisterLine(topic, line, recycle string) error {
+	return r.apply(&Command{opCreate, prefixTopics + topic + "/" + line, recycle})
+}
+
+func (r *Raft) UnRegisterLine(topic, line string) error {
+	return r.apply(&Command{opRemove, prefixTopics + topic + "/" + line, ""})
+}
+
+// Pull lists the topics and lines, and the ones pulled or watched before
+// but removed since, as a watch may overflow.
+func (r *Raft) Pull() ([]queue.Event, error) {
+	events := topicEvents(r.fsm.get(prefixTopics))
+
+	r.knownLock.Lock()
+	defer r.knownLock.Unlock()
+	known := make(map[string]bool, len(events))
+	for _, e := range events {
+		known[e.Key] = true
+	}
+	for key := range r.known {
+		if !known[key] {
+			events = append(events, queue.Event{Type: queue.EventRemove, Key: key})
+		}
+	}
+	r.known = known
+	return events, nil
+}
+
+func (r *Raft) seen(e queue.Event) {
+	r.knownLock.Lock()
+	defer r.knownLock.Unlock()
+	if e.Type == queue.EventCreate {
+		r.known[e.Key] = true
+	} else {
+		delete(r.known, e.Key)
+	}
+}
+
+func (r *Raft) Watch(events chan<- queue.Event, stop chan bool) error {
+	w := r.fsm.watch()
+	defer r.fsm.unwatch(w)
+
+	for {
+		select {
+		case e, ok := <-w.events:
+			if !ok {
+				return errWatchOverflow
+			}
+			select {
+			case events <- e:
+				r.seen(e)
+			case <-stop:
+				return nil
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func (r *Raft) Close() error {
+	err := r.raft.Shutdown().Error()
+	r.layer.Close()
+	r.mu.Lock()
+	for _, client := range r.clients {
+		client.Close()
+	}
+	r.mu.Unlock()
+	r.store.Close()
+	return err
+}
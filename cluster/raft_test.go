@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/store"
+	. "github.com/buaazp/uq/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	peers = []string{"127.0.0.1:8891", "127.0.0.1:8892", "127.0.0.1:8893"}
+	nodes []*Raft
+	dirs  []string
+)
+
+// eventually polls the condition for a few seconds.
+func eventually(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestNewRaft(t *testing.T) {
+	Convey("Test New Raft Peers", t, func() {
+		for _, peer := range peers {
+			dir, err := ioutil.TempDir("", "uq.raft.test")
+			So(err, ShouldBeNil)
+			dirs = append(dirs, dir)
+			r, err := NewRaft(peer, peers, dir, "s3cret", nil, nil)
+			So(err, ShouldBeNil)
+			nodes = append(nodes, r)
+		}
+	})
+}
+
+func TestSingleRaft(t *testing.T) {
+	Convey("Test Single Raft Without Peers", t, func() {
+		dir, err := ioutil.TempDir("", "uq.raft.test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		r, err := NewRaft("127.0.0.1:8896", []string{""}, dir, "s3cret", nil, nil)
+		So(err, ShouldBeNil)
+		defer r.Close()
+		So(eventually(func() bool {
+			return r.RegisterTopic("single", "") == nil
+		}), ShouldBeTrue)
+	})
+}
+
+func TestRaftRegister(t *testing.T) {
+	Convey("Test Raft Register", t, func() {
+		stop := make(chan bool)
+		defer close(stop)
+		events := make(chan queue.Event, 10)
+		go nodes[0].Watch(events, stop)
+
+		err := nodes[1].RegisterTopic("foo", "max-messages=10,policy=reject")
+		So(err, ShouldBeNil)
+		err = nodes[2].RegisterLine("foo", "x", "10s")
+		So(err, ShouldBeNil)
+		So(<-events, ShouldResemble, queue.Event{Type: queue.EventCreate, Key: "foo", Value: "max-messages=10,policy=reject"})
+		So(<-events, ShouldResemble, queue.Event{Type: queue.EventCreate, Key: "foo/x", Value: "10s"})
+
+		So(eventually(func() bool {
+			events, _ := nodes[2].Pull()
+			return len(events) == 2
+		}), ShouldBeTrue)
+
+		err = nodes[0].UnRegisterTopic("foo")
+		So(err, ShouldBeNil)
+		So(<-events, ShouldResemble, queue.Event{Type: queue.EventRemove, Key: "foo"})
+		So(eventually(func() bool {
+			events, _ := nodes[1].Pull()
+			return len(events) == 0
+		}), ShouldBeTrue)
+
+		// conflicts keep their codes when forwarded to the leader
+		err = nodes[1].RegisterTopic("baz", "")
+		So(err, ShouldBeNil)
+		err = nodes[2].RegisterTopic("baz", "")
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicExisted)
+		err = nodes[0].RegisterLine("qux", "x", "")
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicNotExisted)
+		err = nodes[1].UnRegisterLine("baz", "x")
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrLineNotExisted)
+		err = nodes[2].UnRegisterTopic("baz")
+		So(err, ShouldBeNil)
+		So(<-events, ShouldResemble, queue.Event{Type: queue.EventCreate, Key: "baz"})
+		So(<-events, ShouldResemble, queue.Event{Type: queue.EventRemove, Key: "baz"})
+
+		err = nodes[2].Register("127.0.0.1:8808", "127.0.0.1:8809")
+		So(err, ShouldBeNil)
+		So(eventually(func() bool {
+			servers, _ := nodes[0].Servers()
+			return len(servers) == 1 && servers[0] == "127.0.0.1:8808"
+		}), ShouldBeTrue)
+		admins, err := nodes[0].Admins()
+		So(err, ShouldBeNil)
+		So(admins, ShouldResemble, []string{"127.0.0.1:8809"})
+		err = nodes[2].UnRegister("127.0.0.1:8808")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestRaftSecret(t *testing.T) {
+	Convey("Test Raft Connections Without The Secret", t, func() {
+		_, err := NewRaft("127.0.0.1:8896", nil, os.TempDir(), "", nil, nil)
+		So(err, ShouldNotBeNil)
+
+		// refused at the handshake
+		conn, err := net.Dial("tcp", peers[0])
+		So(err, ShouldBeNil)
+		_, err = conn.Write([]byte{connRaft, 0})
+		So(err, ShouldBeNil)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		So(err, ShouldEqual, io.EOF)
+		conn.Close()
+
+		layer := &streamLayer{secret: "wrong"}
+		conn, err = layer.dial(peers[0], connForward, time.Second)
+		So(err, ShouldBeNil)
+		client := rpc.NewClient(conn)
+		var reply ForwardReply
+		cmd := &Command{opCreate, prefixTopics + "evil", ""}
+		err = client.Call("Raft.Apply", &ForwardArgs{Secret: "wrong", Command: cmd}, &reply)
+		So(err, ShouldNotBeNil)
+		client.Close()
+
+		// and by the forwarded commands
+		err = (&forwardService{nodes[0]}).Apply(&ForwardArgs{Secret: "wrong", Command: cmd}, &reply)
+		So(err, ShouldBeNil)
+		So(reply.Error.ErrorCode, ShouldEqual, ErrUnauthorized)
+		events, err := nodes[0].Pull()
+		So(err, ShouldBeNil)
+		for _, e := range events {
+			So(e.Key, ShouldNotEqual, "evil")
+		}
+	})
+}
+
+func TestRaftQueue(t *testing.T) {
+	Convey("Test Queues Coordinated By Raft", t, func() {
+		uqs := make([]*queue.UnitedQueue, 2)
+		for i := range uqs {
+			storage, err := store.NewMemStore()
+			So(err, ShouldBeNil)
+			uqs[i], err = queue.NewUnitedQueue(storage, "127.0.0.1", 8808+i, nil, "uq")
+			So(err, ShouldBeNil)
+			uqs[i].SetCoordinator(nodes[i])
+		}
+
+		err := uqs[0].Create("bar", "")
+		So(err, ShouldBeNil)
+		err = uqs[0].Create("bar/y", "1s")
+		So(err, ShouldBeNil)
+		So(eventually(func() bool {
+			_, err := uqs[1].Stat("bar/y")
+			return err == nil
+		}), ShouldBeTrue)
+
+		err = uqs[1].Remove("bar")
+		So(err, ShouldBeNil)
+		So(eventually(func() bool {
+			_, err := uqs[0].Stat("bar")
+			return err != nil
+		}), ShouldBeTrue)
+
+		// the queues close their coordinators
+		for _, u := range uqs {
+			u.Close()
+		}
+		nodes = nodes[2:]
+	})
+}
+
+func TestCloseRaft(t *testing.T) {
+	Convey("Test Close Raft Peers", t, func() {
+		for _, r := range nodes {
+			So(r.Close(), ShouldBeNil)
+		}
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// The first byte of a connection tells the raft connections from the
+// forwarded commands, so that both are served on the raft address. The
+// secret shared by the cluster follows it, prefixed by its length.
+const (
+	connRaft    byte = 'R'
+	connForward byte = 'F'
+
+	connHandshakeTimeout time.Duration = 5 * time.Second
+	connSecretMax        int           = 255
+)
+
+var (
+	errLayerClosed = errors.New("raft layer closed")
+	errRaftSecret  = errors.New("raft secret should be 1 to 255 bytes")
+)
+
+// streamLayer is the raft stream layer of the connections marked as raft.
+// The forwarded commands are served by the rpc server. The connections
+// without the secret are refused, and they are dialed by tls if
+// tlsConfig is set.
+type streamLayer struct {
+	ln        net.Listener
+	server    *rpc.Server
+	secret    string
+	tlsConfig *tls.Config
+	conns     chan net.Conn
+	closed    chan bool
+	closing   sync.Once
+}
+
+func newStreamLayer(ln net.Listener, server *rpc.Server, secret string, tlsConfig *tls.Config) *streamLayer {
+	s := new(streamLayer)
+	s.ln = ln
+	s.server = server
+	s.secret = secret
+	s.tlsConfig = tlsConfig
+	s.conns = make(chan net.Conn)
+	s.closed = make(chan bool)
+	go s.acceptRun()
+	return s
+}
+
+func (s *streamLayer) acceptRun() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			s.Close()
+			return
+		}
+		go s.handshake(conn)
+	}
+}
+
+func (s *streamLayer) handshake(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(connHandshakeTimeout))
+	b := make([]byte, 2)
+	_, err := io.ReadFull(conn, b)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	secret := make([]byte, b[1])
+	_, err = io.ReadFull(conn, secret)
+	if err != nil || !s.authorize(string(secret)) {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	switch b[0] {
+	case connRaft:
+		select {
+		case s.conns <- conn:
+		case <-s.closed:
+			conn.Close()
+		}
+	case connForward:
+		s.server.ServeConn(conn)
+	default:
+		conn.Close()
+	}
+}
+
+func (s *streamLayer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	case <-s.closed:
+		return nil, errLayerClosed
+	}
+}
+
+func (s *streamLayer) Close() error {
+	var err error
+	s.closing.Do(func() {
+		close(s.closed)
+		err = s.ln.Close()
+	})
+	return err
+}
+
+func (s *streamLayer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *streamLayer) authorize(secret string) bool {
+	return s.secret != "" &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(s.secret)) == 1
+}
+
+func (s *streamLayer) dial(addr string, mark byte, timeout time.Duration) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		dialer := &net.Dialer{Timeout: timeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = conn.Write(append([]byte{mark, byte(len(s.secret))}, s.secret...))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return conn, nil
+}
+
+func (s *streamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return s.dial(string(address), connRaft, timeout)
+}
@@ -0,0 +1,218 @@
+package entry
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	C_USER = "user"
+)
+
+// McAuthKey is the key of the memcached text protocol 'set' which
+// authenticates a connection with the data '<name> <token>'.
+const McAuthKey string = "auth"
+
+type keyRight struct {
+	right acl.Right
+	key   string
+}
+
+func authorizeKeys(access *acl.ACL, u *acl.User, krs []keyRight) error {
+	for _, kr := range krs {
+		err := access.Authorize(u, kr.right, kr.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rightKeys(right acl.Right, keys ...string) []keyRight {
+	krs := make([]keyRight, len(keys))
+	for i, key := range keys {
+		krs[i] = keyRight{right, key}
+	}
+	return krs
+}
+
+// parseAuth splits the credentials of 'AUTH [name] token' like commands.
+func parseAuth(args []string) (name, token string) {
+	if len(args) == 1 {
+		return "", args[0]
+	}
+	return args[0], args[1]
+}
+
+func (r *RedisEntry) OnAuth(session *Session, cmd *Command) *Reply {
+	if r.access == nil {
+		return ErrorReply(NewError(
+			ErrBadRequest,
+			`no acl is set`,
+		))
+	}
+
+	name, token := parseAuth(cmd.StringArgs()[1:])
+	u, err := r.access.Authenticate(name, token)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	session.SetAttribute(C_USER, u)
+	return StatusReply("OK")
+}
+
+// redisRightKeys returns the rights needed by a redis command.
+func redisRightKeys(cmd *Command) []keyRight {
+	args := cmd.StringArgs()
+	switch cmd.Name() {
+	case "ADD", "QADD", "EMPTY", "QEMPTY":
+		return rightKeys(acl.RightAdmin, args[1])
+	case "SET", "QPUSH", "MSET", "QMPUSH", "LPUSH", "RPUSH":
+		return rightKeys(acl.RightProduce, args[1])
+	case "GET", "QPOP", "DEL", "QDEL", "MDEL", "QMDEL":
+		return rightKeys(acl.RightConsume, args[1:]...)
+	case "MGET", "QMPOP", "INFO", "QINFO":
+		return rightKeys(acl.RightConsume, args[1])
+	case "RPOP", "LPOP", "LLEN":
+		return rightKeys(acl.RightConsume, listLineKey(args[1]))
+	case "BRPOP", "BLPOP":
+		krs := make([]keyRight, 0, len(args)-2)
+		for _, key := range args[1 : len(args)-1] {
+			krs = append(krs, keyRight{acl.RightConsume, listLineKey(key)})
+		}
+		return krs
+	}
+	return nil
+}
+
+// authorizeCreate checks the admin right to create the key implicitly,
+// like the legacy list and memcacheQ clients do.
+func authorizeCreate(access *acl.ACL, u *acl.User, key string) error {
+	if access == nil {
+		return nil
+	}
+	return access.Authorize(u, acl.RightAdmin, key)
+}
+
+func (r *RedisEntry) authorize(session *Session, cmd *Command) error {
+	if r.access == nil {
+		return nil
+	}
+	u, _ := session.GetAttribute(C_USER).(*acl.User)
+	return authorizeKeys(r.access, u, redisRightKeys(cmd))
+}
+
+// mcRightKeys returns the rights needed by a mc request.
+func (m *McEntry) mcRightKeys(req *Request) []keyRight {
+	switch req.Cmd {
+	case "get", "gets", "mg":
+		krs := make([]keyRight, 0, len(req.Keys))
+		for i, key := range req.Keys {
+			if m.mcq && isMcqKey(key) {
+				key = key + "/" + DefaultLineName
+			} else if i > 0 && !isLineKey(key) {
+				// the trailing id flag of a multi-get
+				continue
+			}
+			krs = append(krs, keyRight{acl.RightConsume, key})
+		}
+		return krs
+	case "set", "ms":
+		mode, _ := metaFlag(req.Flags, 'M')
+		if req.Cmd == "ms" && strings.ToUpper(mode) == "E" {
+			return rightKeys(acl.RightAdmin, req.Keys[0])
+		}
+		return rightKeys(acl.RightProduce, req.Keys[0])
+	case "add":
+		return rightKeys(acl.RightAdmin, req.Keys[0])
+	case "delete", "md":
+		if m.mcq && isMcqKey(req.Keys[0]) {
+			return rightKeys(acl.RightAdmin, req.Keys[0])
+		}
+		return rightKeys(acl.RightConsume, req.Keys[0])
+	case "stats":
+		if len(req.Keys) > 0 && !(m.mcq && req.Keys[0] == "queue") {
+			return rightKeys(acl.RightConsume, req.Keys[0])
+		}
+	}
+	return nil
+}
+
+// mcAuthenticate authenticates the connection by 'set auth 0 0 <n>' with
+// the data '<name> <token>' like memcached does.
+func (m *McEntry) mcAuthenticate(req *Request) (*acl.User, *Response) {
+	resp := new(Response)
+	resp.noreply = req.NoReply
+	name, token := parseAuth(strings.Fields(string(req.Item.Body)))
+	u, err := m.access.Authenticate(name, token)
+	if err != nil {
+		writeErrorMc(resp, err)
+		return nil, resp
+	}
+	resp.status = "STORED"
+	return u, resp
+}
+
+// httpAuthorize checks the right of the user authenticated by ServeHTTP.
+func httpAuthorize(access *acl.ACL, req *http.Request, right acl.Right, key string) error {
+	if access == nil {
+		return nil
+	}
+	return access.Authorize(acl.FromContext(req.Context()), right, key)
+}
+
+func (m *McEntry) authorize(u *acl.User, req *Request) error {
+	if m.access == nil {
+		return nil
+	}
+	return authorizeKeys(m.access, u, m.mcRightKeys(req))
+}
+
+// binRightKeys returns the rights needed by a binary request.
+func binRightKeys(req *binRequest) []keyRight {
+	switch req.opcode {
+	case binOpGet, binOpGetQ, binOpGetK, binOpGetKQ, binOpDelete, binOpDeleteQ:
+		return rightKeys(acl.RightConsume, req.key)
+	case binOpSet, binOpSetQ:
+		return rightKeys(acl.RightProduce, req.key)
+	case binOpAdd, binOpAddQ:
+		return rightKeys(acl.RightAdmin, req.key)
+	case binOpStat:
+		if req.key != "" {
+			return rightKeys(acl.RightConsume, req.key)
+		}
+	}
+	return nil
+}
+
+// binAuthenticate serves the SASL PLAIN authentication whose value is
+// '[authzid]\0name\0token'.
+func (m *McEntry) binAuthenticate(req *binRequest, resp *binResponse) *acl.User {
+	if req.opcode == binOpSaslList {
+		resp.value = []byte("PLAIN")
+		return nil
+	}
+	if req.key != "PLAIN" {
+		resp.status = binStatusAuthError
+		resp.value = []byte("unsupported mechanism")
+		return nil
+	}
+
+	parts := strings.Split(string(req.value), "\x00")
+	if len(parts) != 3 {
+		resp.status = binStatusAuthError
+		resp.value = []byte("bad plain credentials")
+		return nil
+	}
+	u, err := m.access.Authenticate(parts[1], parts[2])
+	if err != nil {
+		resp.status = binStatusAuthError
+		resp.value = []byte(err.Error())
+		return nil
+	}
+	resp.value = []byte("Authenticated")
+	return u
+}
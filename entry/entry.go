@@ -1,8 +1,25 @@
 package entry
 
+import "time"
+
+const (
+	MaxKeyLength int = 512
+)
+
+// MaxBodyLength is the max size of a message read by the entrances. Larger
+// bodies are rejected before they are buffered.
+var MaxBodyLength int = 10 * 1024 * 1024
+
+const (
+	// ConsumeInterval is the interval of polling a blank line when the
+	// messages are pushed to the consumers.
+	ConsumeInterval time.Duration = 100 * time.Millisecond
+)
+
 const (
-	MaxKeyLength  int = 512
-	MaxBodyLength int = 10 * 1024 * 1024
+	// DefaultLineName is the line used when a client addresses a topic
+	// directly, like redis list commands do.
+	DefaultLineName string = "default"
 )
 
 type Entrance interface {
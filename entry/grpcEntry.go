@@ -0,0 +1,412 @@
+package entry
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/entry/uqpb"
+	"github.com/buaazp/uq/limit"
+	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
+	. "github.com/buaazp/uq/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type GrpcEntry struct {
+	uqpb.UnimplementedUnitedQueueServer
+	host         string
+	port         int
+	server       *grpc.Server
+	access       *acl.ACL
+	limiter      *limit.Limiter
+	router       *route.Router
+	tlsConfig    *tls.Config
+	unixPath     string
+	stopListener *StopListener
+	messageQueue queue.MessageQueue
+}
+
+func NewGrpcEntry(host string, port int, messageQueue queue.MessageQueue) (*GrpcEntry, error) {
+	g := new(GrpcEntry)
+	g.host = host
+	g.port = port
+	g.messageQueue = messageQueue
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(g.unaryAuth, g.unaryRoute),
+		grpc.StreamInterceptor(g.streamAuth),
+		grpc.StatsHandler(&grpcStats{g}),
+		grpc.MaxRecvMsgSize(MaxBodyLength+MaxKeyLength),
+	)
+	uqpb.RegisterUnitedQueueServer(server, g)
+	g.server = server
+
+	return g, nil
+}
+
+// SetUnixSocket listens on the unix socket path too. With a zero port it
+// listens on the unix socket only.
+func (g *GrpcEntry) SetUnixSocket(path string) {
+	g.unixPath = path
+}
+
+// SetTLSConfig serves the connections over TLS. The config may verify
+// the client certificates too.
+func (g *GrpcEntry) SetTLSConfig(config *tls.Config) {
+	g.tlsConfig = config
+}
+
+// grpcTLSConfig returns the TLS config negotiating http2, which is
+// required by the grpc clients.
+func (g *GrpcEntry) grpcTLSConfig() *tls.Config {
+	if g.tlsConfig == nil {
+		return nil
+	}
+	config := g.tlsConfig.Clone()
+	config.NextProtos = []string{"h2"}
+	return config
+}
+
+// SetACL sets the access control of the entry. Clients authenticate with
+// the bearer token in the authorization metadata.
+func (g *GrpcEntry) SetACL(access *acl.ACL) {
+	g.access = access
+}
+
+// SetLimiter limits the rate of the pushes of every connection, client
+// and topic.
+func (g *GrpcEntry) SetLimiter(l *limit.Limiter) {
+	g.limiter = l
+}
+
+// SetRouter redirects the calls of the topics owned by other servers with
+// FailedPrecondition errors telling the owners.
+func (g *GrpcEntry) SetRouter(router *route.Router) {
+	g.router = router
+}
+
+// grpcRights is the right needed by the unary methods.
+var grpcRights = map[string]acl.Right{
+	"Create":       acl.RightAdmin,
+	"Push":         acl.RightProduce,
+	"MultiPush":    acl.RightProduce,
+	"Pop":          acl.RightConsume,
+	"MultiPop":     acl.RightConsume,
+	"Confirm":      acl.RightConsume,
+	"MultiConfirm": acl.RightConsume,
+	"Stat":         acl.RightConsume,
+	"Empty":        acl.RightAdmin,
+	"Remove":       acl.RightAdmin,
+}
+
+func (g *GrpcEntry) authenticate(ctx context.Context) (context.Context, error) {
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	auths := md.Get("authorization")
+	if len(auths) == 0 {
+		return acl.NewContext(ctx, nil), nil
+	}
+	if !strings.HasPrefix(auths[0], "Bearer ") {
+		return nil, NewError(
+			ErrUnauthorized,
+			`bearer token required`,
+		)
+	}
+	token = strings.TrimSpace(auths[0][len("Bearer "):])
+	u, err := g.access.Authenticate("", token)
+	if err != nil {
+		return nil, err
+	}
+	return acl.NewContext(ctx, u), nil
+}
+
+func (g *GrpcEntry) authorize(ctx context.Context, right acl.Right, key string) error {
+	if g.access == nil {
+		return nil
+	}
+	return g.access.Authorize(acl.FromContext(ctx), right, key)
+}
+
+func (g *GrpcEntry) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if g.access == nil {
+		return handler(ctx, req)
+	}
+	ctx, err := g.authenticate(ctx)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	right := grpcRights[method]
+	for _, key := range grpcKeys(req) {
+		err = g.authorize(ctx, right, key)
+		if err != nil {
+			return nil, writeErrorGrpc(err)
+		}
+	}
+	return handler(ctx, req)
+}
+
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// streamAuth authenticates the streaming methods, which authorize the
+// keys by themselves as they are not known here.
+func (g *GrpcEntry) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if g.access == nil {
+		return handler(srv, ss)
+	}
+	ctx, err := g.authenticate(ss.Context())
+	if err != nil {
+		return writeErrorGrpc(err)
+	}
+	return handler(srv, &authServerStream{ss, ctx})
+}
+
+func writeErrorGrpc(err error) error {
+	if err == nil {
+		return nil
+	}
+	var code codes.Code
+	switch errorCode(err) {
+	case ErrNone, ErrTopicNotExisted, ErrLineNotExisted, ErrNotDelivered:
+		code = codes.NotFound
+	case ErrTopicExisted, ErrLineExisted:
+		code = codes.AlreadyExists
+	case ErrBadKey, ErrBadRequest, ErrMessageTooLarge, ErrCrossOwner:
+		code = codes.InvalidArgument
+	case ErrUnauthorized:
+		code = codes.Unauthenticated
+	case ErrForbidden:
+		code = codes.PermissionDenied
+	case ErrTooManyRequests, ErrTopicFull:
+		code = codes.ResourceExhausted
+	case ErrMoved:
+		code = codes.FailedPrecondition
+	case ErrDraining:
+		code = codes.Unavailable
+	default:
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
+
+func (g *GrpcEntry) Create(ctx context.Context, req *uqpb.CreateRequest) (*uqpb.CreateResponse, error) {
+	err := g.messageQueue.Create(req.Key, req.Recycle)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.CreateResponse{}, nil
+}
+
+func (g *GrpcEntry) Push(ctx context.Context, req *uqpb.PushRequest) (*uqpb.PushResponse, error) {
+	err := grpcThrottle(g.limiter, ctx, req.Key, [][]byte{req.Data})
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	err = g.messageQueue.Push(req.Key, req.Data)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.PushResponse{}, nil
+}
+
+func (g *GrpcEntry) MultiPush(ctx context.Context, req *uqpb.MultiPushRequest) (*uqpb.MultiPushResponse, error) {
+	err := grpcThrottle(g.limiter, ctx, req.Key, req.Datas)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	err = g.messageQueue.MultiPush(req.Key, req.Datas)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.MultiPushResponse{}, nil
+}
+
+func (g *GrpcEntry) Pop(ctx context.Context, req *uqpb.PopRequest) (*uqpb.Message, error) {
+	id, data, err := g.messageQueue.Pop(req.Key)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.Message{Id: id, Data: data}, nil
+}
+
+func (g *GrpcEntry) MultiPop(ctx context.Context, req *uqpb.MultiPopRequest) (*uqpb.MultiPopResponse, error) {
+	ids, datas, err := g.messageQueue.MultiPop(req.Key, int(req.N))
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+
+	msgs := make([]*uqpb.Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = &uqpb.Message{Id: id, Data: datas[i]}
+	}
+	return &uqpb.MultiPopResponse{Messages: msgs}, nil
+}
+
+func (g *GrpcEntry) Confirm(ctx context.Context, req *uqpb.ConfirmRequest) (*uqpb.ConfirmResponse, error) {
+	err := g.messageQueue.Confirm(req.Id)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.ConfirmResponse{}, nil
+}
+
+func (g *GrpcEntry) MultiConfirm(ctx context.Context, req *uqpb.MultiConfirmRequest) (*uqpb.MultiConfirmResponse, error) {
+	errs := g.messageQueue.MultiConfirm(req.Ids)
+
+	rets := make([]string, len(errs))
+	for i, err := range errs {
+		if err != nil {
+			rets[i] = err.Error()
+		}
+	}
+	return &uqpb.MultiConfirmResponse{Errors: rets}, nil
+}
+
+// Consume pops the messages of a line and sends them to the client until
+// the client goes away. When the line is blank it polls the line again
+// after ConsumeInterval.
+func (g *GrpcEntry) Consume(req *uqpb.ConsumeRequest, stream uqpb.UnitedQueue_ConsumeServer) error {
+	batch := int(req.Batch)
+	if batch <= 0 {
+		batch = 1
+	}
+
+	ctx := stream.Context()
+	err := g.authorize(ctx, acl.RightConsume, req.Key)
+	if err != nil {
+		return writeErrorGrpc(err)
+	}
+	if owner := g.router.Owner(req.Key); owner != "" {
+		return writeErrorGrpc(movedError(owner))
+	}
+	for {
+		ids, datas, err := g.messageQueue.MultiPop(req.Key, batch)
+		if err != nil {
+			if errorCode(err) != ErrNone {
+				return writeErrorGrpc(err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(ConsumeInterval):
+			}
+			continue
+		}
+
+		for i, id := range ids {
+			err = stream.Send(&uqpb.Message{Id: id, Data: datas[i]})
+			if err != nil {
+				// unsent messages will be recycled if the line has recycle
+				return err
+			}
+		}
+	}
+}
+
+func (g *GrpcEntry) Ack(stream uqpb.UnitedQueue_AckServer) error {
+	resp := new(uqpb.AckResponse)
+	resp.Failed = make(map[string]string)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = g.authorize(stream.Context(), acl.RightConsume, req.Id)
+		if err == nil {
+			if owner := g.router.Owner(req.Id); owner != "" {
+				err = movedError(owner)
+			}
+		}
+		if err == nil {
+			err = g.messageQueue.Confirm(req.Id)
+		}
+		if err != nil {
+			resp.Failed[req.Id] = err.Error()
+			continue
+		}
+		resp.Acked++
+	}
+}
+
+func (g *GrpcEntry) Stat(ctx context.Context, req *uqpb.StatRequest) (*uqpb.QueueStat, error) {
+	qs, err := g.messageQueue.Stat(req.Key)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return queueStatPb(qs), nil
+}
+
+func queueStatPb(qs *queue.QueueStat) *uqpb.QueueStat {
+	pb := &uqpb.QueueStat{
+		Name:    qs.Name,
+		Type:    qs.Type,
+		Recycle: qs.Recycle,
+		Head:    qs.Head,
+		Ihead:   qs.IHead,
+		Tail:    qs.Tail,
+		Count:   qs.Count,
+	}
+	for _, ls := range qs.Lines {
+		pb.Lines = append(pb.Lines, queueStatPb(ls))
+	}
+	return pb
+}
+
+func (g *GrpcEntry) Empty(ctx context.Context, req *uqpb.EmptyRequest) (*uqpb.EmptyResponse, error) {
+	err := g.messageQueue.Empty(req.Key)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.EmptyResponse{}, nil
+}
+
+func (g *GrpcEntry) Remove(ctx context.Context, req *uqpb.RemoveRequest) (*uqpb.RemoveResponse, error) {
+	err := g.messageQueue.Remove(req.Key)
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	return &uqpb.RemoveResponse{}, nil
+}
+
+func (g *GrpcEntry) ListenAndServe() error {
+	ls, err := ListenAll(g.host, g.port, g.unixPath)
+	if err != nil {
+		return err
+	}
+
+	stopListener, err := NewTLSStopListener(g.grpcTLSConfig(), ls...)
+	if err != nil {
+		return err
+	}
+	g.stopListener = stopListener
+
+	log.Printf("grpc entrance serving at %s...", g.stopListener)
+	return g.server.Serve(g.stopListener)
+}
+
+func (g *GrpcEntry) Stop() {
+	log.Printf("grpc entry stoping...")
+	g.stopListener.Stop()
+	g.server.Stop()
+	g.messageQueue.Close()
+}
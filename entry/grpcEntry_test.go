@@ -0,0 +1,140 @@
+package entry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buaazp/uq/entry/uqpb"
+	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
+	"github.com/buaazp/uq/store"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var grpcClient uqpb.UnitedQueueClient
+
+func TestNewGrpcEntry(t *testing.T) {
+	Convey("Test New Grpc Entry", t, func() {
+		var err error
+		storage, err = store.NewMemStore()
+		So(err, ShouldBeNil)
+		So(storage, ShouldNotBeNil)
+		messageQueue, err = queue.NewUnitedQueue(storage, "127.0.0.1", 8805, nil, "uq")
+		So(err, ShouldBeNil)
+		So(messageQueue, ShouldNotBeNil)
+
+		entrance, err = NewGrpcEntry("0.0.0.0", 8805, messageQueue)
+		So(err, ShouldBeNil)
+		So(entrance, ShouldNotBeNil)
+
+		go func() {
+			entrance.ListenAndServe()
+		}()
+
+		cc, err := grpc.NewClient("127.0.0.1:8805", grpc.WithTransportCredentials(insecure.NewCredentials()))
+		So(err, ShouldBeNil)
+		grpcClient = uqpb.NewUnitedQueueClient(cc)
+	})
+}
+
+func TestGrpcAdd(t *testing.T) {
+	Convey("Test Grpc Add Api", t, func() {
+		_, err := grpcClient.Create(context.Background(), &uqpb.CreateRequest{Key: "foo"})
+		So(err, ShouldBeNil)
+
+		_, err = grpcClient.Create(context.Background(), &uqpb.CreateRequest{Key: "foo/x", Recycle: "10s"})
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestGrpcPush(t *testing.T) {
+	Convey("Test Grpc Push Api", t, func() {
+		_, err := grpcClient.Push(context.Background(), &uqpb.PushRequest{Key: "foo", Data: []byte("1")})
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestGrpcPop(t *testing.T) {
+	Convey("Test Grpc Pop Api", t, func() {
+		msg, err := grpcClient.Pop(context.Background(), &uqpb.PopRequest{Key: "foo/x"})
+		So(err, ShouldBeNil)
+		So(msg.Id, ShouldEqual, "foo/x/0")
+		So(string(msg.Data), ShouldEqual, "1")
+	})
+}
+
+func TestGrpcConfirm(t *testing.T) {
+	Convey("Test Grpc Confirm Api", t, func() {
+		_, err := grpcClient.Confirm(context.Background(), &uqpb.ConfirmRequest{Id: "foo/x/0"})
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestGrpcConsume(t *testing.T) {
+	Convey("Test Grpc Consume Api", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := grpcClient.Consume(ctx, &uqpb.ConsumeRequest{Key: "foo/x"})
+		So(err, ShouldBeNil)
+
+		_, err = grpcClient.Push(context.Background(), &uqpb.PushRequest{Key: "foo", Data: []byte("2")})
+		So(err, ShouldBeNil)
+
+		msg, err := stream.Recv()
+		So(err, ShouldBeNil)
+		So(msg.Id, ShouldEqual, "foo/x/1")
+		So(string(msg.Data), ShouldEqual, "2")
+
+		ack, err := grpcClient.Ack(context.Background())
+		So(err, ShouldBeNil)
+		err = ack.Send(&uqpb.AckRequest{Id: msg.Id})
+		So(err, ShouldBeNil)
+		resp, err := ack.CloseAndRecv()
+		So(err, ShouldBeNil)
+		So(resp.Acked, ShouldEqual, 1)
+	})
+}
+
+func TestGrpcStat(t *testing.T) {
+	Convey("Test Grpc Stat Api", t, func() {
+		qs, err := grpcClient.Stat(context.Background(), &uqpb.StatRequest{Key: "foo/x"})
+		So(err, ShouldBeNil)
+		So(qs.Name, ShouldEqual, "foo/x")
+		So(qs.Count, ShouldEqual, 0)
+	})
+}
+
+func TestGrpcRoute(t *testing.T) {
+	Convey("Test Grpc Route Streams", t, func() {
+		r, _, remote := newTestRouter("127.0.0.1:8805", "127.0.0.1:8815", route.ModeRedirect)
+		entrance.(*GrpcEntry).SetRouter(r)
+		defer entrance.(*GrpcEntry).SetRouter(nil)
+
+		stream, err := grpcClient.Consume(context.Background(), &uqpb.ConsumeRequest{Key: remote + "/x"})
+		So(err, ShouldBeNil)
+		_, err = stream.Recv()
+		So(status.Code(err), ShouldEqual, codes.FailedPrecondition)
+		So(err.Error(), ShouldContainSubstring, "127.0.0.1:8815")
+
+		ack, err := grpcClient.Ack(context.Background())
+		So(err, ShouldBeNil)
+		err = ack.Send(&uqpb.AckRequest{Id: remote + "/x/0"})
+		So(err, ShouldBeNil)
+		resp, err := ack.CloseAndRecv()
+		So(err, ShouldBeNil)
+		So(resp.Acked, ShouldEqual, 0)
+		So(resp.Failed[remote+"/x/0"], ShouldContainSubstring, "127.0.0.1:8815")
+	})
+}
+
+func TestCloseGrpcEntry(t *testing.T) {
+	Convey("Test Close Grpc Entry", t, func() {
+		entrance.Stop()
+		messageQueue = nil
+		storage = nil
+	})
+}
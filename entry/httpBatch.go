@@ -0,0 +1,230 @@
+package entry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	mimeForm      = "application/x-www-form-urlencoded"
+	mimeMultiForm = "multipart/form-data"
+	mimeJson      = "application/json"
+	mimeNdjson    = "application/x-ndjson"
+	mimeMultipart = "multipart/mixed"
+	mimeBinary    = "application/octet-stream"
+)
+
+// BatchMessage is the element of a batch pop or batch confirm response.
+// Data is base64 encoded in JSON so that binary messages are safe.
+type BatchMessage struct {
+	Id    string `json:"id"`
+	Type  string `json:"type,omitempty"`
+	Data  []byte `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func mediaType(req *http.Request) string {
+	ct := req.Header.Get("Content-Type")
+	if ct == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mt
+}
+
+// contentType is the content type of a popped message, which is binary if
+// it was pushed without one.
+func contentType(ct string) string {
+	if ct == "" {
+		return mimeBinary
+	}
+	return ct
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.ContentLength > int64(MaxBodyLength) {
+		return nil, NewError(
+			ErrMessageTooLarge,
+			`body of `+strconv.FormatInt(req.ContentLength, 10)+` bytes is too long`,
+		)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(MaxBodyLength)+1))
+	if err != nil {
+		return nil, NewError(
+			ErrBadRequest,
+			`read body failed: `+err.Error(),
+		)
+	}
+	if len(data) > MaxBodyLength {
+		return nil, NewError(
+			ErrMessageTooLarge,
+			`body is too long`,
+		)
+	}
+	return data, nil
+}
+
+// parseBatch splits a batch push body into messages. A JSON body must be
+// an array: string elements are pushed decoded, others as raw JSON. A
+// NDJSON body is pushed line by line as it is.
+func parseBatch(mt string, body []byte) ([][]byte, error) {
+	datas := make([][]byte, 0)
+	switch mt {
+	case mimeJson:
+		var elems []json.RawMessage
+		err := json.Unmarshal(body, &elems)
+		if err != nil {
+			return nil, NewError(
+				ErrBadRequest,
+				`batch body is not a json array: `+err.Error(),
+			)
+		}
+		for _, elem := range elems {
+			var s string
+			if json.Unmarshal(elem, &s) == nil {
+				datas = append(datas, []byte(s))
+			} else {
+				datas = append(datas, []byte(elem))
+			}
+		}
+	case mimeNdjson:
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 4096), MaxBodyLength)
+		for scanner.Scan() {
+			line := bytes.TrimRight(scanner.Bytes(), "\r")
+			if len(line) == 0 {
+				continue
+			}
+			datas = append(datas, append([]byte(nil), line...))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, NewError(
+				ErrBadRequest,
+				`bad ndjson body: `+err.Error(),
+			)
+		}
+	default:
+		return nil, NewError(
+			ErrBadRequest,
+			`batch push needs content type `+mimeJson+` or `+mimeNdjson,
+		)
+	}
+	if len(datas) == 0 {
+		return nil, NewError(
+			ErrBadRequest,
+			`batch push with no message`,
+		)
+	}
+	return datas, nil
+}
+
+func (h *HttpEntry) multiPop(w http.ResponseWriter, req *http.Request, key string) error {
+	n, err := strconv.Atoi(req.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		return NewError(
+			ErrBadRequest,
+			`n should be a positive integer`,
+		)
+	}
+
+	ids, datas, types, err := h.messageQueue.MultiPopType(key, n)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(req.Header.Get("Accept"), mimeMultipart) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", mimeMultipart+"; boundary="+mw.Boundary())
+		w.WriteHeader(http.StatusOK)
+		for i, id := range ids {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Type", contentType(types[i]))
+			header.Set("X-UQ-ID", id)
+			part, err := mw.CreatePart(header)
+			if err != nil {
+				return nil
+			}
+			part.Write(datas[i])
+		}
+		return mw.Close()
+	}
+
+	msgs := make([]*BatchMessage, len(ids))
+	for i, id := range ids {
+		msgs[i] = &BatchMessage{Id: id, Type: types[i], Data: datas[i]}
+	}
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	w.Header().Set("Content-Type", mimeJson)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return nil
+}
+
+func (h *HttpEntry) multiConfirm(w http.ResponseWriter, req *http.Request) error {
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	err = json.Unmarshal(body, &ids)
+	if err != nil {
+		return NewError(
+			ErrBadRequest,
+			`body is not a json array of ids: `+err.Error(),
+		)
+	}
+
+	// the ids without the consume right are not confirmed
+	rets := make([]*BatchMessage, len(ids))
+	allowed := make([]string, 0, len(ids))
+	indexes := make([]int, 0, len(ids))
+	for i, id := range ids {
+		rets[i] = &BatchMessage{Id: id}
+		err := httpAuthorize(h.access, req, acl.RightConsume, id)
+		if err != nil {
+			rets[i].Error = err.Error()
+			continue
+		}
+		allowed = append(allowed, id)
+		indexes = append(indexes, i)
+	}
+
+	errs := h.messageQueue.MultiConfirm(allowed)
+	for j, i := range indexes {
+		if j < len(errs) && errs[j] != nil {
+			rets[i].Error = errs[j].Error()
+		}
+	}
+	data, err := json.Marshal(rets)
+	if err != nil {
+		return NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	w.Header().Set("Content-Type", mimeJson)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return nil
+}
@@ -1,12 +1,17 @@
 package entry
 
 import (
+	"crypto/tls"
 	"log"
-	"net"
 	"net/http"
+	"net/http/httputil"
 	"strings"
+	"sync"
 
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
 	. "github.com/buaazp/uq/utils"
 )
 
@@ -19,7 +24,16 @@ type HttpEntry struct {
 	host         string
 	port         int
 	adminMux     map[string]func(http.ResponseWriter, *http.Request, string)
+	routesV2     []*routeV2
+	access       *acl.ACL
+	limiter      *limit.Limiter
+	router       *route.Router
+	origins      []string
+	proxies      map[string]*httputil.ReverseProxy
+	proxiesLock  sync.Mutex
 	server       *http.Server
+	tlsConfig    *tls.Config
+	unixPath     string
 	stopListener *StopListener
 	messageQueue queue.MessageQueue
 }
@@ -32,11 +46,13 @@ func NewHttpEntry(host string, port int, messageQueue queue.MessageQueue) (*Http
 		"/empty": h.emptyHandler,
 		"/rm":    h.rmHandler,
 	}
+	h.routesV2 = h.newRoutesV2()
 
 	addr := Addrcat(host, port)
 	server := new(http.Server)
 	server.Addr = addr
 	server.Handler = h
+	server.ConnContext = h.connContext
 
 	h.host = host
 	h.port = port
@@ -46,15 +62,63 @@ func NewHttpEntry(host string, port int, messageQueue queue.MessageQueue) (*Http
 	return h, nil
 }
 
+// SetUnixSocket listens on the unix socket path too. With a zero port it
+// listens on the unix socket only.
+func (h *HttpEntry) SetUnixSocket(path string) {
+	h.unixPath = path
+}
+
+// SetTLSConfig serves the connections over TLS. The config may verify
+// the client certificates too.
+func (h *HttpEntry) SetTLSConfig(config *tls.Config) {
+	h.tlsConfig = config
+}
+
+// SetACL sets the access control of the entry. Clients authenticate with
+// the bearer token in the Authorization header.
+func (h *HttpEntry) SetACL(access *acl.ACL) {
+	h.access = access
+}
+
+// SetLimiter limits the rate of the pushes of every connection, client
+// and topic.
+func (h *HttpEntry) SetLimiter(l *limit.Limiter) {
+	h.limiter = l
+}
+
+// SetRouter routes the requests of the topics owned by other servers,
+// which are redirected by 307 or proxied.
+func (h *HttpEntry) SetRouter(router *route.Router) {
+	h.router = router
+}
+
+// SetOrigins allows the pages of the origins to open the websocket
+// streams, besides the ones served by the same host. "*" allows any.
+func (h *HttpEntry) SetOrigins(origins []string) {
+	h.origins = origins
+}
+
 func (h *HttpEntry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if !AllowMethod(w, req.Method, "HEAD", "GET", "POST", "PUT", "DELETE") {
 		return
 	}
 
+	if h.access != nil {
+		u, err := h.access.AuthenticateRequest(req)
+		if err != nil {
+			writeErrorHttp(w, err)
+			return
+		}
+		req = req.WithContext(acl.NewContext(req.Context(), u))
+	}
+
 	if strings.HasPrefix(req.URL.Path, queuePrefixV1) {
 		key := req.URL.Path[len(queuePrefixV1):]
 		h.queueHandler(w, req, key)
 		return
+	} else if req.URL.Path == prefixV2 || strings.HasPrefix(req.URL.Path, prefixV2+"/") {
+		h.v2Handler(w, req, req.URL.Path[len(prefixV2):])
+		return
 	} else if strings.HasPrefix(req.URL.Path, adminPrefixV1) {
 		key := req.URL.Path[len(adminPrefixV1):]
 		h.adminHandler(w, req, key)
@@ -66,12 +130,28 @@ func (h *HttpEntry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func (h *HttpEntry) queueHandler(w http.ResponseWriter, req *http.Request, key string) {
+	if req.Method == "PUT" {
+		key = req.FormValue("topic") + "/" + req.FormValue("line")
+	}
+	err := httpAuthorize(h.access, req, acl.MethodRight(req.Method), key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+	if h.route(w, req, key) {
+		return
+	}
+
 	switch req.Method {
 	case "PUT":
 		h.addHandler(w, req, key)
 	case "POST":
 		h.pushHandler(w, req, key)
 	case "GET":
+		if isStreamKey(key) {
+			h.streamHandler(w, req, key)
+			return
+		}
 		h.popHandler(w, req, key)
 	case "DELETE":
 		h.delHandler(w, req, key)
@@ -83,8 +163,18 @@ func (h *HttpEntry) queueHandler(w http.ResponseWriter, req *http.Request, key s
 
 func (h *HttpEntry) adminHandler(w http.ResponseWriter, req *http.Request, key string) {
 	for prefix, handler := range h.adminMux {
-		if strings.HasPrefix(key, prefix) {
+		// match on the segment boundary, so that /statx is not /stat
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
 			key = key[len(prefix):]
+			right := acl.RightAdmin
+			if prefix == "/stat" {
+				right = acl.RightConsume
+			}
+			err := httpAuthorize(h.access, req, right, key)
+			if err != nil {
+				writeErrorHttp(w, err)
+				return
+			}
 			handler(w, req, key)
 			return
 		}
@@ -132,44 +222,94 @@ func (h *HttpEntry) addHandler(w http.ResponseWriter, req *http.Request, key str
 }
 
 func (h *HttpEntry) pushHandler(w http.ResponseWriter, req *http.Request, key string) {
-	err := req.ParseForm()
-	if err != nil {
-		writeErrorHttp(w, NewError(
-			ErrInternalError,
-			err.Error(),
-		))
-		return
+	writeErrorHttp(w, h.push(w, req, key))
+}
+
+func (h *HttpEntry) popHandler(w http.ResponseWriter, req *http.Request, key string) {
+	writeErrorHttp(w, h.pop(w, req, key))
+}
+
+func (h *HttpEntry) delHandler(w http.ResponseWriter, req *http.Request, key string) {
+	writeErrorHttp(w, h.confirm(w, req, key))
+}
+
+// push pushes the form field value for form requests for the
+// compatibility. Other bodies are pushed as they are, or split into
+// messages by parseBatch if the batch query is set.
+func (h *HttpEntry) push(w http.ResponseWriter, req *http.Request, key string) error {
+	var datas [][]byte
+	var ct string
+	mt := mediaType(req)
+	if mt == mimeForm || mt == mimeMultiForm {
+		err := req.ParseForm()
+		if err != nil {
+			return NewError(
+				ErrInternalError,
+				err.Error(),
+			)
+		}
+		datas = [][]byte{[]byte(req.FormValue("value"))}
+	} else {
+		data, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		if req.URL.Query().Get("batch") != "" {
+			datas, err = parseBatch(mt, data)
+			if err != nil {
+				return err
+			}
+		} else {
+			datas = [][]byte{data}
+			// a raw body keeps its content type
+			ct = req.Header.Get("Content-Type")
+		}
 	}
 
-	data := []byte(req.FormValue("value"))
-	err = h.messageQueue.Push(key, data)
+	err := httpThrottle(h.limiter, req, key, datas)
 	if err != nil {
-		writeErrorHttp(w, err)
-		return
+		return err
+	}
+	if len(datas) == 1 {
+		err = h.messageQueue.PushType(key, datas[0], ct)
+	} else {
+		err = h.messageQueue.MultiPush(key, datas)
+	}
+	if err != nil {
+		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
-func (h *HttpEntry) popHandler(w http.ResponseWriter, req *http.Request, key string) {
-	id, data, err := h.messageQueue.Pop(key)
+func (h *HttpEntry) pop(w http.ResponseWriter, req *http.Request, key string) error {
+	if req.URL.Query().Get("n") != "" {
+		return h.multiPop(w, req, key)
+	}
+
+	id, data, ct, err := h.messageQueue.PopType(key)
 	if err != nil {
-		writeErrorHttp(w, err)
-		return
+		return err
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Type", contentType(ct))
 	w.Header().Set("X-UQ-ID", id)
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
+	return nil
 }
 
-func (h *HttpEntry) delHandler(w http.ResponseWriter, req *http.Request, key string) {
+func (h *HttpEntry) confirm(w http.ResponseWriter, req *http.Request, key string) error {
+	if mediaType(req) == mimeJson {
+		return h.multiConfirm(w, req)
+	}
+
 	err := h.messageQueue.Confirm(key)
 	if err != nil {
-		writeErrorHttp(w, err)
-		return
+		return err
 	}
 	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 func (h *HttpEntry) statHandler(w http.ResponseWriter, req *http.Request, key string) {
@@ -228,19 +368,18 @@ func (h *HttpEntry) rmHandler(w http.ResponseWriter, req *http.Request, key stri
 }
 
 func (h *HttpEntry) ListenAndServe() error {
-	addr := Addrcat(h.host, h.port)
-	l, err := net.Listen("tcp", addr)
+	ls, err := ListenAll(h.host, h.port, h.unixPath)
 	if err != nil {
 		return err
 	}
 
-	stopListener, err := NewStopListener(l)
+	stopListener, err := NewTLSStopListener(h.tlsConfig, ls...)
 	if err != nil {
 		return err
 	}
 	h.stopListener = stopListener
 
-	log.Printf("http entrance serving at %s...", addr)
+	log.Printf("http entrance serving at %s...", h.stopListener)
 	return h.server.Serve(h.stopListener)
 }
 
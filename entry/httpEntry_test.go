@@ -1,15 +1,22 @@
 package entry
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/buaazp/uq/acl"
 	"github.com/buaazp/uq/queue"
 	"github.com/buaazp/uq/store"
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/websocket"
 )
 
 var (
@@ -129,6 +136,90 @@ func TestHttpConfirm(t *testing.T) {
 	})
 }
 
+func TestHttpBatch(t *testing.T) {
+	Convey("Test Http Binary And Batch Api", t, func() {
+		push := func(url, ct, body string) {
+			req, err := http.NewRequest("POST", url, bytes.NewBufferString(body))
+			So(err, ShouldBeNil)
+			req.Header.Set("Content-Type", ct)
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		}
+
+		raw := "\x00\x01\xff\r\nuq"
+		push("http://127.0.0.1:8801/v1/queues/foo", "image/png", raw)
+		resp, err := client.Get("http://127.0.0.1:8801/v1/queues/foo/x")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "image/png")
+		body, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldEqual, raw)
+		ids := []string{resp.Header.Get("X-UQ-ID")}
+
+		push("http://127.0.0.1:8801/v1/queues/foo?batch=1", "application/json", `["a","b",{"k":1}]`)
+		resp, err = client.Get("http://127.0.0.1:8801/v1/queues/foo/x?n=10")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var msgs []BatchMessage
+		err = json.NewDecoder(resp.Body).Decode(&msgs)
+		So(err, ShouldBeNil)
+		So(len(msgs), ShouldEqual, 3)
+		So(string(msgs[0].Data), ShouldEqual, "a")
+		So(string(msgs[1].Data), ShouldEqual, "b")
+		So(string(msgs[2].Data), ShouldEqual, `{"k":1}`)
+		for _, msg := range msgs {
+			ids = append(ids, msg.Id)
+		}
+
+		push("http://127.0.0.1:8801/v1/queues/foo", "text/plain; charset=utf-8", "hi")
+		push("http://127.0.0.1:8801/v1/queues/foo?batch=1", "application/x-ndjson", "{\"n\":1}\n{\"n\":2}\n")
+		req, err := http.NewRequest("GET", "http://127.0.0.1:8801/v1/queues/foo/x?n=10", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Accept", "multipart/mixed")
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		mt, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		So(err, ShouldBeNil)
+		So(mt, ShouldEqual, "multipart/mixed")
+		mr := multipart.NewReader(resp.Body, params["boundary"])
+		for _, want := range [][2]string{
+			{"hi", "text/plain; charset=utf-8"},
+			{`{"n":1}`, "application/octet-stream"},
+			{`{"n":2}`, "application/octet-stream"},
+		} {
+			part, err := mr.NextPart()
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(part)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, want[0])
+			So(part.Header.Get("Content-Type"), ShouldEqual, want[1])
+			ids = append(ids, part.Header.Get("X-UQ-ID"))
+		}
+
+		ids = append(ids, "foo/x/100")
+		b, err := json.Marshal(ids)
+		So(err, ShouldBeNil)
+		req, err = http.NewRequest("DELETE", "http://127.0.0.1:8801/v1/queues/foo/x", bytes.NewBuffer(b))
+		So(err, ShouldBeNil)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var rets []BatchMessage
+		err = json.NewDecoder(resp.Body).Decode(&rets)
+		So(err, ShouldBeNil)
+		So(len(rets), ShouldEqual, len(ids))
+		for i, ret := range rets[:len(rets)-1] {
+			So(ret.Id, ShouldEqual, ids[i])
+			So(ret.Error, ShouldBeBlank)
+		}
+		So(rets[len(rets)-1].Error, ShouldNotBeBlank)
+	})
+}
+
 func TestHttpStat(t *testing.T) {
 	Convey("Test Http Stat Api", t, func() {
 		req, err := http.NewRequest(
@@ -166,6 +257,117 @@ func TestHttpEmpty(t *testing.T) {
 	})
 }
 
+func TestHttpStream(t *testing.T) {
+	Convey("Test Http Stream Api", t, func() {
+		push := func(v string) {
+			req, err := http.NewRequest(
+				"POST",
+				"http://127.0.0.1:8801/v1/queues/foo",
+				bytes.NewBufferString("value="+v),
+			)
+			So(err, ShouldBeNil)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		}
+
+		push("a")
+		resp, err := client.Get("http://127.0.0.1:8801/v1/queues/foo/x/stream")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+		r := bufio.NewReader(resp.Body)
+		line, err := r.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(strings.HasPrefix(line, "id: foo/x/"), ShouldBeTrue)
+		line, err = r.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "data: YQ==\n")
+		resp.Body.Close()
+		// let the sse stream notice the client has gone
+		time.Sleep(2 * ConsumeInterval)
+
+		push("b")
+		ws, err := websocket.Dial(
+			"ws://127.0.0.1:8801/v1/queues/foo/x/stream",
+			"",
+			"http://evil.example.com/",
+		)
+		So(err, ShouldNotBeNil)
+		ws, err = websocket.Dial(
+			"ws://127.0.0.1:8801/v1/queues/foo/x/stream",
+			"",
+			"http://127.0.0.1:8801/",
+		)
+		So(err, ShouldBeNil)
+		defer ws.Close()
+
+		var msg StreamMessage
+		err = websocket.JSON.Receive(ws, &msg)
+		So(err, ShouldBeNil)
+		So(string(msg.Data), ShouldEqual, "b")
+		So(strings.HasPrefix(msg.Id, "foo/x/"), ShouldBeTrue)
+
+		err = websocket.JSON.Send(ws, StreamConfirm{Confirm: msg.Id})
+		So(err, ShouldBeNil)
+		err = websocket.JSON.Send(ws, StreamConfirm{Confirm: msg.Id})
+		So(err, ShouldBeNil)
+		err = websocket.JSON.Receive(ws, &msg)
+		So(err, ShouldBeNil)
+		So(msg.Error, ShouldNotBeBlank)
+
+		// binary data is kept
+		req, err := http.NewRequest("POST", "http://127.0.0.1:8801/v1/queues/foo", bytes.NewReader([]byte{0xff, 0x00, 0xfe}))
+		So(err, ShouldBeNil)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		err = websocket.JSON.Receive(ws, &msg)
+		So(err, ShouldBeNil)
+		So(msg.Data, ShouldResemble, []byte{0xff, 0x00, 0xfe})
+		err = websocket.JSON.Send(ws, StreamConfirm{Confirm: msg.Id})
+		So(err, ShouldBeNil)
+
+		resp, err = client.Get("http://127.0.0.1:8801/v1/queues/foo/y/stream")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		entrance.(*HttpEntry).SetOrigins([]string{"http://evil.example.com"})
+		defer entrance.(*HttpEntry).SetOrigins(nil)
+		ws2, err := websocket.Dial(
+			"ws://127.0.0.1:8801/v1/queues/foo/x/stream",
+			"",
+			"http://evil.example.com/",
+		)
+		So(err, ShouldBeNil)
+		ws2.Close()
+
+		// the ids confirmed need the consume right of their lines
+		access, err := acl.New([]*acl.User{{
+			Name:  "bob",
+			Token: "b1",
+			Rules: []*acl.Rule{{Topic: "foo", Rights: []string{"consume"}}},
+		}})
+		So(err, ShouldBeNil)
+		entrance.(*HttpEntry).SetACL(access)
+		defer entrance.(*HttpEntry).SetACL(nil)
+		config, err := websocket.NewConfig("ws://127.0.0.1:8801/v1/queues/foo/x/stream", "http://127.0.0.1:8801/")
+		So(err, ShouldBeNil)
+		config.Header.Set("Authorization", "Bearer b1")
+		ws3, err := websocket.DialConfig(config)
+		So(err, ShouldBeNil)
+		err = websocket.JSON.Send(ws3, StreamConfirm{Confirm: "bar/x/0"})
+		So(err, ShouldBeNil)
+		err = websocket.JSON.Receive(ws3, &msg)
+		So(err, ShouldBeNil)
+		So(msg.Id, ShouldEqual, "bar/x/0")
+		So(msg.Error, ShouldContainSubstring, "403")
+		ws3.Close()
+	})
+}
+
 func TestHttpRemove(t *testing.T) {
 	Convey("Test Http Remove Api", t, func() {
 		req, err := http.NewRequest(
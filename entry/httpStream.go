@@ -0,0 +1,190 @@
+package entry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/buaazp/uq/acl"
+	. "github.com/buaazp/uq/utils"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	streamSuffix = "/stream"
+)
+
+// StreamMessage is the frame sent to the websocket clients, with the
+// data in base64 so that binary messages are safe. A client confirms a
+// message by sending a StreamConfirm frame with its id back on the same
+// connection.
+type StreamMessage struct {
+	Id    string `json:"id,omitempty"`
+	Data  []byte `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type StreamConfirm struct {
+	Confirm string `json:"confirm"`
+}
+
+func isStreamKey(key string) bool {
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	return len(parts) == 3 && "/"+parts[2] == streamSuffix
+}
+
+// streamHandler serves GET /v1/queues/<topic>/<line>/stream. A request with
+// websocket upgrade headers is served over websocket, otherwise the
+// messages are sent as server-sent events.
+func (h *HttpEntry) streamHandler(w http.ResponseWriter, req *http.Request, key string) {
+	key = strings.TrimSuffix(strings.TrimRight(key, "/"), streamSuffix)
+	if len(key) > MaxKeyLength {
+		writeErrorHttp(w, NewError(
+			ErrBadKey,
+			`key is too long`,
+		))
+		return
+	}
+	// fail fast if the line does not exist
+	_, err := h.messageQueue.Stat(key)
+	if err != nil {
+		writeErrorHttp(w, err)
+		return
+	}
+
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		server := websocket.Server{
+			Handshake: h.checkOrigin,
+			Handler: func(ws *websocket.Conn) {
+				h.streamWebsocket(ws, key)
+			},
+		}
+		server.ServeHTTP(w, req)
+		return
+	}
+	h.streamSSE(w, req, key)
+}
+
+// checkOrigin refuses the websocket handshakes from the pages of other
+// sites, which would pop with the credentials of the browser. The
+// non-browser consumers do not send Origin.
+func (h *HttpEntry) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, req.Host) {
+		return nil
+	}
+	for _, allowed := range h.origins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), strings.TrimRight(origin, "/")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// streamPop pops the next message of a line. When the line is blank it
+// polls the line again after ConsumeInterval until done is closed.
+func (h *HttpEntry) streamPop(key string, done <-chan struct{}) (string, []byte, error) {
+	for {
+		id, data, err := h.messageQueue.Pop(key)
+		if err == nil || errorCode(err) != ErrNone {
+			return id, data, err
+		}
+		select {
+		case <-done:
+			return "", nil, err
+		case <-time.After(ConsumeInterval):
+		}
+	}
+}
+
+func (h *HttpEntry) streamSSE(w http.ResponseWriter, req *http.Request, key string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorHttp(w, NewError(
+			ErrInternalError,
+			`streaming unsupported`,
+		))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	done := req.Context().Done()
+	for {
+		id, data, err := h.streamPop(key, done)
+		if err != nil {
+			if errorCode(err) != ErrNone {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+				flusher.Flush()
+			}
+			return
+		}
+
+		// in base64, which is binary safe and has no line break
+		_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, base64.StdEncoding.EncodeToString(data))
+		if err != nil {
+			// unsent messages will be recycled if the line has recycle
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// streamConfirm confirms the id sent by a websocket client, which may be
+// of any line, so it is authorized and routed like a DELETE.
+func (h *HttpEntry) streamConfirm(req *http.Request, id string) error {
+	err := httpAuthorize(h.access, req, acl.RightConsume, id)
+	if err != nil {
+		return err
+	}
+	if owner := h.router.Owner(id); owner != "" {
+		return movedError(owner)
+	}
+	return h.messageQueue.Confirm(id)
+}
+
+func (h *HttpEntry) streamWebsocket(ws *websocket.Conn, key string) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var c StreamConfirm
+			err := websocket.JSON.Receive(ws, &c)
+			if err != nil {
+				return
+			}
+			msg := StreamMessage{Id: c.Confirm}
+			err = h.streamConfirm(ws.Request(), c.Confirm)
+			if err != nil {
+				msg.Error = err.Error()
+				websocket.JSON.Send(ws, msg)
+			}
+		}
+	}()
+
+	defer ws.Close()
+	for {
+		id, data, err := h.streamPop(key, done)
+		if err != nil {
+			if errorCode(err) != ErrNone {
+				websocket.JSON.Send(ws, StreamMessage{Error: err.Error()})
+			}
+			return
+		}
+
+		err = websocket.JSON.Send(ws, StreamMessage{Id: id, Data: data})
+		if err != nil {
+			return
+		}
+	}
+}
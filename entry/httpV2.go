@@ -0,0 +1,348 @@
+package entry
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	prefixV2 = "/v2"
+)
+
+// routeV2 is a route of the v2 api. The segments of pattern in braces are
+// path parameters. The openapi document is generated from the routes, so
+// summary, query and status describe the route for it. A route with a
+// zero right is public.
+type routeV2 struct {
+	method  string
+	pattern string
+	summary string
+	query   []string
+	status  int
+	right   acl.Right
+	handler func(http.ResponseWriter, *http.Request, map[string]string) error
+}
+
+func (h *HttpEntry) newRoutesV2() []*routeV2 {
+	return []*routeV2{
+		{"GET", "/topics", "list the topics", nil, http.StatusOK, acl.RightAdmin, h.listTopicsV2},
+		{"PUT", "/topics/{topic}", "create a topic", []string{"max-messages", "max-bytes", "policy", "max-message-size", "compression"}, http.StatusCreated, acl.RightAdmin, h.createV2},
+		{"GET", "/topics/{topic}", "get the stat of a topic", nil, http.StatusOK, acl.RightConsume, h.statV2},
+		{"DELETE", "/topics/{topic}", "remove a topic", nil, http.StatusNoContent, acl.RightAdmin, h.removeV2},
+		{"POST", "/topics/{topic}/messages", "push messages into a topic", []string{"batch"}, http.StatusNoContent, acl.RightProduce, h.pushV2},
+		{"DELETE", "/topics/{topic}/messages", "empty a topic", nil, http.StatusNoContent, acl.RightAdmin, h.emptyV2},
+		{"PUT", "/topics/{topic}/lines/{line}", "create a line", []string{"recycle"}, http.StatusCreated, acl.RightAdmin, h.createV2},
+		{"GET", "/topics/{topic}/lines/{line}", "get the stat of a line", nil, http.StatusOK, acl.RightConsume, h.statV2},
+		{"DELETE", "/topics/{topic}/lines/{line}", "remove a line", nil, http.StatusNoContent, acl.RightAdmin, h.removeV2},
+		{"GET", "/topics/{topic}/lines/{line}/messages", "pop messages from a line", []string{"n"}, http.StatusOK, acl.RightConsume, h.popV2},
+		{"DELETE", "/topics/{topic}/lines/{line}/messages", "empty a line", nil, http.StatusNoContent, acl.RightAdmin, h.emptyV2},
+		{"DELETE", "/topics/{topic}/lines/{line}/messages/{id}", "confirm a message", nil, http.StatusNoContent, acl.RightConsume, h.confirmV2},
+		{"GET", "/openapi.json", "get this document", nil, http.StatusOK, 0, h.openapiV2},
+	}
+}
+
+// match returns the path parameters if the path matches the pattern.
+func (r *routeV2) match(path string) (map[string]string, bool) {
+	pattern := strings.Split(strings.Trim(r.pattern, "/"), "/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pattern) != len(parts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, seg := range pattern {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = parts[i]
+			continue
+		}
+		if seg != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+var errorStatusV2 = map[int]int{
+	ErrNone:             http.StatusNoContent,
+	ErrTopicNotExisted:  http.StatusNotFound,
+	ErrLineNotExisted:   http.StatusNotFound,
+	ErrNotDelivered:     http.StatusNotFound,
+	ErrBadKey:           http.StatusBadRequest,
+	ErrTopicExisted:     http.StatusConflict,
+	ErrLineExisted:      http.StatusConflict,
+	ErrTopicFull:        http.StatusInsufficientStorage,
+	ErrMoved:            http.StatusTemporaryRedirect,
+	ErrDraining:         http.StatusServiceUnavailable,
+	ErrCrossOwner:       http.StatusBadRequest,
+	ErrMessageTooLarge:  http.StatusRequestEntityTooLarge,
+	ErrBadRequest:       http.StatusBadRequest,
+	ErrUnauthorized:     http.StatusUnauthorized,
+	ErrForbidden:        http.StatusForbidden,
+	ErrNotFound:         http.StatusNotFound,
+	ErrMethodNotAllowed: http.StatusMethodNotAllowed,
+	ErrTooManyRequests:  http.StatusTooManyRequests,
+	ErrInternalError:    http.StatusInternalServerError,
+}
+
+// writeErrorHttpV2 writes the error as a JSON body of utils.Error. Unlike
+// v1, an existed topic or line is a conflict and a blank line is not an
+// error but an empty response.
+func writeErrorHttpV2(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		e = NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+
+	status, ok := errorStatusV2[e.ErrorCode]
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	data, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", mimeJson)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeJsonV2(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	w.Header().Set("Content-Type", mimeJson)
+	w.WriteHeader(status)
+	w.Write(data)
+	return nil
+}
+
+func paramsKey(params map[string]string) string {
+	key := params["topic"]
+	if line, ok := params["line"]; ok {
+		key += "/" + line
+	}
+	if id, ok := params["id"]; ok {
+		key += "/" + id
+	}
+	return key
+}
+
+func (h *HttpEntry) v2Handler(w http.ResponseWriter, req *http.Request, path string) {
+	allowed := make([]string, 0)
+	for _, route := range h.routesV2 {
+		params, ok := route.match(path)
+		if !ok {
+			continue
+		}
+		if route.method != req.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		if route.right != 0 {
+			err := httpAuthorize(h.access, req, route.right, paramsKey(params))
+			if err != nil {
+				writeErrorHttpV2(w, err)
+				return
+			}
+		}
+		if h.route(w, req, paramsKey(params)) {
+			return
+		}
+		writeErrorHttpV2(w, route.handler(w, req, params))
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeErrorHttpV2(w, NewError(
+			ErrMethodNotAllowed,
+			req.Method+" "+prefixV2+path,
+		))
+		return
+	}
+	writeErrorHttpV2(w, NewError(
+		ErrNotFound,
+		prefixV2+path,
+	))
+}
+
+func (h *HttpEntry) listTopicsV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	return writeJsonV2(w, http.StatusOK, h.messageQueue.Topics())
+}
+
+func (h *HttpEntry) createV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	key := paramsKey(params)
+	query := req.URL.Query()
+	rec := query.Get("recycle")
+	if params["line"] == "" {
+		// the options of a topic
+		opts := make([]string, 0, 5)
+		for _, name := range []string{"max-messages", "max-bytes", "policy", "max-message-size", "compression"} {
+			if v := query.Get(name); v != "" {
+				opts = append(opts, name+"="+v)
+			}
+		}
+		rec = strings.Join(opts, ",")
+	}
+	err := h.messageQueue.Create(key, rec)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", req.URL.Path)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (h *HttpEntry) statV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	qs, err := h.messageQueue.Stat(paramsKey(params))
+	if err != nil {
+		return err
+	}
+	return writeJsonV2(w, http.StatusOK, qs)
+}
+
+func (h *HttpEntry) removeV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	err := h.messageQueue.Remove(paramsKey(params))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *HttpEntry) emptyV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	err := h.messageQueue.Empty(paramsKey(params))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *HttpEntry) pushV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	return h.push(w, req, paramsKey(params))
+}
+
+func (h *HttpEntry) popV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	return h.pop(w, req, paramsKey(params))
+}
+
+func (h *HttpEntry) confirmV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	err := h.messageQueue.Confirm(paramsKey(params))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *HttpEntry) openapiV2(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	return writeJsonV2(w, http.StatusOK, openapiV2(h.routesV2))
+}
+
+// openapiV2 generates the openapi document of the routes.
+func openapiV2(routes []*routeV2) map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		parameters := make([]interface{}, 0)
+		for _, seg := range strings.Split(route.pattern, "/") {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     seg[1 : len(seg)-1],
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]string{"type": "string"},
+				})
+			}
+		}
+		query := append([]string(nil), route.query...)
+		sort.Strings(query)
+		for _, q := range query {
+			parameters = append(parameters, map[string]interface{}{
+				"name":   q,
+				"in":     "query",
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+
+		op := map[string]interface{}{
+			"summary":     route.summary,
+			"operationId": operationId(route),
+			"parameters":  parameters,
+			"responses": map[string]interface{}{
+				strconv.Itoa(route.status): map[string]string{
+					"description": http.StatusText(route.status),
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{
+						mimeJson: map[string]interface{}{
+							"schema": map[string]string{"$ref": "#/components/schemas/Error"},
+						},
+					},
+				},
+			},
+		}
+		if _, ok := paths[prefixV2+route.pattern]; !ok {
+			paths[prefixV2+route.pattern] = make(map[string]interface{})
+		}
+		paths[prefixV2+route.pattern][strings.ToLower(route.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "uq",
+			"version": "2",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"errorCode": map[string]string{"type": "integer"},
+						"message":   map[string]string{"type": "string"},
+						"cause":     map[string]string{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// operationId names a route by its method and segments, such as
+// deleteTopicsTopicLinesLine.
+func operationId(route *routeV2) string {
+	name := strings.ToLower(route.method)
+	for _, seg := range strings.Split(route.pattern, "/") {
+		seg = strings.Trim(seg, "{}")
+		seg = strings.TrimSuffix(seg, ".json")
+		if seg == "" {
+			continue
+		}
+		name += strings.ToUpper(seg[:1]) + seg[1:]
+	}
+	return name
+}
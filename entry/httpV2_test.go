@@ -0,0 +1,302 @@
+package entry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
+	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
+	"github.com/buaazp/uq/store"
+	. "github.com/buaazp/uq/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func doV2(method, path string, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(
+		method,
+		"http://127.0.0.1:8806"+path,
+		bytes.NewBuffer(body),
+	)
+	So(err, ShouldBeNil)
+	resp, err := client.Do(req)
+	So(err, ShouldBeNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	So(err, ShouldBeNil)
+	resp.Body.Close()
+	return resp, data
+}
+
+func TestNewHttpV2Entry(t *testing.T) {
+	Convey("Test New HTTP V2 Entry", t, func() {
+		var err error
+		storage, err = store.NewMemStore()
+		So(err, ShouldBeNil)
+		So(storage, ShouldNotBeNil)
+		messageQueue, err = queue.NewUnitedQueue(storage, "127.0.0.1", 8806, nil, "uq")
+		So(err, ShouldBeNil)
+		So(messageQueue, ShouldNotBeNil)
+
+		entrance, err = NewHttpEntry("0.0.0.0", 8806, messageQueue)
+		So(err, ShouldBeNil)
+		So(entrance, ShouldNotBeNil)
+
+		go func() {
+			entrance.ListenAndServe()
+		}()
+	})
+}
+
+func TestHttpV2Resources(t *testing.T) {
+	Convey("Test Http V2 Resources", t, func() {
+		resp, _ := doV2("PUT", "/v2/topics/foo", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		So(resp.Header.Get("Location"), ShouldEqual, "/v2/topics/foo")
+		resp, _ = doV2("PUT", "/v2/topics/foo/lines/x?recycle=10s", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+
+		resp, data := doV2("PUT", "/v2/topics/foo", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		var e Error
+		err := json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrTopicExisted)
+
+		resp, data = doV2("GET", "/v2/topics", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(string(data), ShouldEqual, `["foo"]`)
+
+		resp, data = doV2("GET", "/v2/topics/foo/lines/x", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var qs queue.QueueStat
+		err = json.Unmarshal(data, &qs)
+		So(err, ShouldBeNil)
+		So(qs.Name, ShouldEqual, "foo/x")
+	})
+}
+
+func TestHttpV2Messages(t *testing.T) {
+	Convey("Test Http V2 Messages", t, func() {
+		resp, _ := doV2("GET", "/v2/topics/foo/lines/x/messages", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+
+		resp, _ = doV2("POST", "/v2/topics/foo/messages", []byte("bar"))
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+
+		resp, data := doV2("GET", "/v2/topics/foo/lines/x/messages", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(string(data), ShouldEqual, "bar")
+		id := resp.Header.Get("X-UQ-ID")
+		So(id, ShouldEqual, "foo/x/0")
+
+		resp, _ = doV2("DELETE", "/v2/topics/foo/lines/x/messages/0", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, _ = doV2("DELETE", "/v2/topics/foo/lines/x/messages/0", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		resp, _ = doV2("DELETE", "/v2/topics/foo/lines/x/messages", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, _ = doV2("DELETE", "/v2/topics/foo/lines/x", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, _ = doV2("DELETE", "/v2/topics/foo/lines/x", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestHttpV2Routes(t *testing.T) {
+	Convey("Test Http V2 Routes", t, func() {
+		resp, data := doV2("POST", "/v2/topics/foo", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+		So(resp.Header.Get("Allow"), ShouldEqual, "PUT, GET, DELETE")
+		var e Error
+		err := json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrMethodNotAllowed)
+
+		resp, _ = doV2("GET", "/v2/topics/foo/bar", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		// v1 admin routes are matched on the segment boundary
+		resp, _ = doV2("GET", "/v1/admin/statx/foo", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		resp, data = doV2("GET", "/v2/openapi.json", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var doc struct {
+			Openapi string                                       `json:"openapi"`
+			Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+		}
+		err = json.Unmarshal(data, &doc)
+		So(err, ShouldBeNil)
+		So(doc.Openapi, ShouldEqual, "3.0.3")
+		op, ok := doc.Paths["/v2/topics/{topic}/lines/{line}/messages/{id}"]["delete"]
+		So(ok, ShouldBeTrue)
+		So(op["operationId"], ShouldEqual, "deleteTopicsTopicLinesLineMessagesId")
+	})
+}
+
+func TestHttpV2Auth(t *testing.T) {
+	Convey("Test Http V2 Auth", t, func() {
+		access, err := acl.New([]*acl.User{{
+			Name:  "alice",
+			Token: "a1",
+			Rules: []*acl.Rule{{Topic: "foo", Rights: []string{"admin"}}},
+		}})
+		So(err, ShouldBeNil)
+		entrance.(*HttpEntry).SetACL(access)
+		defer entrance.(*HttpEntry).SetACL(nil)
+
+		resp, data := doV2("PUT", "/v2/topics/foo", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		var e Error
+		err = json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrUnauthorized)
+
+		req, err := http.NewRequest("PUT", "http://127.0.0.1:8806/v2/topics/bar", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Authorization", "Bearer a1")
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+
+		req, err = http.NewRequest("DELETE", "http://127.0.0.1:8806/v2/topics/foo", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Authorization", "Bearer a1")
+		resp, err = client.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+
+		resp, _ = doV2("GET", "/v2/openapi.json", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestHttpV2Limit(t *testing.T) {
+	Convey("Test Http V2 Rate Limit", t, func() {
+		l := limit.New(limit.Rate{}, limit.Rate{}, limit.Rate{Messages: 1})
+		entrance.(*HttpEntry).SetLimiter(l)
+		defer entrance.(*HttpEntry).SetLimiter(nil)
+		messageQueue.Create("limited", "")
+
+		resp, _ := doV2("POST", "/v2/topics/limited/messages", []byte("1"))
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, data := doV2("POST", "/v2/topics/limited/messages", []byte("2"))
+		So(resp.StatusCode, ShouldEqual, http.StatusTooManyRequests)
+		var e Error
+		err := json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrTooManyRequests)
+
+		qs, err := limit.NewQueue(messageQueue, l).Stat("limited")
+		So(err, ShouldBeNil)
+		So(qs.Throttled, ShouldEqual, 1)
+	})
+}
+
+func TestHttpV2Capacity(t *testing.T) {
+	Convey("Test Http V2 Topic Capacity", t, func() {
+		resp, _ := doV2("PUT", "/v2/topics/capped?max-messages=1&policy=reject", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		resp, _ = doV2("PUT", "/v2/topics/bad?policy=wait", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+		resp, _ = doV2("POST", "/v2/topics/capped/messages", []byte("1"))
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+		resp, data := doV2("POST", "/v2/topics/capped/messages", []byte("2"))
+		So(resp.StatusCode, ShouldEqual, http.StatusInsufficientStorage)
+		var e Error
+		err := json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrTopicFull)
+
+		resp, data = doV2("GET", "/v2/topics/capped", nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var qs queue.QueueStat
+		err = json.Unmarshal(data, &qs)
+		So(err, ShouldBeNil)
+		So(qs.MaxMessages, ShouldEqual, 1)
+		So(qs.Fill, ShouldEqual, "100.0%")
+	})
+}
+
+func TestHttpV2MaxBodyLength(t *testing.T) {
+	Convey("Test Http V2 Max Body Length", t, func() {
+		MaxBodyLength = 4
+		defer func() { MaxBodyLength = 10 * 1024 * 1024 }()
+
+		resp, data := doV2("POST", "/v2/topics/capped/messages", []byte("12345"))
+		So(resp.StatusCode, ShouldEqual, http.StatusRequestEntityTooLarge)
+		var e Error
+		err := json.Unmarshal(data, &e)
+		So(err, ShouldBeNil)
+		So(e.ErrorCode, ShouldEqual, ErrMessageTooLarge)
+	})
+}
+
+func TestHttpV2Route(t *testing.T) {
+	Convey("Test Http V2 Route", t, func() {
+		var hop string
+		owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			hop = req.Header.Get(ProxiedHeader)
+			data, _ := ioutil.ReadAll(req.Body)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(req.Method + " " + req.URL.Path + " " + string(data)))
+		}))
+		defer owner.Close()
+		ownerAddr := strings.TrimPrefix(owner.URL, "http://")
+
+		r, local, remote := newTestRouter("127.0.0.1:8806", ownerAddr, route.ModeRedirect)
+		entrance.(*HttpEntry).SetRouter(r)
+		defer entrance.(*HttpEntry).SetRouter(nil)
+
+		resp, _ := doV2("PUT", "/v2/topics/"+local, nil)
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		// the redirect is followed by the client
+		resp, data := doV2("POST", "/v2/topics/"+remote+"/messages", []byte("1"))
+		So(resp.StatusCode, ShouldEqual, http.StatusAccepted)
+		So(string(data), ShouldEqual, "POST /v2/topics/"+remote+"/messages 1")
+
+		noRedirect := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := noRedirect.Get("http://127.0.0.1:8806/v2/topics/" + remote)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusTemporaryRedirect)
+		So(resp.Header.Get("Location"), ShouldEqual, owner.URL+"/v2/topics/"+remote)
+
+		r, _, remote = newTestRouter("127.0.0.1:8806", ownerAddr, route.ModeProxy)
+		entrance.(*HttpEntry).SetRouter(r)
+		resp, err = noRedirect.Post("http://127.0.0.1:8806/v2/topics/"+remote+"/messages", mimeJson, strings.NewReader("2"))
+		So(err, ShouldBeNil)
+		data, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusAccepted)
+		So(string(data), ShouldEqual, "POST /v2/topics/"+remote+"/messages 2")
+		So(hop, ShouldEqual, "1")
+
+		// a proxied request is redirected, not proxied again
+		req, err := http.NewRequest("GET", "http://127.0.0.1:8806/v2/topics/"+remote, nil)
+		So(err, ShouldBeNil)
+		req.Header.Set(ProxiedHeader, "1")
+		resp, err = noRedirect.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusTemporaryRedirect)
+	})
+}
+
+func TestCloseHttpV2Entry(t *testing.T) {
+	Convey("Test Close Http V2 Entry", t, func() {
+		entrance.Stop()
+		messageQueue = nil
+		storage = nil
+	})
+}
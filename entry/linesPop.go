@@ -0,0 +1,70 @@
+package entry
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+)
+
+type lineMessage struct {
+	line string
+	id   string
+	data []byte
+}
+
+func isLineKey(key string) bool {
+	return strings.Count(strings.Trim(key, "/"), "/") == 1
+}
+
+// popLines pops at most one message from each line in a single request.
+// The lines are visited from a rotating offset, so that the lines in the
+// front of the request are not always served first. Empty lines are
+// skipped; an error is returned only if no message is available at all.
+func popLines(messageQueue queue.MessageQueue, keys []string, rotation *uint64) ([]*lineMessage, error) {
+	n := len(keys)
+	if n == 0 {
+		return nil, NewError(
+			ErrBadKey,
+			`pop lines with no key`,
+		)
+	}
+
+	offset := int(atomic.AddUint64(rotation, 1) % uint64(n))
+	msgs := make([]*lineMessage, 0, n)
+	var lastErr error
+	for i := 0; i < n; i++ {
+		key := keys[(offset+i)%n]
+		if len(key) > MaxKeyLength {
+			return nil, NewError(
+				ErrBadKey,
+				`key is too long`,
+			)
+		}
+
+		id, data, err := messageQueue.Pop(key)
+		if err != nil {
+			if errorCode(err) != ErrNone {
+				lastErr = err
+			}
+			continue
+		}
+		msg := new(lineMessage)
+		msg.line = strings.Trim(key, "/")
+		msg.id = id
+		msg.data = data
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) > 0 {
+		return msgs, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, NewError(
+		ErrNone,
+		`pop lines`,
+	)
+}
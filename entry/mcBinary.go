@@ -0,0 +1,322 @@
+package entry
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
+	. "github.com/buaazp/uq/utils"
+)
+
+// memcached binary protocol
+// https://github.com/memcached/memcached/wiki/BinaryProtocolRevamped
+const (
+	binMagicRequest  byte = 0x80
+	binMagicResponse byte = 0x81
+	binHeaderLength  int  = 24
+)
+
+const (
+	binOpGet     byte = 0x00
+	binOpSet     byte = 0x01
+	binOpAdd     byte = 0x02
+	binOpDelete  byte = 0x04
+	binOpQuit    byte = 0x07
+	binOpGetQ    byte = 0x09
+	binOpNoop    byte = 0x0a
+	binOpVersion byte = 0x0b
+	binOpGetK    byte = 0x0c
+	binOpGetKQ   byte = 0x0d
+	binOpStat    byte = 0x10
+	binOpSetQ    byte = 0x11
+	binOpAddQ    byte = 0x12
+	binOpDeleteQ byte = 0x14
+	binOpQuitQ   byte = 0x17
+
+	binOpSaslList byte = 0x20
+	binOpSaslAuth byte = 0x21
+)
+
+const (
+	binStatusOK             uint16 = 0x0000
+	binStatusKeyNotFound    uint16 = 0x0001
+	binStatusKeyExists      uint16 = 0x0002
+	binStatusValueTooLarge  uint16 = 0x0003
+	binStatusInvalidArgs    uint16 = 0x0004
+	binStatusNotMyVbucket   uint16 = 0x0007
+	binStatusAuthError      uint16 = 0x0020
+	binStatusUnknownCommand uint16 = 0x0081
+	binStatusInternalError  uint16 = 0x0084
+	binStatusBusy           uint16 = 0x0085
+)
+
+type binRequest struct {
+	opcode byte
+	opaque uint32
+	extras []byte
+	key    string
+	value  []byte
+}
+
+type binResponse struct {
+	opcode byte
+	status uint16
+	opaque uint32
+	extras []byte
+	key    string
+	value  []byte
+}
+
+func readBinRequest(b *bufio.Reader) (*binRequest, error) {
+	header := make([]byte, binHeaderLength)
+	_, err := io.ReadFull(b, header)
+	if err != nil {
+		return nil, err
+	}
+	if header[0] != binMagicRequest {
+		return nil, NewError(
+			ErrBadRequest,
+			`bad magic of binary request`,
+		)
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(header[2:4]))
+	extrasLen := int(header[4])
+	bodyLen := int(binary.BigEndian.Uint32(header[8:12]))
+	if keyLen+extrasLen > bodyLen || keyLen > MaxKeyLength {
+		return nil, NewError(
+			ErrBadRequest,
+			`bad length of binary request`,
+		)
+	}
+
+	req := new(binRequest)
+	req.opcode = header[1]
+	req.opaque = binary.BigEndian.Uint32(header[12:16])
+	body, err := ReadBody(b, bodyLen, MaxBodyLength+keyLen+extrasLen)
+	if err != nil {
+		// the request of a too large value is still answered
+		return req, err
+	}
+	req.extras = body[:extrasLen]
+	req.key = string(body[extrasLen : extrasLen+keyLen])
+	req.value = body[extrasLen+keyLen:]
+	return req, nil
+}
+
+func (r *binResponse) Write(w io.Writer) error {
+	header := make([]byte, binHeaderLength)
+	header[0] = binMagicResponse
+	header[1] = r.opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(r.key)))
+	header[4] = byte(len(r.extras))
+	binary.BigEndian.PutUint16(header[6:8], r.status)
+	bodyLen := len(r.extras) + len(r.key) + len(r.value)
+	binary.BigEndian.PutUint32(header[8:12], uint32(bodyLen))
+	binary.BigEndian.PutUint32(header[12:16], r.opaque)
+
+	if e := WriteFull(w, header); e != nil {
+		return e
+	}
+	if e := WriteFull(w, r.extras); e != nil {
+		return e
+	}
+	if e := WriteFull(w, []byte(r.key)); e != nil {
+		return e
+	}
+	return WriteFull(w, r.value)
+}
+
+func binStatus(err error) uint16 {
+	switch errorCode(err) {
+	case ErrNone, ErrTopicNotExisted, ErrLineNotExisted, ErrNotDelivered:
+		return binStatusKeyNotFound
+	case ErrTopicExisted, ErrLineExisted:
+		return binStatusKeyExists
+	case ErrBadKey, ErrBadRequest, ErrCrossOwner:
+		return binStatusInvalidArgs
+	case ErrTooManyRequests, ErrTopicFull, ErrDraining:
+		return binStatusBusy
+	case ErrMessageTooLarge:
+		return binStatusValueTooLarge
+	case ErrMoved:
+		return binStatusNotMyVbucket
+	}
+	return binStatusInternalError
+}
+
+func binErrorResponse(resp *binResponse, err error) {
+	resp.status = binStatus(err)
+	resp.extras = nil
+	resp.key = ""
+	resp.value = []byte(err.Error())
+}
+
+// processBinary serves a binary request. Quiet commands only reply on
+// errors (and GetQ/GetKQ also skip misses). GetK/GetKQ return the message
+// id in the key field which is needed to confirm the message.
+func (m *McEntry) processBinary(req *binRequest) (resps []*binResponse, quit bool) {
+	resp := new(binResponse)
+	resp.opcode = req.opcode
+	resp.opaque = req.opaque
+	resps = []*binResponse{resp}
+	quiet := false
+
+	if len(req.key) > MaxKeyLength {
+		binErrorResponse(resp, NewError(
+			ErrBadKey,
+			`key is too long`,
+		))
+		return
+	}
+
+	switch req.opcode {
+	case binOpGet, binOpGetQ, binOpGetK, binOpGetKQ:
+		quiet = req.opcode == binOpGetQ || req.opcode == binOpGetKQ
+		id, data, err := m.messageQueue.Pop(req.key)
+		if err != nil {
+			if quiet && errorCode(err) == ErrNone {
+				return nil, false
+			}
+			binErrorResponse(resp, err)
+			return
+		}
+		resp.extras = make([]byte, 4)
+		if req.opcode == binOpGetK || req.opcode == binOpGetKQ {
+			resp.key = id
+		}
+		resp.value = data
+		// a hit of quiet get still needs a reply
+		return
+
+	case binOpSet, binOpSetQ:
+		quiet = req.opcode == binOpSetQ
+		err := m.messageQueue.Push(req.key, req.value)
+		if err != nil {
+			binErrorResponse(resp, err)
+			return
+		}
+
+	case binOpAdd, binOpAddQ:
+		quiet = req.opcode == binOpAddQ
+		err := m.messageQueue.Create(req.key, string(req.value))
+		if err != nil {
+			binErrorResponse(resp, err)
+			return
+		}
+
+	case binOpDelete, binOpDeleteQ:
+		quiet = req.opcode == binOpDeleteQ
+		err := m.messageQueue.Confirm(req.key)
+		if err != nil {
+			binErrorResponse(resp, err)
+			return
+		}
+
+	case binOpStat:
+		resps = make([]*binResponse, 0)
+		if req.key != "" {
+			qs, err := m.messageQueue.Stat(req.key)
+			if err != nil {
+				binErrorResponse(resp, err)
+				return []*binResponse{resp}, false
+			}
+			for _, stat := range qs.ToStrings() {
+				kv := strings.SplitN(stat, ":", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				one := new(binResponse)
+				one.opcode = req.opcode
+				one.opaque = req.opaque
+				one.key = kv[0]
+				one.value = []byte(kv[1])
+				resps = append(resps, one)
+			}
+		}
+		// an empty stat packet terminates the stats
+		resps = append(resps, resp)
+
+	case binOpNoop:
+
+	case binOpVersion:
+		resp.value = []byte(McVersion)
+
+	case binOpQuit:
+		quit = true
+
+	case binOpQuitQ:
+		return nil, true
+
+	default:
+		resp.status = binStatusUnknownCommand
+		resp.value = []byte("unknow command")
+	}
+
+	if quiet {
+		return nil, quit
+	}
+	return
+}
+
+func (m *McEntry) handlerBinary(rbuf *bufio.Reader, wbuf *bufio.Writer, limitConn *limit.Conn) {
+	var user *acl.User
+	for {
+		req, err := readBinRequest(rbuf)
+		if errorCode(err) == ErrMessageTooLarge {
+			resp := &binResponse{opcode: req.opcode, opaque: req.opaque}
+			binErrorResponse(resp, err)
+			resp.Write(wbuf)
+			wbuf.Flush()
+			continue
+		}
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				resp := new(binResponse)
+				binErrorResponse(resp, e)
+				resp.Write(wbuf)
+				wbuf.Flush()
+			}
+			// the stream is out of sync, give it up
+			break
+		}
+
+		var resps []*binResponse
+		quit := false
+		if req.opcode == binOpSaslList || req.opcode == binOpSaslAuth {
+			resp := &binResponse{opcode: req.opcode, opaque: req.opaque}
+			if u := m.binAuthenticate(req, resp); u != nil {
+				user = u
+			}
+			resps = []*binResponse{resp}
+		} else if m.access != nil {
+			err = authorizeKeys(m.access, user, binRightKeys(req))
+		}
+		if err != nil {
+			resp := &binResponse{opcode: req.opcode, opaque: req.opaque}
+			resp.status = binStatusAuthError
+			resp.value = []byte(err.Error())
+			resps = []*binResponse{resp}
+		} else if err := m.routeBinary(req); err != nil {
+			resp := &binResponse{opcode: req.opcode, opaque: req.opaque}
+			binErrorResponse(resp, err)
+			resps = []*binResponse{resp}
+		} else if err := throttle(m.limiter, limitConn, user, binPushed(req)); err != nil {
+			resp := &binResponse{opcode: req.opcode, opaque: req.opaque}
+			binErrorResponse(resp, err)
+			resps = []*binResponse{resp}
+		} else if resps == nil {
+			resps, quit = m.processBinary(req)
+		}
+		for _, resp := range resps {
+			resp.Write(wbuf)
+		}
+		wbuf.Flush()
+		if quit {
+			break
+		}
+	}
+}
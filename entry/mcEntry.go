@@ -2,24 +2,35 @@ package entry
 
 import (
 	"bufio"
-	"io"
+	"crypto/tls"
 	"log"
 	"net"
 	"strconv"
 	"strings"
 
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
 	. "github.com/buaazp/uq/utils"
 )
 
 type McEntry struct {
 	host         string
 	port         int
+	mcq          bool
+	rotation     uint64
+	access       *acl.ACL
+	limiter      *limit.Limiter
+	router       *route.Router
+	tlsConfig    *tls.Config
+	unixPath     string
 	stopListener *StopListener
 	messageQueue queue.MessageQueue
 }
 
 type Item struct {
+	Key     string
 	Flag    int
 	Exptime int
 	Cas     int
@@ -31,6 +42,7 @@ type Request struct {
 	Keys    []string // key
 	Item    *Item
 	NoReply bool
+	Flags   []string // flags of meta commands
 }
 
 func NewMcEntry(host string, port int, messageQueue queue.MessageQueue) (*McEntry, error) {
@@ -41,6 +53,36 @@ func NewMcEntry(host string, port int, messageQueue queue.MessageQueue) (*McEntr
 	return mc, nil
 }
 
+// SetUnixSocket listens on the unix socket path too. With a zero port it
+// listens on the unix socket only.
+func (m *McEntry) SetUnixSocket(path string) {
+	m.unixPath = path
+}
+
+// SetTLSConfig serves the connections over TLS. The config may verify
+// the client certificates too.
+func (m *McEntry) SetTLSConfig(config *tls.Config) {
+	m.tlsConfig = config
+}
+
+// SetACL sets the access control of the entry. Clients authenticate with
+// 'set auth' in text protocol or SASL PLAIN in binary protocol.
+func (m *McEntry) SetACL(access *acl.ACL) {
+	m.access = access
+}
+
+// SetLimiter limits the rate of the pushes of every connection, client
+// and topic.
+func (m *McEntry) SetLimiter(l *limit.Limiter) {
+	m.limiter = l
+}
+
+// SetRouter redirects the requests of the topics owned by other servers
+// with 'SERVER_ERROR MOVED <addr>' errors.
+func (m *McEntry) SetRouter(router *route.Router) {
+	m.router = router
+}
+
 func (m *McEntry) Read(b *bufio.Reader) (*Request, error) {
 	s, err := b.ReadString('\n')
 	if err != nil {
@@ -106,7 +148,7 @@ func (m *McEntry) Read(b *bufio.Reader) (*Request, error) {
 				`length atoi failed: `+err.Error(),
 			)
 		}
-		if length > MaxBodyLength {
+		if length < 0 {
 			return nil, NewError(
 				ErrBadRequest,
 				`bad data length`,
@@ -120,8 +162,11 @@ func (m *McEntry) Read(b *bufio.Reader) (*Request, error) {
 		}
 		req.NoReply = len(parts) > 5 && parts[5] == "noreply"
 
-		item.Body = make([]byte, length)
-		_, err = io.ReadFull(b, item.Body)
+		item.Body, err = ReadBody(b, length, MaxBodyLength)
+		if errorCode(err) == ErrMessageTooLarge {
+			b.ReadLine()
+			return nil, err
+		}
 		if err != nil {
 			return nil, NewError(
 				ErrBadRequest,
@@ -153,10 +198,14 @@ func (m *McEntry) Read(b *bufio.Reader) (*Request, error) {
 		req.Keys = parts[1:2]
 		req.NoReply = len(parts) > 2 && parts[len(parts)-1] == "noreply"
 
+	case "mg", "ms", "md", "mn":
+		return m.readMeta(b, req, parts)
+
 	case "quit", "version", "flush_all":
 	case "replace", "cas", "append", "prepend":
 	case "incr", "decr":
 	case "verbosity":
+		req.NoReply = len(parts) > 1 && parts[len(parts)-1] == "noreply"
 
 	default:
 		return nil, NewError(
@@ -173,7 +222,12 @@ func writeErrorMc(resp *Response, err error) {
 	}
 	switch e := err.(type) {
 	case *Error:
-		if e.ErrorCode >= 500 {
+		if e.ErrorCode == ErrMoved {
+			resp.status = "SERVER_ERROR"
+			resp.msg = "MOVED " + e.Cause
+			return
+		}
+		if e.ErrorCode >= 500 || e.ErrorCode == ErrTooManyRequests || e.ErrorCode == ErrDraining {
 			resp.status = "SERVER_ERROR"
 		} else {
 			resp.status = "CLIENT_ERROR"
@@ -186,12 +240,50 @@ func writeErrorMc(resp *Response, err error) {
 	}
 }
 
-func (m *McEntry) Process(req *Request) (resp *Response, quit bool) {
+// processMultiGet pops a message from each line of 'get k1 k2 ... [id]'.
+// Every message is keyed by its line, and followed by its id keyed by
+// '<line>/id' if the last key is 'id'.
+func (m *McEntry) processMultiGet(req *Request, resp *Response) {
+	keys := req.Keys
+	withID := !isLineKey(keys[len(keys)-1])
+	if withID {
+		keys = keys[:len(keys)-1]
+	}
+
+	msgs, err := popLines(m.messageQueue, keys, &m.rotation)
+	if err != nil {
+		writeErrorMc(resp, err)
+		return
+	}
+
+	items := make([]*Item, 0, len(msgs)*2)
+	for _, msg := range msgs {
+		itemMsg := new(Item)
+		itemMsg.Key = msg.line
+		itemMsg.Body = msg.data
+		items = append(items, itemMsg)
+		if withID {
+			itemID := new(Item)
+			itemID.Key = msg.line + "/id"
+			itemID.Body = []byte(msg.id)
+			items = append(items, itemID)
+		}
+	}
+	resp.items = items
+}
+
+// Process serves the request of the user authenticated by the connection,
+// which is nil without acl.
+func (m *McEntry) Process(u *acl.User, req *Request) (resp *Response, quit bool) {
 	var err error
 	resp = new(Response)
 	quit = false
 	resp.noreply = req.NoReply
 
+	if m.mcq && m.processMcq(u, req, resp) {
+		return
+	}
+
 	switch req.Cmd {
 	case "get", "gets":
 		for _, k := range req.Keys {
@@ -204,8 +296,13 @@ func (m *McEntry) Process(req *Request) (resp *Response, quit bool) {
 			}
 		}
 
-		key := req.Keys[0]
 		resp.status = "VALUE"
+		if len(req.Keys) > 2 || (len(req.Keys) == 2 && isLineKey(req.Keys[1])) {
+			m.processMultiGet(req, resp)
+			return
+		}
+
+		key := req.Keys[0]
 		id, data, err := m.messageQueue.Pop(key)
 		if err != nil {
 			writeErrorMc(resp, err)
@@ -213,15 +310,15 @@ func (m *McEntry) Process(req *Request) (resp *Response, quit bool) {
 		}
 
 		itemMsg := new(Item)
+		itemMsg.Key = key
 		itemMsg.Body = data
-		items := make(map[string]*Item)
-		items[key] = itemMsg
+		items := []*Item{itemMsg}
 
 		if len(req.Keys) > 1 {
-			keyID := req.Keys[1]
 			itemID := new(Item)
+			itemID.Key = req.Keys[1]
 			itemID.Body = []byte(id)
-			items[keyID] = itemID
+			items = append(items, itemID)
 		}
 
 		resp.items = items
@@ -280,6 +377,16 @@ func (m *McEntry) Process(req *Request) (resp *Response, quit bool) {
 		}
 		resp.status = "DELETED"
 
+	case "mg", "ms", "md", "mn":
+		resp = m.processMeta(req)
+
+	case "version":
+		resp.status = "VERSION"
+		resp.msg = McVersion
+
+	case "verbosity":
+		resp.status = "OK"
+
 	case "quit":
 		resp = nil
 		quit = true
@@ -302,6 +409,15 @@ func (m *McEntry) handlerConn(conn net.Conn) {
 	rbuf := bufio.NewReader(conn)
 	wbuf := bufio.NewWriter(conn)
 
+	magic, err := rbuf.Peek(1)
+	if err == nil && magic[0] == binMagicRequest {
+		m.handlerBinary(rbuf, wbuf, m.limiter.NewConn())
+		conn.Close()
+		return
+	}
+
+	var user *acl.User
+	limitConn := m.limiter.NewConn()
 	for {
 		req, err := m.Read(rbuf)
 		if err != nil {
@@ -316,7 +432,29 @@ func (m *McEntry) handlerConn(conn net.Conn) {
 			}
 		}
 
-		resp, quit := m.Process(req)
+		var resp *Response
+		quit := false
+		if m.access != nil && req.Cmd == "set" && req.Keys[0] == McAuthKey {
+			var u *acl.User
+			u, resp = m.mcAuthenticate(req)
+			if u != nil {
+				user = u
+			}
+		} else if err := m.authorize(user, req); err != nil {
+			resp = new(Response)
+			resp.noreply = req.NoReply
+			writeErrorMc(resp, err)
+		} else if err := m.route(req); err != nil {
+			resp = new(Response)
+			resp.noreply = req.NoReply
+			writeErrorMc(resp, err)
+		} else if err := throttle(m.limiter, limitConn, user, mcPushed(req)); err != nil {
+			resp = new(Response)
+			resp.noreply = req.NoReply
+			writeErrorMc(resp, err)
+		} else {
+			resp, quit = m.Process(user, req)
+		}
 		if quit {
 			break
 		}
@@ -339,19 +477,19 @@ func (m *McEntry) handlerConn(conn net.Conn) {
 }
 
 func (m *McEntry) ListenAndServe() error {
-	addr := Addrcat(m.host, m.port)
-	l, err := net.Listen("tcp", addr)
+	ls, err := ListenAll(m.host, m.port, m.unixPath)
 	if err != nil {
 		return err
 	}
 
-	stopListener, err := NewStopListener(l)
+	stopListener, err := NewTLSStopListener(m.tlsConfig, ls...)
 	if err != nil {
 		return err
 	}
 	m.stopListener = stopListener
+	defer m.stopListener.Close()
 
-	log.Printf("mc entrance serving at %s...", addr)
+	log.Printf("mc entrance serving at %s...", m.stopListener)
 	for {
 		conn, e := m.stopListener.Accept()
 		if e != nil {
@@ -1,9 +1,15 @@
 package entry
 
 import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
 	"github.com/buaazp/uq/store"
 	. "github.com/smartystreets/goconvey/convey"
@@ -77,6 +83,266 @@ func TestMcConfirm(t *testing.T) {
 	})
 }
 
+func TestMcMeta(t *testing.T) {
+	Convey("Test Mc Meta Api", t, func() {
+		conn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		rbuf := bufio.NewReader(conn)
+
+		cmds := []string{
+			"ms foo 1\r\n2\r\n",
+			"mg foo/x v k\r\n",
+			"md foo/x/1 q\r\n",
+			"mg foo/x\r\n",
+			"mn\r\n",
+		}
+		replys := []string{
+			"HD\r\n",
+			"VA 1 kfoo/x/1\r\n",
+			"2\r\n",
+			"EN\r\n",
+			"MN\r\n",
+		}
+		for _, cmd := range cmds {
+			_, err = io.WriteString(conn, cmd)
+			So(err, ShouldBeNil)
+		}
+		for _, reply := range replys {
+			line, err := rbuf.ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, reply)
+		}
+	})
+}
+
+func binPacket(opcode byte, key string, extras, value []byte) []byte {
+	packet := make([]byte, 24)
+	packet[0] = 0x80
+	packet[1] = opcode
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(key)))
+	packet[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(packet[8:12], uint32(len(extras)+len(key)+len(value)))
+	packet = append(packet, extras...)
+	packet = append(packet, key...)
+	return append(packet, value...)
+}
+
+func readBinPacket(r io.Reader) (status uint16, key string, value []byte, err error) {
+	header := make([]byte, 24)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	keyLen := int(binary.BigEndian.Uint16(header[2:4]))
+	extrasLen := int(header[4])
+	status = binary.BigEndian.Uint16(header[6:8])
+	body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	if _, err = io.ReadFull(r, body); err != nil {
+		return
+	}
+	key = string(body[extrasLen : extrasLen+keyLen])
+	value = body[extrasLen+keyLen:]
+	return
+}
+
+func TestMcBinary(t *testing.T) {
+	Convey("Test Mc Binary Api", t, func() {
+		conn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		_, err = conn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("3")))
+		So(err, ShouldBeNil)
+		status, _, _, err := readBinPacket(conn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+
+		_, err = conn.Write(binPacket(0x0c, "foo/x", nil, nil))
+		So(err, ShouldBeNil)
+		status, key, value, err := readBinPacket(conn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+		So(key, ShouldEqual, "foo/x/2")
+		So(string(value), ShouldEqual, "3")
+
+		_, err = conn.Write(binPacket(0x04, key, nil, nil))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(conn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+
+		_, err = conn.Write(binPacket(0x00, "foo/x", nil, nil))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(conn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 1)
+	})
+}
+
+func TestMcMultiGet(t *testing.T) {
+	Convey("Test Mc Multi Get Api", t, func() {
+		err := mc.Add(&memcache.Item{Key: "zp", Value: []byte{}})
+		So(err, ShouldBeNil)
+		err = mc.Add(&memcache.Item{Key: "zp/z", Value: []byte{}})
+		So(err, ShouldBeNil)
+		err = mc.Set(&memcache.Item{Key: "foo", Value: []byte("4")})
+		So(err, ShouldBeNil)
+		err = mc.Set(&memcache.Item{Key: "zp", Value: []byte("a")})
+		So(err, ShouldBeNil)
+
+		its, err := mc.GetMulti([]string{"foo/x", "zp/z", "id"})
+		So(err, ShouldBeNil)
+		So(len(its), ShouldEqual, 4)
+		So(string(its["foo/x"].Value), ShouldEqual, "4")
+		So(string(its["foo/x/id"].Value), ShouldEqual, "foo/x/3")
+		So(string(its["zp/z"].Value), ShouldEqual, "a")
+
+		_, err = mc.GetMulti([]string{"foo/x", "zp/z"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestMcAuth(t *testing.T) {
+	Convey("Test Mc Auth Api", t, func() {
+		access, err := acl.New([]*acl.User{{
+			Name:  "alice",
+			Token: "a1",
+			Rules: []*acl.Rule{{Topic: "foo", Rights: []string{"produce"}}},
+		}})
+		So(err, ShouldBeNil)
+		entrance.(*McEntry).SetACL(access)
+		defer entrance.(*McEntry).SetACL(nil)
+
+		conn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		rbuf := bufio.NewReader(conn)
+
+		cmds := []string{
+			"set foo 0 0 1\r\n4\r\n",
+			"set auth 0 0 8\r\nalice a1\r\n",
+			"set foo 0 0 1\r\n4\r\n",
+			"get foo/x\r\n",
+		}
+		replys := []string{
+			"CLIENT_ERROR 401",
+			"STORED",
+			"STORED",
+			"CLIENT_ERROR 403",
+		}
+		for i, cmd := range cmds {
+			_, err = io.WriteString(conn, cmd)
+			So(err, ShouldBeNil)
+			line, err := rbuf.ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldStartWith, replys[i])
+		}
+
+		bconn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer bconn.Close()
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("5")))
+		So(err, ShouldBeNil)
+		status, _, _, err := readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0x20)
+		_, err = bconn.Write(binPacket(0x21, "PLAIN", nil, []byte("\x00alice\x00a1")))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("5")))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+	})
+}
+
+func TestMcLimit(t *testing.T) {
+	Convey("Test Mc Rate Limit", t, func() {
+		entrance.(*McEntry).SetLimiter(limit.New(limit.Rate{Bytes: 2}, limit.Rate{}, limit.Rate{}))
+		defer entrance.(*McEntry).SetLimiter(nil)
+
+		conn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		rbuf := bufio.NewReader(conn)
+
+		cmds := []string{
+			"set foo 0 0 2\r\n12\r\n",
+			"set foo 0 0 1\r\n3\r\n",
+		}
+		replys := []string{
+			"STORED",
+			"SERVER_ERROR 429",
+		}
+		for i, cmd := range cmds {
+			_, err = io.WriteString(conn, cmd)
+			So(err, ShouldBeNil)
+			line, err := rbuf.ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldStartWith, replys[i])
+		}
+
+		bconn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer bconn.Close()
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("45")))
+		So(err, ShouldBeNil)
+		status, _, _, err := readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("6")))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0x85)
+	})
+}
+
+func TestMcMaxBodyLength(t *testing.T) {
+	Convey("Test Mc Max Body Length", t, func() {
+		MaxBodyLength = 4
+		defer func() { MaxBodyLength = 10 * 1024 * 1024 }()
+
+		conn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		rbuf := bufio.NewReader(conn)
+
+		cmds := []string{
+			"set foo 0 0 5\r\n12345\r\n",
+			"set foo 0 0 1\r\n1\r\n",
+		}
+		replys := []string{
+			"CLIENT_ERROR 108",
+			"STORED",
+		}
+		for i, cmd := range cmds {
+			_, err = io.WriteString(conn, cmd)
+			So(err, ShouldBeNil)
+			line, err := rbuf.ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldStartWith, replys[i])
+		}
+
+		bconn, err := net.Dial("tcp", "localhost:8802")
+		So(err, ShouldBeNil)
+		defer bconn.Close()
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("12345")))
+		So(err, ShouldBeNil)
+		status, _, _, err := readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0x03)
+		_, err = bconn.Write(binPacket(0x01, "foo", make([]byte, 8), []byte("1")))
+		So(err, ShouldBeNil)
+		status, _, _, err = readBinPacket(bconn)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, 0)
+	})
+}
+
 func TestCloseMcEntry(t *testing.T) {
 	Convey("Test Close Mc Entry", t, func() {
 		entrance.Stop()
@@ -0,0 +1,220 @@
+package entry
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	McVersion string = "uq"
+)
+
+// readMeta parses the meta commands of memcached:
+//
+//	mg <key> <flags>*
+//	ms <key> <datalen> <flags>*\r\n<data>\r\n
+//	md <key> <flags>*
+//	mn
+func (m *McEntry) readMeta(b *bufio.Reader, req *Request, parts []string) (*Request, error) {
+	if req.Cmd == "mn" {
+		return req, nil
+	}
+	if len(parts) < 2 {
+		return nil, NewError(
+			ErrBadRequest,
+			`cmd parts error: < 2`,
+		)
+	}
+	req.Keys = parts[1:2]
+	req.Flags = parts[2:]
+
+	if req.Cmd == "ms" {
+		if len(parts) < 3 {
+			return nil, NewError(
+				ErrBadRequest,
+				`cmd parts error: < 3`,
+			)
+		}
+		length, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, NewError(
+				ErrBadRequest,
+				`length atoi failed: `+err.Error(),
+			)
+		}
+		if length < 0 {
+			return nil, NewError(
+				ErrBadRequest,
+				`bad data length`,
+			)
+		}
+		req.Flags = parts[3:]
+
+		item := new(Item)
+		item.Body, err = ReadBody(b, length, MaxBodyLength)
+		if errorCode(err) == ErrMessageTooLarge {
+			b.ReadLine()
+			return nil, err
+		}
+		if err != nil {
+			return nil, NewError(
+				ErrBadRequest,
+				`readfull failed: `+err.Error(),
+			)
+		}
+		remain, _, err := b.ReadLine()
+		if err != nil {
+			return nil, NewError(
+				ErrBadRequest,
+				`readline failed: `+err.Error(),
+			)
+		}
+		if len(remain) != 0 {
+			return nil, NewError(
+				ErrBadRequest,
+				`bad data chunk`,
+			)
+		}
+		req.Item = item
+	}
+
+	for _, flag := range req.Flags {
+		if flag == "q" {
+			req.NoReply = true
+		}
+	}
+	return req, nil
+}
+
+func metaFlag(flags []string, f byte) (string, bool) {
+	for _, flag := range flags {
+		if len(flag) > 0 && flag[0] == f {
+			return flag[1:], true
+		}
+	}
+	return "", false
+}
+
+// metaReturnFlags builds the flags echoed back to the client. The k flag
+// returns the message id which is needed to confirm a popped message.
+func metaReturnFlags(flags []string, key string, size int) string {
+	rets := make([]string, 0)
+	for _, flag := range flags {
+		if len(flag) == 0 {
+			continue
+		}
+		switch flag[0] {
+		case 'k':
+			rets = append(rets, "k"+key)
+		case 'O':
+			rets = append(rets, flag)
+		case 's':
+			rets = append(rets, "s"+strconv.Itoa(size))
+		case 'f':
+			rets = append(rets, "f0")
+		case 't':
+			rets = append(rets, "t-1")
+		}
+	}
+	return strings.Join(rets, " ")
+}
+
+func (m *McEntry) processMeta(req *Request) (resp *Response) {
+	resp = new(Response)
+	if req.Cmd == "mn" {
+		resp.status = "MN"
+		return
+	}
+
+	key := req.Keys[0]
+	if len(key) > MaxKeyLength {
+		writeErrorMc(resp, NewError(
+			ErrBadKey,
+			`key is too long`,
+		))
+		return
+	}
+
+	switch req.Cmd {
+	case "mg":
+		// mg with the v flag pops a message, without it only peeks
+		// whether the line has any message
+		if _, ok := metaFlag(req.Flags, 'v'); ok {
+			id, data, err := m.messageQueue.Pop(key)
+			if err != nil {
+				if errorCode(err) == ErrNone {
+					resp.status = "EN"
+					resp.noreply = req.NoReply
+					return
+				}
+				writeErrorMc(resp, err)
+				return
+			}
+			resp.status = "VA"
+			resp.msg = metaReturnFlags(req.Flags, id, len(data))
+			resp.value = data
+			return
+		}
+
+		qs, err := m.messageQueue.Stat(key)
+		if err != nil {
+			writeErrorMc(resp, err)
+			return
+		}
+		if qs.Count == 0 {
+			resp.status = "EN"
+			resp.noreply = req.NoReply
+			return
+		}
+		resp.status = "HD"
+		resp.msg = metaReturnFlags(req.Flags, key, 0)
+		resp.noreply = req.NoReply
+
+	case "ms":
+		var err error
+		mode, _ := metaFlag(req.Flags, 'M')
+		switch strings.ToUpper(mode) {
+		case "", "S":
+			err = m.messageQueue.Push(key, req.Item.Body)
+		case "E":
+			// add mode creates the topic or line like the add command
+			err = m.messageQueue.Create(key, string(req.Item.Body))
+		default:
+			err = NewError(
+				ErrBadRequest,
+				`unsupported ms mode: `+mode,
+			)
+		}
+		if err != nil {
+			code := errorCode(err)
+			if code == ErrTopicExisted || code == ErrLineExisted {
+				resp.status = "NS"
+				return
+			}
+			writeErrorMc(resp, err)
+			return
+		}
+		resp.status = "HD"
+		resp.msg = metaReturnFlags(req.Flags, key, 0)
+		resp.noreply = req.NoReply
+
+	case "md":
+		err := m.messageQueue.Confirm(key)
+		if err != nil {
+			code := errorCode(err)
+			if code == ErrNotDelivered || code == ErrTopicNotExisted || code == ErrLineNotExisted {
+				resp.status = "NF"
+				return
+			}
+			writeErrorMc(resp, err)
+			return
+		}
+		resp.status = "HD"
+		resp.msg = metaReturnFlags(req.Flags, key, 0)
+		resp.noreply = req.NoReply
+	}
+	return
+}
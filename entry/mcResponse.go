@@ -3,13 +3,15 @@ package entry
 import (
 	"fmt"
 	"io"
+	"strconv"
 )
 
 type Response struct {
 	status  string
 	msg     string
 	noreply bool
-	items   map[string]*Item
+	items   []*Item
+	value   []byte
 }
 
 func WriteFull(w io.Writer, buf []byte) error {
@@ -29,8 +31,8 @@ func (resp *Response) Write(w io.Writer) error {
 	switch resp.status {
 	case "VALUE":
 		if resp.items != nil {
-			for key, item := range resp.items {
-				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, item.Flag, len(item.Body))
+			for _, item := range resp.items {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", item.Key, item.Flag, len(item.Body))
 				if e := WriteFull(w, item.Body); e != nil {
 					return e
 				}
@@ -39,9 +41,22 @@ func (resp *Response) Write(w io.Writer) error {
 		}
 		io.WriteString(w, "END\r\n")
 
-	case "STAT":
-		io.WriteString(w, resp.msg)
+	case "VA":
+		io.WriteString(w, "VA "+strconv.Itoa(len(resp.value)))
+		if resp.msg != "" {
+			io.WriteString(w, " "+resp.msg)
+		}
+		io.WriteString(w, "\r\n")
+		if e := WriteFull(w, resp.value); e != nil {
+			return e
+		}
 		io.WriteString(w, "\r\n")
+
+	case "STAT":
+		if resp.msg != "" {
+			io.WriteString(w, resp.msg)
+			io.WriteString(w, "\r\n")
+		}
 		io.WriteString(w, "END\r\n")
 
 	default:
@@ -0,0 +1,163 @@
+package entry
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/queue"
+	. "github.com/buaazp/uq/utils"
+)
+
+// NewMcqEntry returns a mc entrance in memcacheQ compatibility mode. A key
+// without '/' is treated as a memcacheQ queue: get pops and deletes from
+// the implicit default line of the topic, set pushes and creates the topic
+// if needed, delete removes the topic and 'stats queue' reports the
+// put/get counters of all topics.
+func NewMcqEntry(host string, port int, messageQueue queue.MessageQueue) (*McEntry, error) {
+	mc, err := NewMcEntry(host, port, messageQueue)
+	if err != nil {
+		return nil, err
+	}
+	mc.mcq = true
+	return mc, nil
+}
+
+func isMcqKey(key string) bool {
+	return !strings.Contains(key, "/")
+}
+
+func (m *McEntry) mcqPop(u *acl.User, key string) ([]byte, error) {
+	lineKey := key + "/" + DefaultLineName
+	_, data, err := m.messageQueue.Pop(lineKey)
+	if errorCode(err) != ErrLineNotExisted {
+		return data, err
+	}
+
+	// memcacheQ never redelivers, so the line has no recycle
+	err = authorizeCreate(m.access, u, lineKey)
+	if err != nil {
+		return nil, err
+	}
+	err = m.messageQueue.Create(lineKey, "")
+	if err != nil && errorCode(err) != ErrLineExisted {
+		return nil, err
+	}
+	_, data, err = m.messageQueue.Pop(lineKey)
+	return data, err
+}
+
+func (m *McEntry) mcqPush(u *acl.User, key string, data []byte) error {
+	err := m.messageQueue.Push(key, data)
+	if errorCode(err) != ErrTopicNotExisted {
+		return err
+	}
+
+	err = authorizeCreate(m.access, u, key)
+	if err != nil {
+		return err
+	}
+	err = m.messageQueue.Create(key, "")
+	if err != nil && errorCode(err) != ErrTopicExisted {
+		return err
+	}
+	return m.messageQueue.Push(key, data)
+}
+
+func (m *McEntry) mcqStats() string {
+	stats := make([]string, 0)
+	for _, topicName := range m.messageQueue.Topics() {
+		qs, err := m.messageQueue.Stat(topicName)
+		if err != nil {
+			continue
+		}
+		var gets uint64
+		for _, ls := range qs.Lines {
+			if ls.Name == topicName+"/"+DefaultLineName {
+				gets = ls.Head
+			}
+		}
+		stat := "STAT " + topicName + " " +
+			strconv.FormatUint(qs.Tail, 10) + "/" + strconv.FormatUint(gets, 10)
+		stats = append(stats, stat)
+	}
+	return strings.Join(stats, "\r\n")
+}
+
+// processMcq serves the requests in memcacheQ semantics. It returns false
+// if the request should be served as a normal uq request.
+func (m *McEntry) processMcq(u *acl.User, req *Request, resp *Response) bool {
+	switch req.Cmd {
+	case "get", "gets":
+		for _, k := range req.Keys {
+			if !isMcqKey(k) {
+				return false
+			}
+		}
+
+		resp.status = "VALUE"
+		items := make([]*Item, 0, len(req.Keys))
+		for _, k := range req.Keys {
+			if len(k) > MaxKeyLength {
+				writeErrorMc(resp, NewError(
+					ErrBadKey,
+					`key is too long`,
+				))
+				return true
+			}
+			data, err := m.mcqPop(u, k)
+			if err != nil {
+				code := errorCode(err)
+				if code == ErrNone || code == ErrTopicNotExisted {
+					continue
+				}
+				writeErrorMc(resp, err)
+				return true
+			}
+			itemMsg := new(Item)
+			itemMsg.Key = k
+			itemMsg.Body = data
+			items = append(items, itemMsg)
+		}
+		resp.items = items
+
+	case "set":
+		key := req.Keys[0]
+		if !isMcqKey(key) {
+			return false
+		}
+		err := m.mcqPush(u, key, req.Item.Body)
+		if err != nil {
+			writeErrorMc(resp, err)
+			return true
+		}
+		resp.status = "STORED"
+
+	case "delete":
+		key := req.Keys[0]
+		if !isMcqKey(key) {
+			return false
+		}
+		err := m.messageQueue.Remove(key)
+		if err != nil {
+			if errorCode(err) == ErrTopicNotExisted {
+				resp.status = "NOT_FOUND"
+				return true
+			}
+			writeErrorMc(resp, err)
+			return true
+		}
+		resp.status = "DELETED"
+
+	case "stats":
+		if req.Keys[0] != "queue" {
+			return false
+		}
+		resp.status = "STAT"
+		resp.msg = m.mcqStats()
+
+	default:
+		return false
+	}
+	return true
+}
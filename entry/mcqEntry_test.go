@@ -0,0 +1,134 @@
+package entry
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/store"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var mcq *memcache.Client
+
+func init() {
+	mcq = memcache.New("localhost:8804")
+}
+
+func TestNewMcqEntry(t *testing.T) {
+	Convey("Test New Mcq Entry", t, func() {
+		var err error
+		storage, err = store.NewMemStore()
+		So(err, ShouldBeNil)
+		So(storage, ShouldNotBeNil)
+		messageQueue, err = queue.NewUnitedQueue(storage, "127.0.0.1", 8804, nil, "uq")
+		So(err, ShouldBeNil)
+		So(messageQueue, ShouldNotBeNil)
+
+		entrance, err = NewMcqEntry("0.0.0.0", 8804, messageQueue)
+		So(err, ShouldBeNil)
+		So(entrance, ShouldNotBeNil)
+
+		go func() {
+			entrance.ListenAndServe()
+		}()
+	})
+}
+
+func TestMcqPush(t *testing.T) {
+	Convey("Test Mcq Push Api", t, func() {
+		err := mcq.Set(&memcache.Item{
+			Key:   "foo",
+			Value: []byte("1"),
+		})
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestMcqPop(t *testing.T) {
+	Convey("Test Mcq Pop Api", t, func() {
+		it, err := mcq.Get("foo")
+		So(err, ShouldBeNil)
+		So(string(it.Value), ShouldEqual, "1")
+
+		_, err = mcq.Get("foo")
+		So(err, ShouldEqual, memcache.ErrCacheMiss)
+	})
+}
+
+func TestMcqStats(t *testing.T) {
+	Convey("Test Mcq Stats Api", t, func() {
+		conn, err := net.Dial("tcp", "localhost:8804")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		_, err = io.WriteString(conn, "stats queue\r\n")
+		So(err, ShouldBeNil)
+		rbuf := bufio.NewReader(conn)
+		line, err := rbuf.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "STAT foo 1/1\r\n")
+		line, err = rbuf.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "END\r\n")
+	})
+}
+
+func TestMcqAuth(t *testing.T) {
+	Convey("Test Mcq Auth Api", t, func() {
+		access, err := acl.New([]*acl.User{{
+			Name:  "alice",
+			Token: "a1",
+			Rules: []*acl.Rule{{Topic: "*", Rights: []string{"produce", "consume"}}},
+		}})
+		So(err, ShouldBeNil)
+		entrance.(*McEntry).SetACL(access)
+		defer entrance.(*McEntry).SetACL(nil)
+
+		conn, err := net.Dial("tcp", "localhost:8804")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		rbuf := bufio.NewReader(conn)
+
+		// the queues are created implicitly by the admins only
+		cmds := []string{
+			"set auth 0 0 8\r\nalice a1\r\n",
+			"set mcqauth 0 0 1\r\n1\r\n",
+			"get foo\r\n",
+		}
+		replys := []string{
+			"STORED",
+			"CLIENT_ERROR 403",
+			"END",
+		}
+		for i, cmd := range cmds {
+			_, err = io.WriteString(conn, cmd)
+			So(err, ShouldBeNil)
+			line, err := rbuf.ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldStartWith, replys[i])
+		}
+	})
+}
+
+func TestMcqRemove(t *testing.T) {
+	Convey("Test Mcq Remove Api", t, func() {
+		err := mcq.Delete("foo")
+		So(err, ShouldBeNil)
+
+		err = mcq.Delete("foo")
+		So(err, ShouldEqual, memcache.ErrCacheMiss)
+	})
+}
+
+func TestCloseMcqEntry(t *testing.T) {
+	Convey("Test Close Mcq Entry", t, func() {
+		entrance.Stop()
+		messageQueue = nil
+		storage = nil
+	})
+}
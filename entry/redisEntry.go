@@ -1,12 +1,17 @@
 package entry
 
 import (
+	"crypto/tls"
 	"log"
-	"net"
+	"sync"
 	"time"
 
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
 	. "github.com/buaazp/uq/utils"
+	"github.com/garyburd/redigo/redis"
 )
 
 const (
@@ -20,6 +25,15 @@ const (
 type RedisEntry struct {
 	host         string
 	port         int
+	listRecycle  string
+	rotation     uint64
+	access       *acl.ACL
+	limiter      *limit.Limiter
+	router       *route.Router
+	pools        map[string]*redis.Pool
+	poolsLock    sync.Mutex
+	tlsConfig    *tls.Config
+	unixPath     string
 	stopListener *StopListener
 	messageQueue queue.MessageQueue
 }
@@ -32,6 +46,42 @@ func NewRedisEntry(host string, port int, messageQueue queue.MessageQueue) (*Red
 	return rs, nil
 }
 
+// SetListRecycle sets the recycle time of the default lines which are
+// created automatically by redis list commands.
+func (r *RedisEntry) SetListRecycle(recycle string) {
+	r.listRecycle = recycle
+}
+
+// SetUnixSocket listens on the unix socket path too. With a zero port it
+// listens on the unix socket only.
+func (r *RedisEntry) SetUnixSocket(path string) {
+	r.unixPath = path
+}
+
+// SetTLSConfig serves the connections over TLS. The config may verify
+// the client certificates too.
+func (r *RedisEntry) SetTLSConfig(config *tls.Config) {
+	r.tlsConfig = config
+}
+
+// SetACL sets the access control of the entry. Clients authenticate
+// with 'AUTH [name] token'.
+func (r *RedisEntry) SetACL(access *acl.ACL) {
+	r.access = access
+}
+
+// SetLimiter limits the rate of the pushes of every connection, client
+// and topic.
+func (r *RedisEntry) SetLimiter(l *limit.Limiter) {
+	r.limiter = l
+}
+
+// SetRouter routes the commands of the topics owned by other servers,
+// which are redirected by -MOVED errors or proxied.
+func (r *RedisEntry) SetRouter(router *route.Router) {
+	r.router = router
+}
+
 func (r *RedisEntry) OnUndefined(session *Session, cmd *Command) (reply *Reply) {
 	return ErrorReply(NewError(
 		ErrBadRequest,
@@ -42,7 +92,11 @@ func (r *RedisEntry) OnUndefined(session *Session, cmd *Command) (reply *Reply)
 func (r *RedisEntry) commandHandler(session *Session, cmd *Command) (reply *Reply) {
 	cmdName := cmd.Name()
 
-	if cmdName == "ADD" || cmdName == "QADD" {
+	if cmdName == "AUTH" {
+		reply = r.OnAuth(session, cmd)
+	} else if cmdName == "PROXIED" {
+		reply = r.OnProxied(session)
+	} else if cmdName == "ADD" || cmdName == "QADD" {
 		reply = r.OnQadd(cmd)
 	} else if cmdName == "SET" || cmdName == "QPUSH" {
 		reply = r.OnQpush(cmd)
@@ -60,6 +114,14 @@ func (r *RedisEntry) commandHandler(session *Session, cmd *Command) (reply *Repl
 		reply = r.OnQempty(cmd)
 	} else if cmdName == "INFO" || cmdName == "QINFO" {
 		reply = r.OnInfo(cmd)
+	} else if cmdName == "LPUSH" || cmdName == "RPUSH" {
+		reply = r.OnLpush(session, cmd)
+	} else if cmdName == "RPOP" || cmdName == "LPOP" {
+		reply = r.OnRpop(session, cmd)
+	} else if cmdName == "BRPOP" || cmdName == "BLPOP" {
+		reply = r.OnBrpop(session, cmd)
+	} else if cmdName == "LLEN" {
+		reply = r.OnLlen(cmd)
 	} else {
 		reply = r.OnUndefined(session, cmd)
 	}
@@ -81,6 +143,16 @@ func (r *RedisEntry) Process(session *Session, cmd *Command) (reply *Reply) {
 		))
 	}
 
+	if err := r.authorize(session, cmd); err != nil {
+		return ErrorReply(err)
+	}
+	if reply := r.route(cmd); reply != nil {
+		return reply
+	}
+	if reply := r.throttle(session, cmd); reply != nil {
+		return reply
+	}
+
 	// invoke
 	reply = r.commandHandler(session, cmd)
 
@@ -98,6 +170,13 @@ func (r *RedisEntry) handlerConn(session *Session) {
 	for {
 		var cmd *Command
 		cmd, err = session.ReadCommand()
+		if errorCode(err) == ErrMessageTooLarge {
+			err = session.WriteReply(ErrorReply(err))
+			if err != nil {
+				break
+			}
+			continue
+		}
 		// 1) io.EOF
 		// 2) read tcp 127.0.0.1:51863: connection reset by peer
 		if err != nil {
@@ -122,26 +201,28 @@ func (r *RedisEntry) handlerConn(session *Session) {
 }
 
 func (r *RedisEntry) ListenAndServe() error {
-	addr := Addrcat(r.host, r.port)
-	l, err := net.Listen("tcp", addr)
+	ls, err := ListenAll(r.host, r.port, r.unixPath)
 	if err != nil {
 		return err
 	}
 
-	stopListener, err := NewStopListener(l)
+	stopListener, err := NewTLSStopListener(r.tlsConfig, ls...)
 	if err != nil {
 		return err
 	}
 	r.stopListener = stopListener
+	defer r.stopListener.Close()
 
-	log.Printf("redis entrance serving at %s...", addr)
+	log.Printf("redis entrance serving at %s...", r.stopListener)
 	for {
 		conn, err := r.stopListener.Accept()
 		if err != nil {
 			// log.Printf("Accept failed: %s\n", err)
 			return err
 		}
-		go r.handlerConn(NewSession(conn))
+		session := NewSession(conn)
+		session.SetAttribute(C_LIMIT, r.limiter.NewConn())
+		go r.handlerConn(session)
 	}
 
 	return nil
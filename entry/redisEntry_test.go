@@ -1,10 +1,15 @@
 package entry
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
 	"github.com/buaazp/uq/store"
 	"github.com/garyburd/redigo/redis"
 	. "github.com/smartystreets/goconvey/convey"
@@ -72,6 +77,257 @@ func TestRedisConfirm(t *testing.T) {
 	})
 }
 
+func TestRedisList(t *testing.T) {
+	Convey("Test Redis List Api", t, func() {
+		n, err := redis.Int(conn.Do("LPUSH", "bar", "1", "2"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		n, err = redis.Int(conn.Do("LLEN", "bar"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		v, err := redis.String(conn.Do("RPOP", "bar"))
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "1")
+
+		rpl, err := redis.Strings(conn.Do("BRPOP", "bar", "1"))
+		So(err, ShouldBeNil)
+		So(rpl[0], ShouldEqual, "bar")
+		So(rpl[1], ShouldEqual, "2")
+
+		_, err = redis.String(conn.Do("RPOP", "bar"))
+		So(err, ShouldEqual, redis.ErrNil)
+	})
+}
+
+func TestRedisPopLines(t *testing.T) {
+	Convey("Test Redis Pop Lines Api", t, func() {
+		_, err := conn.Do("QADD", "zp")
+		So(err, ShouldBeNil)
+		_, err = conn.Do("QADD", "zp/z")
+		So(err, ShouldBeNil)
+		_, err = conn.Do("QPUSH", "zp", "a")
+		So(err, ShouldBeNil)
+		_, err = conn.Do("QPUSH", "foo", "b")
+		So(err, ShouldBeNil)
+
+		rpl, err := redis.Strings(conn.Do("QPOP", "foo/x", "zp/z"))
+		So(err, ShouldBeNil)
+		So(len(rpl), ShouldEqual, 6)
+		msgs := make(map[string]string)
+		for i := 0; i < len(rpl); i += 3 {
+			msgs[rpl[i]] = rpl[i+1]
+		}
+		So(msgs["foo/x"], ShouldEqual, "b")
+		So(msgs["zp/z"], ShouldEqual, "a")
+
+		_, err = conn.Do("QPOP", "foo/x", "zp/z")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRedisAuth(t *testing.T) {
+	Convey("Test Redis Auth Api", t, func() {
+		access, err := acl.New([]*acl.User{{
+			Name:  "alice",
+			Token: "a1",
+			Rules: []*acl.Rule{
+				{Topic: "foo", Rights: []string{"produce", "consume"}},
+				{Topic: "list*", Rights: []string{"produce", "consume"}},
+			},
+		}, {
+			Name:  "bob",
+			Token: "b1",
+			Rules: []*acl.Rule{{Topic: "list*", Rights: []string{"produce", "consume", "admin"}}},
+		}})
+		So(err, ShouldBeNil)
+		entrance.(*RedisEntry).SetACL(access)
+		defer entrance.(*RedisEntry).SetACL(nil)
+
+		c, err := redis.DialTimeout("tcp", "127.0.0.1:8803", 0, 1*time.Second, 1*time.Second)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Do("QPUSH", "foo", "1")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "401")
+		_, err = c.Do("AUTH", "alice", "bad")
+		So(err, ShouldNotBeNil)
+		_, err = c.Do("AUTH", "alice", "a1")
+		So(err, ShouldBeNil)
+		_, err = c.Do("QPUSH", "foo", "1")
+		So(err, ShouldBeNil)
+		_, err = c.Do("QADD", "bar")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "403")
+
+		// the lists are created implicitly by the admins only
+		_, err = c.Do("LPUSH", "listauth", "1")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "403")
+		_, err = c.Do("AUTH", "bob", "b1")
+		So(err, ShouldBeNil)
+		_, err = c.Do("LPUSH", "listauth", "1")
+		So(err, ShouldBeNil)
+		_, err = c.Do("AUTH", "alice", "a1")
+		So(err, ShouldBeNil)
+		_, err = c.Do("RPOP", "listauth")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "403")
+		_, err = c.Do("AUTH", "bob", "b1")
+		So(err, ShouldBeNil)
+		v, err := redis.String(c.Do("RPOP", "listauth"))
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, "1")
+	})
+}
+
+func TestRedisLimit(t *testing.T) {
+	Convey("Test Redis Rate Limit", t, func() {
+		entrance.(*RedisEntry).SetLimiter(limit.New(limit.Rate{Messages: 2}, limit.Rate{}, limit.Rate{}))
+		defer entrance.(*RedisEntry).SetLimiter(nil)
+
+		c, err := redis.DialTimeout("tcp", "127.0.0.1:8803", 0, 1*time.Second, 1*time.Second)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Do("QMPUSH", "foo", "1", "2")
+		So(err, ShouldBeNil)
+		_, err = c.Do("QPUSH", "foo", "3")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "ERR 429")
+		// pops are not limited
+		_, err = c.Do("QPOP", "foo/x")
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestRedisMaxBodyLength(t *testing.T) {
+	Convey("Test Redis Max Body Length", t, func() {
+		MaxBodyLength = 4
+		defer func() { MaxBodyLength = 10 * 1024 * 1024 }()
+
+		c, err := redis.DialTimeout("tcp", "127.0.0.1:8803", 0, 1*time.Second, 1*time.Second)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Do("QPUSH", "foo", strings.Repeat("x", 1024))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "108")
+		// the connection keeps in sync
+		_, err = c.Do("QPUSH", "foo", "1")
+		So(err, ShouldBeNil)
+	})
+}
+
+// newTestRouter returns a router of self and a fake owner, and the topics
+// owned by each.
+func newTestRouter(self, owner, mode string) (*route.Router, string, string) {
+	r, err := route.New(self, mode, func() ([]string, error) {
+		return []string{self, owner}, nil
+	})
+	So(err, ShouldBeNil)
+	So(r.Refresh(), ShouldBeNil)
+	local, remote := "", ""
+	for i := 0; local == "" || remote == ""; i++ {
+		topic := "route" + strconv.Itoa(i)
+		if r.Owner(topic) == "" {
+			local = topic
+		} else {
+			remote = topic
+		}
+	}
+	return r, local, remote
+}
+
+func TestRedisRoute(t *testing.T) {
+	Convey("Test Redis Route Redirect", t, func() {
+		r, local, remote := newTestRouter("127.0.0.1:8803", "127.0.0.1:8813", route.ModeRedirect)
+		entrance.(*RedisEntry).SetRouter(r)
+		defer entrance.(*RedisEntry).SetRouter(nil)
+
+		c, err := redis.DialTimeout("tcp", "127.0.0.1:8803", 0, 1*time.Second, 1*time.Second)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Do("QADD", local)
+		So(err, ShouldBeNil)
+		_, err = c.Do("QADD", remote)
+		So(err, ShouldNotBeNil)
+		slot := strconv.FormatUint(uint64(route.Slot(remote)), 10)
+		So(err.Error(), ShouldEqual, "MOVED "+slot+" 127.0.0.1:8813")
+		_, err = c.Do("QPOP", remote+"/x")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "MOVED")
+		slot = strconv.FormatUint(uint64(route.Slot(remote+"/x")), 10)
+		So(err.Error(), ShouldEqual, "MOVED "+slot+" 127.0.0.1:8813")
+
+		// the keys of several owners
+		_, err = c.Do("QPOP", local+"/x", remote+"/x")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "CROSSSLOT")
+	})
+}
+
+func TestRedisRouteProxy(t *testing.T) {
+	Convey("Test Redis Route Proxy With Auth", t, func() {
+		access, err := acl.New([]*acl.User{{
+			Name:  "carol",
+			Token: "c1",
+			Rules: []*acl.Rule{{Topic: "route*", Rights: []string{"produce", "consume", "admin"}}},
+		}})
+		So(err, ShouldBeNil)
+		ownerStorage, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		ownerQueue, err := queue.NewUnitedQueue(ownerStorage, "127.0.0.1", 8813, nil, "uq")
+		So(err, ShouldBeNil)
+		owner, err := NewRedisEntry("127.0.0.1", 8813, ownerQueue)
+		So(err, ShouldBeNil)
+		owner.SetACL(access)
+		go owner.ListenAndServe()
+		defer owner.Stop()
+
+		r, _, remote := newTestRouter("127.0.0.1:8803", "127.0.0.1:8813", route.ModeProxy)
+		entrance.(*RedisEntry).SetRouter(r)
+		defer entrance.(*RedisEntry).SetRouter(nil)
+		entrance.(*RedisEntry).SetACL(access)
+		defer entrance.(*RedisEntry).SetACL(nil)
+
+		c, err := redis.DialTimeout("tcp", "127.0.0.1:8803", 0, 1*time.Second, 1*time.Second)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		_, err = c.Do("QADD", remote)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "401")
+		_, err = c.Do("AUTH", "carol", "c1")
+		So(err, ShouldBeNil)
+		// forwarded as carol
+		_, err = c.Do("QADD", remote)
+		So(err, ShouldBeNil)
+		_, err = c.Do("QADD", remote+"/x")
+		So(err, ShouldBeNil)
+		_, err = c.Do("QPUSH", remote, "1")
+		So(err, ShouldBeNil)
+		_, data, err := ownerQueue.Pop(remote + "/x")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "1")
+
+		// the owner routing it back redirects instead of proxying again
+		back, err := route.New("127.0.0.1:8813", route.ModeProxy, func() ([]string, error) {
+			return []string{"127.0.0.1:8803"}, nil
+		})
+		So(err, ShouldBeNil)
+		So(back.Refresh(), ShouldBeNil)
+		owner.SetRouter(back)
+		_, err = c.Do("QPUSH", remote, "2")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "MOVED")
+		So(err.Error(), ShouldEndWith, " 127.0.0.1:8803")
+	})
+}
+
 func TestCloseRedisEntry(t *testing.T) {
 	Convey("Test Close Redis Entry", t, func() {
 		entrance.Stop()
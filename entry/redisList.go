@@ -0,0 +1,161 @@
+package entry
+
+import (
+	"time"
+
+	"github.com/buaazp/uq/acl"
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	BrpopInterval time.Duration = 100 * time.Millisecond
+)
+
+func errorCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.ErrorCode
+	}
+	return ErrInternalError
+}
+
+func listLineKey(key string) string {
+	return key + "/" + DefaultLineName
+}
+
+func (r *RedisEntry) listPush(session *Session, key string, vals [][]byte) error {
+	var err error
+	if len(vals) == 1 {
+		err = r.messageQueue.Push(key, vals[0])
+	} else {
+		err = r.messageQueue.MultiPush(key, vals)
+	}
+	if errorCode(err) != ErrTopicNotExisted {
+		return err
+	}
+
+	// legacy list clients never create their queues
+	u, _ := session.GetAttribute(C_USER).(*acl.User)
+	err = authorizeCreate(r.access, u, key)
+	if err != nil {
+		return err
+	}
+	err = r.messageQueue.Create(key, "")
+	if err != nil && errorCode(err) != ErrTopicExisted {
+		return err
+	}
+	if len(vals) == 1 {
+		return r.messageQueue.Push(key, vals[0])
+	}
+	return r.messageQueue.MultiPush(key, vals)
+}
+
+func (r *RedisEntry) listPop(session *Session, key string) (string, []byte, error) {
+	lineKey := listLineKey(key)
+	id, data, err := r.messageQueue.Pop(lineKey)
+	if errorCode(err) != ErrLineNotExisted {
+		return id, data, err
+	}
+
+	u, _ := session.GetAttribute(C_USER).(*acl.User)
+	err = authorizeCreate(r.access, u, lineKey)
+	if err != nil {
+		return "", nil, err
+	}
+	err = r.messageQueue.Create(lineKey, r.listRecycle)
+	if err != nil && errorCode(err) != ErrLineExisted {
+		return "", nil, err
+	}
+	return r.messageQueue.Pop(lineKey)
+}
+
+func (r *RedisEntry) listLen(key string) (int, error) {
+	qs, err := r.messageQueue.Stat(listLineKey(key))
+	if errorCode(err) == ErrLineNotExisted {
+		// the default line will start from the topic head
+		qs, err = r.messageQueue.Stat(key)
+	}
+	if err != nil {
+		if errorCode(err) == ErrTopicNotExisted {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return int(qs.Count), nil
+}
+
+func (r *RedisEntry) OnLpush(session *Session, cmd *Command) *Reply {
+	key := cmd.StringAtIndex(1)
+	vals := cmd.Args()[2:]
+
+	err := r.listPush(session, key, vals)
+	if err != nil {
+		return ErrorReply(err)
+	}
+
+	n, err := r.listLen(key)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return IntegerReply(n)
+}
+
+func (r *RedisEntry) OnRpop(session *Session, cmd *Command) *Reply {
+	key := cmd.StringAtIndex(1)
+
+	_, value, err := r.listPop(session, key)
+	if err != nil {
+		code := errorCode(err)
+		if code == ErrNone || code == ErrTopicNotExisted {
+			return BulkReply(nil)
+		}
+		return ErrorReply(err)
+	}
+
+	return BulkReply(value)
+}
+
+func (r *RedisEntry) OnBrpop(session *Session, cmd *Command) *Reply {
+	keys := cmd.StringArgs()[1 : cmd.Len()-1]
+	timeout, err := cmd.FloatAtIndex(cmd.Len() - 1)
+	if err != nil || timeout < 0 {
+		return ErrorReply(NewError(
+			ErrBadRequest,
+			`timeout is not a float or out of range`,
+		))
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout * float64(time.Second)))
+	}
+	for {
+		for _, key := range keys {
+			_, value, err := r.listPop(session, key)
+			if err == nil {
+				vals := make([]interface{}, 2)
+				vals[0] = key
+				vals[1] = value
+				return MultiBulksReply(vals)
+			}
+			code := errorCode(err)
+			if code != ErrNone && code != ErrTopicNotExisted {
+				return ErrorReply(err)
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return MultiBulksReply(nil)
+		}
+		time.Sleep(BrpopInterval)
+	}
+}
+
+func (r *RedisEntry) OnLlen(cmd *Command) *Reply {
+	key := cmd.StringAtIndex(1)
+
+	n, err := r.listLen(key)
+	if err != nil {
+		return ErrorReply(err)
+	}
+	return IntegerReply(n)
+}
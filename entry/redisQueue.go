@@ -46,6 +46,9 @@ func (r *RedisEntry) OnQmpush(cmd *Command) *Reply {
 }
 
 func (r *RedisEntry) OnQpop(cmd *Command) *Reply {
+	if cmd.Len() > 2 {
+		return r.onQpopLines(cmd)
+	}
 	key := cmd.StringAtIndex(1)
 
 	id, value, err := r.messageQueue.Pop(key)
@@ -60,6 +63,23 @@ func (r *RedisEntry) OnQpop(cmd *Command) *Reply {
 	return MultiBulksReply(vals)
 }
 
+// onQpopLines pops a message from each line of 'QPOP k1 k2 ...'. The
+// reply is a flat list of line, value and id of every available message.
+func (r *RedisEntry) onQpopLines(cmd *Command) *Reply {
+	keys := cmd.StringArgs()[1:]
+
+	msgs, err := popLines(r.messageQueue, keys, &r.rotation)
+	if err != nil {
+		return ErrorReply(err)
+	}
+
+	vals := make([]interface{}, 0, len(msgs)*3)
+	for _, msg := range msgs {
+		vals = append(vals, msg.line, msg.data, msg.id)
+	}
+	return MultiBulksReply(vals)
+}
+
 func (r *RedisEntry) OnQmpop(cmd *Command) *Reply {
 	key := cmd.StringAtIndex(1)
 	n, err := cmd.IntAtIndex(2)
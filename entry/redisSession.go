@@ -159,6 +159,7 @@ func (s *Session) ReadCommand() (cmd *Command, err error) {
 		return
 	}
 	args := make([][]byte, argCount)
+	var tooLarge error
 	for i := 0; i < argCount; i++ {
 		// Read ( $<number of bytes of argument 1> CR LF )
 		err = s.skipByte('$')
@@ -173,8 +174,11 @@ func (s *Session) ReadCommand() (cmd *Command, err error) {
 		}
 
 		// Read ( <argument data> CR LF )
-		args[i] = make([]byte, argSize)
-		_, err = io.ReadFull(s, args[i])
+		args[i], err = ReadBody(s.rw, argSize, MaxBodyLength+MaxKeyLength)
+		if errorCode(err) == ErrMessageTooLarge {
+			// read the rest of the command to keep the stream in sync
+			tooLarge, err = err, nil
+		}
 		if err != nil {
 			return
 		}
@@ -184,6 +188,10 @@ func (s *Session) ReadCommand() (cmd *Command, err error) {
 			return
 		}
 	}
+	if tooLarge != nil {
+		err = tooLarge
+		return
+	}
 	cmd = NewCommand(args...)
 	return
 }
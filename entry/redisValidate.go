@@ -17,6 +17,9 @@ const (
 )
 
 var cmdrules = map[string][]interface{}{
+	// auth
+	"AUTH":    []interface{}{2, 3},
+	"PROXIED": []interface{}{1, 1},
 	// queue
 	"ADD":    []interface{}{2, 3},
 	"QADD":   []interface{}{2, 3},
@@ -24,8 +27,8 @@ var cmdrules = map[string][]interface{}{
 	"QPUSH":  []interface{}{3, 3},
 	"MSET":   []interface{}{3, -1},
 	"QMPUSH": []interface{}{3, -1},
-	"GET":    []interface{}{2, 2},
-	"QPOP":   []interface{}{2, 2},
+	"GET":    []interface{}{2, -1},
+	"QPOP":   []interface{}{2, -1},
 	"MGET":   []interface{}{3, -1},
 	"QMPOP":  []interface{}{3, -1},
 	"DEL":    []interface{}{2, 2},
@@ -36,6 +39,14 @@ var cmdrules = map[string][]interface{}{
 	"QEMPTY": []interface{}{2, 2},
 	"INFO":   []interface{}{2, 2},
 	"QINFO":  []interface{}{2, 2},
+	// list
+	"LPUSH": []interface{}{3, -1},
+	"RPUSH": []interface{}{3, -1},
+	"RPOP":  []interface{}{2, 2},
+	"LPOP":  []interface{}{2, 2},
+	"BRPOP": []interface{}{3, -1},
+	"BLPOP": []interface{}{3, -1},
+	"LLEN":  []interface{}{2, 2},
 }
 
 func verifyCommand(cmd *Command) error {
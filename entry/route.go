@@ -0,0 +1,338 @@
+package entry
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/route"
+	. "github.com/buaazp/uq/utils"
+	"github.com/garyburd/redigo/redis"
+	"google.golang.org/grpc"
+)
+
+const (
+	proxyMaxIdle     int           = 8
+	proxyIdleTimeout time.Duration = 60 * time.Second
+	proxyDialTimeout time.Duration = 10 * time.Second
+
+	// C_PROXIED marks the redis connections of the proxies, whose
+	// commands are never proxied again.
+	C_PROXIED = "proxied"
+)
+
+// ProxiedHeader marks the http requests proxied by another server, which
+// are never proxied again.
+const ProxiedHeader string = "X-Uq-Proxied"
+
+// movedError tells the client that the key is owned by the server owner.
+func movedError(owner string) error {
+	return NewError(
+		ErrMoved,
+		owner,
+	)
+}
+
+// crossError tells the client that the keys are owned by several
+// servers, so that no server serves all of them.
+func crossError() error {
+	return NewError(
+		ErrCrossOwner,
+		`route keys`,
+	)
+}
+
+// routeOwner returns the owner of the keys if it is another server, or ""
+// if they are owned by this server. The keys of several owners fail.
+func routeOwner(router *route.Router, keys []string) (string, error) {
+	owner := ""
+	for i, key := range keys {
+		o := router.Owner(key)
+		if i > 0 && o != owner {
+			return "", crossError()
+		}
+		owner = o
+	}
+	return owner, nil
+}
+
+func routeKeys(router *route.Router, krs []keyRight) (string, error) {
+	keys := make([]string, len(krs))
+	for i, kr := range krs {
+		keys[i] = kr.key
+	}
+	return routeOwner(router, keys)
+}
+
+func proxied(router *route.Router) bool {
+	return router != nil && router.Mode() == route.ModeProxy
+}
+
+// proxyTLSConfig returns the TLS config dialing the owners, which serve
+// the certificate of the config like this server. It is presented to
+// them too, and theirs are verified by the client ca of the config if
+// set, or by the system roots.
+func proxyTLSConfig(config *tls.Config) *tls.Config {
+	c := new(tls.Config)
+	c.MinVersion = tls.VersionTLS12
+	c.RootCAs = config.ClientCAs
+	if config.GetCertificate != nil {
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return config.GetCertificate(nil)
+		}
+	} else {
+		c.Certificates = config.Certificates
+	}
+	return c
+}
+
+// ====================================
+// redis
+// ====================================
+
+// route redirects the command to the owner of its keys with a redis
+// cluster like '-MOVED <slot> <addr>' error, or proxies it. The commands
+// of several owners fail with a '-CROSSSLOT' error, and the ones proxied
+// already are redirected.
+func (r *RedisEntry) route(cmd *Command) *Reply {
+	krs := redisRightKeys(cmd)
+	owner, err := routeKeys(r.router, krs)
+	if err != nil {
+		reply := ErrorReply(err)
+		reply.Value = "CROSSSLOT " + err.Error()
+		return reply
+	}
+	if owner == "" {
+		return nil
+	}
+	session, _ := cmd.GetAttribute(C_SESSION).(*Session)
+	if proxied(r.router) && (session == nil || session.GetAttribute(C_PROXIED) == nil) {
+		var u *acl.User
+		if session != nil {
+			u, _ = session.GetAttribute(C_USER).(*acl.User)
+		}
+		return r.proxy(owner, u, cmd)
+	}
+	reply := ErrorReply(movedError(owner))
+	slot := route.Slot(krs[0].key)
+	reply.Value = "MOVED " + strconv.FormatUint(uint64(slot), 10) + " " + owner
+	return reply
+}
+
+// OnProxied marks the connection as the one of a proxy.
+func (r *RedisEntry) OnProxied(session *Session) *Reply {
+	session.SetAttribute(C_PROXIED, true)
+	return StatusReply("OK")
+}
+
+// dial connects to the owner by TLS if this entry serves TLS.
+func (r *RedisEntry) dial(owner string) (redis.Conn, error) {
+	if r.tlsConfig == nil {
+		return redis.Dial("tcp", owner)
+	}
+	dialer := &net.Dialer{Timeout: proxyDialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", owner, proxyTLSConfig(r.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewConn(conn, 0, 0), nil
+}
+
+// pool returns the connections to the owner authenticated as the user,
+// who should be in the acl of the owner too. A nil user is anonymous.
+func (r *RedisEntry) pool(owner string, u *acl.User) *redis.Pool {
+	r.poolsLock.Lock()
+	defer r.poolsLock.Unlock()
+	if r.pools == nil {
+		r.pools = make(map[string]*redis.Pool)
+	}
+	key := owner
+	if u != nil {
+		key += "/" + u.Name
+	}
+	pool, ok := r.pools[key]
+	if !ok {
+		pool = &redis.Pool{
+			MaxIdle:     proxyMaxIdle,
+			IdleTimeout: proxyIdleTimeout,
+			Dial: func() (redis.Conn, error) {
+				conn, err := r.dial(owner)
+				if err != nil {
+					return nil, err
+				}
+				_, err = conn.Do("PROXIED")
+				if err == nil && u != nil {
+					_, err = conn.Do("AUTH", u.Name, u.Token)
+				}
+				if err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return conn, nil
+			},
+		}
+		r.pools[key] = pool
+	}
+	return pool
+}
+
+func (r *RedisEntry) proxy(owner string, u *acl.User, cmd *Command) *Reply {
+	conn := r.pool(owner, u).Get()
+	defer conn.Close()
+
+	args := cmd.Args()
+	params := make([]interface{}, len(args)-1)
+	for i, arg := range args[1:] {
+		params[i] = arg
+	}
+	v, err := conn.Do(string(args[0]), params...)
+	if err != nil {
+		if e, ok := err.(redis.Error); ok {
+			return ErrorReply(e)
+		}
+		return ErrorReply(NewError(
+			ErrInternalError,
+			err.Error(),
+		))
+	}
+	return redisProxyReply(v)
+}
+
+// redisProxyReply converts the reply of the owner read by redigo.
+func redisProxyReply(v interface{}) *Reply {
+	switch v := v.(type) {
+	case int64:
+		return IntegerReply(int(v))
+	case string:
+		return StatusReply(v)
+	case []interface{}:
+		bulks := make([]interface{}, len(v))
+		for i, bulk := range v {
+			if n, ok := bulk.(int64); ok {
+				bulk = int(n)
+			}
+			bulks[i] = bulk
+		}
+		return MultiBulksReply(bulks)
+	}
+	return BulkReply(v)
+}
+
+// ====================================
+// mc
+// ====================================
+
+// route redirects the request to the owner of its keys. It is never
+// proxied, and -route proxy is refused for mc.
+func (m *McEntry) route(req *Request) error {
+	owner, err := routeKeys(m.router, m.mcRightKeys(req))
+	if err != nil || owner == "" {
+		return err
+	}
+	return movedError(owner)
+}
+
+func (m *McEntry) routeBinary(req *binRequest) error {
+	owner, err := routeKeys(m.router, binRightKeys(req))
+	if err != nil || owner == "" {
+		return err
+	}
+	return movedError(owner)
+}
+
+// ====================================
+// http
+// ====================================
+
+// route redirects the request to the owner of the key with a 307, which
+// keeps the method and the body, or proxies it unless it is proxied
+// already. It returns false if the key is owned by this server.
+func (h *HttpEntry) route(w http.ResponseWriter, req *http.Request, key string) bool {
+	owner := h.router.Owner(key)
+	if owner == "" {
+		return false
+	}
+	if proxied(h.router) && req.Header.Get(ProxiedHeader) == "" {
+		h.proxy(owner).ServeHTTP(w, req)
+		return true
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	w.Header().Set("Location", scheme+"://"+owner+req.URL.RequestURI())
+	w.WriteHeader(http.StatusTemporaryRedirect)
+	return true
+}
+
+func (h *HttpEntry) proxy(owner string) *httputil.ReverseProxy {
+	h.proxiesLock.Lock()
+	defer h.proxiesLock.Unlock()
+	if h.proxies == nil {
+		h.proxies = make(map[string]*httputil.ReverseProxy)
+	}
+	proxy, ok := h.proxies[owner]
+	if !ok {
+		scheme := "http"
+		if h.tlsConfig != nil {
+			scheme = "https"
+		}
+		proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: scheme, Host: owner})
+		if h.tlsConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = proxyTLSConfig(h.tlsConfig)
+			proxy.Transport = transport
+		}
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			// the form of a v1 PUT has been parsed from the body
+			if len(req.PostForm) > 0 {
+				body := req.PostForm.Encode()
+				req.Body = ioutil.NopCloser(strings.NewReader(body))
+				req.ContentLength = int64(len(body))
+			}
+			director(req)
+			req.Header.Set(ProxiedHeader, "1")
+		}
+		h.proxies[owner] = proxy
+	}
+	return proxy
+}
+
+// ====================================
+// grpc
+// ====================================
+
+// grpcKeys returns the keys of a unary request.
+func grpcKeys(req interface{}) []string {
+	switch r := req.(type) {
+	case interface{ GetKey() string }:
+		return []string{r.GetKey()}
+	case interface{ GetId() string }:
+		return []string{r.GetId()}
+	case interface{ GetIds() []string }:
+		return r.GetIds()
+	}
+	return nil
+}
+
+// unaryRoute redirects the unary calls to the owner of their keys, which
+// is told by the status message.
+func (g *GrpcEntry) unaryRoute(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	owner, err := routeOwner(g.router, grpcKeys(req))
+	if err != nil {
+		return nil, writeErrorGrpc(err)
+	}
+	if owner != "" {
+		return nil, writeErrorGrpc(movedError(owner))
+	}
+	return handler(ctx, req)
+}
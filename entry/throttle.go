@@ -0,0 +1,135 @@
+package entry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/buaazp/uq/acl"
+	"github.com/buaazp/uq/limit"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	C_LIMIT = "limit"
+)
+
+// pushed is what a request pushes, which is checked by the limiter before
+// the request is served.
+type pushed struct {
+	key  string
+	n    int
+	size int
+}
+
+func pushedDatas(key string, datas [][]byte) *pushed {
+	p := &pushed{key: key, n: len(datas)}
+	for _, data := range datas {
+		p.size += len(data)
+	}
+	return p
+}
+
+func userName(u *acl.User) string {
+	if u == nil {
+		return ""
+	}
+	return u.Name
+}
+
+func throttle(l *limit.Limiter, c *limit.Conn, u *acl.User, p *pushed) error {
+	if l == nil || p == nil {
+		return nil
+	}
+	return l.Allow(c, userName(u), p.key, p.n, p.size)
+}
+
+// redisPushed returns what a redis command pushes.
+func redisPushed(cmd *Command) *pushed {
+	args := cmd.Args()
+	switch cmd.Name() {
+	case "SET", "QPUSH":
+		return pushedDatas(string(args[1]), args[2:3])
+	case "MSET", "QMPUSH", "LPUSH", "RPUSH":
+		return pushedDatas(string(args[1]), args[2:])
+	}
+	return nil
+}
+
+// throttle limits the pushes of the session. Throttled commands get a
+// generic ERR reply like redis does.
+func (r *RedisEntry) throttle(session *Session, cmd *Command) *Reply {
+	c, _ := session.GetAttribute(C_LIMIT).(*limit.Conn)
+	u, _ := session.GetAttribute(C_USER).(*acl.User)
+	err := throttle(r.limiter, c, u, redisPushed(cmd))
+	if err != nil {
+		reply := ErrorReply(err)
+		reply.Value = "ERR " + err.Error()
+		return reply
+	}
+	return nil
+}
+
+// mcPushed returns what a mc request pushes.
+func mcPushed(req *Request) *pushed {
+	switch req.Cmd {
+	case "set":
+		return pushedDatas(req.Keys[0], [][]byte{req.Item.Body})
+	case "ms":
+		mode, _ := metaFlag(req.Flags, 'M')
+		if strings.ToUpper(mode) != "E" {
+			return pushedDatas(req.Keys[0], [][]byte{req.Item.Body})
+		}
+	}
+	return nil
+}
+
+// binPushed returns what a binary request pushes.
+func binPushed(req *binRequest) *pushed {
+	switch req.opcode {
+	case binOpSet, binOpSetQ:
+		return pushedDatas(req.key, [][]byte{req.value})
+	}
+	return nil
+}
+
+type connLimitKey struct{}
+
+// connContext keeps the limit of a http connection in the context of its
+// requests.
+func (h *HttpEntry) connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connLimitKey{}, h.limiter.NewConn())
+}
+
+func connLimit(ctx context.Context) *limit.Conn {
+	c, _ := ctx.Value(connLimitKey{}).(*limit.Conn)
+	return c
+}
+
+func httpThrottle(l *limit.Limiter, req *http.Request, key string, datas [][]byte) error {
+	ctx := req.Context()
+	return throttle(l, connLimit(ctx), acl.FromContext(ctx), pushedDatas(key, datas))
+}
+
+// grpcStats keeps the limit of a grpc connection in the context of its
+// calls.
+type grpcStats struct {
+	g *GrpcEntry
+}
+
+func (s *grpcStats) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connLimitKey{}, s.g.limiter.NewConn())
+}
+
+func (s *grpcStats) HandleConn(ctx context.Context, st stats.ConnStats) {}
+
+func (s *grpcStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *grpcStats) HandleRPC(ctx context.Context, st stats.RPCStats) {}
+
+func grpcThrottle(l *limit.Limiter, ctx context.Context, key string, datas [][]byte) error {
+	return throttle(l, connLimit(ctx), acl.FromContext(ctx), pushedDatas(key, datas))
+}
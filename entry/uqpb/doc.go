@@ -0,0 +1,4 @@
+// Package uqpb is the generated protobuf and gRPC code of uq's gRPC entrance.
+package uqpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative uq.proto
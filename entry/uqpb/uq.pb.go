@@ -0,0 +1,1274 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: uq.proto
+
+package uqpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_uq_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Message) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Message) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type CreateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Recycle       string                 `protobuf:"bytes,2,opt,name=recycle,proto3" json:"recycle,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRequest) Reset() {
+	*x = CreateRequest{}
+	mi := &file_uq_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRequest) ProtoMessage() {}
+
+func (x *CreateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRequest.ProtoReflect.Descriptor instead.
+func (*CreateRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *CreateRequest) GetRecycle() string {
+	if x != nil {
+		return x.Recycle
+	}
+	return ""
+}
+
+type CreateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateResponse) Reset() {
+	*x = CreateResponse{}
+	mi := &file_uq_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateResponse) ProtoMessage() {}
+
+func (x *CreateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateResponse.ProtoReflect.Descriptor instead.
+func (*CreateResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{2}
+}
+
+type PushRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushRequest) Reset() {
+	*x = PushRequest{}
+	mi := &file_uq_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushRequest) ProtoMessage() {}
+
+func (x *PushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushRequest.ProtoReflect.Descriptor instead.
+func (*PushRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PushRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *PushRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type PushResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushResponse) Reset() {
+	*x = PushResponse{}
+	mi := &file_uq_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushResponse) ProtoMessage() {}
+
+func (x *PushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushResponse.ProtoReflect.Descriptor instead.
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{4}
+}
+
+type MultiPushRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Datas         [][]byte               `protobuf:"bytes,2,rep,name=datas,proto3" json:"datas,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiPushRequest) Reset() {
+	*x = MultiPushRequest{}
+	mi := &file_uq_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiPushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiPushRequest) ProtoMessage() {}
+
+func (x *MultiPushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiPushRequest.ProtoReflect.Descriptor instead.
+func (*MultiPushRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *MultiPushRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MultiPushRequest) GetDatas() [][]byte {
+	if x != nil {
+		return x.Datas
+	}
+	return nil
+}
+
+type MultiPushResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiPushResponse) Reset() {
+	*x = MultiPushResponse{}
+	mi := &file_uq_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiPushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiPushResponse) ProtoMessage() {}
+
+func (x *MultiPushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiPushResponse.ProtoReflect.Descriptor instead.
+func (*MultiPushResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{6}
+}
+
+type PopRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PopRequest) Reset() {
+	*x = PopRequest{}
+	mi := &file_uq_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PopRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PopRequest) ProtoMessage() {}
+
+func (x *PopRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PopRequest.ProtoReflect.Descriptor instead.
+func (*PopRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PopRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type MultiPopRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	N             int32                  `protobuf:"varint,2,opt,name=n,proto3" json:"n,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiPopRequest) Reset() {
+	*x = MultiPopRequest{}
+	mi := &file_uq_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiPopRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiPopRequest) ProtoMessage() {}
+
+func (x *MultiPopRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiPopRequest.ProtoReflect.Descriptor instead.
+func (*MultiPopRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *MultiPopRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *MultiPopRequest) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+type MultiPopResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiPopResponse) Reset() {
+	*x = MultiPopResponse{}
+	mi := &file_uq_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiPopResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiPopResponse) ProtoMessage() {}
+
+func (x *MultiPopResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiPopResponse.ProtoReflect.Descriptor instead.
+func (*MultiPopResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MultiPopResponse) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type ConfirmRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfirmRequest) Reset() {
+	*x = ConfirmRequest{}
+	mi := &file_uq_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmRequest) ProtoMessage() {}
+
+func (x *ConfirmRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmRequest.ProtoReflect.Descriptor instead.
+func (*ConfirmRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ConfirmRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ConfirmResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfirmResponse) Reset() {
+	*x = ConfirmResponse{}
+	mi := &file_uq_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmResponse) ProtoMessage() {}
+
+func (x *ConfirmResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmResponse.ProtoReflect.Descriptor instead.
+func (*ConfirmResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{11}
+}
+
+type MultiConfirmRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiConfirmRequest) Reset() {
+	*x = MultiConfirmRequest{}
+	mi := &file_uq_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiConfirmRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiConfirmRequest) ProtoMessage() {}
+
+func (x *MultiConfirmRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiConfirmRequest.ProtoReflect.Descriptor instead.
+func (*MultiConfirmRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *MultiConfirmRequest) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type MultiConfirmResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Errors        []string               `protobuf:"bytes,1,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MultiConfirmResponse) Reset() {
+	*x = MultiConfirmResponse{}
+	mi := &file_uq_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MultiConfirmResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiConfirmResponse) ProtoMessage() {}
+
+func (x *MultiConfirmResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiConfirmResponse.ProtoReflect.Descriptor instead.
+func (*MultiConfirmResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *MultiConfirmResponse) GetErrors() []string {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type ConsumeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Batch         int32                  `protobuf:"varint,2,opt,name=batch,proto3" json:"batch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsumeRequest) Reset() {
+	*x = ConsumeRequest{}
+	mi := &file_uq_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsumeRequest) ProtoMessage() {}
+
+func (x *ConsumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsumeRequest.ProtoReflect.Descriptor instead.
+func (*ConsumeRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ConsumeRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ConsumeRequest) GetBatch() int32 {
+	if x != nil {
+		return x.Batch
+	}
+	return 0
+}
+
+type AckRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckRequest) Reset() {
+	*x = AckRequest{}
+	mi := &file_uq_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckRequest) ProtoMessage() {}
+
+func (x *AckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckRequest.ProtoReflect.Descriptor instead.
+func (*AckRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *AckRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type AckResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Acked         uint64                 `protobuf:"varint,1,opt,name=acked,proto3" json:"acked,omitempty"`
+	Failed        map[string]string      `protobuf:"bytes,2,rep,name=failed,proto3" json:"failed,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckResponse) Reset() {
+	*x = AckResponse{}
+	mi := &file_uq_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckResponse) ProtoMessage() {}
+
+func (x *AckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckResponse.ProtoReflect.Descriptor instead.
+func (*AckResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AckResponse) GetAcked() uint64 {
+	if x != nil {
+		return x.Acked
+	}
+	return 0
+}
+
+func (x *AckResponse) GetFailed() map[string]string {
+	if x != nil {
+		return x.Failed
+	}
+	return nil
+}
+
+type StatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatRequest) Reset() {
+	*x = StatRequest{}
+	mi := &file_uq_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatRequest) ProtoMessage() {}
+
+func (x *StatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatRequest.ProtoReflect.Descriptor instead.
+func (*StatRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *StatRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type QueueStat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Lines         []*QueueStat           `protobuf:"bytes,3,rep,name=lines,proto3" json:"lines,omitempty"`
+	Recycle       string                 `protobuf:"bytes,4,opt,name=recycle,proto3" json:"recycle,omitempty"`
+	Head          uint64                 `protobuf:"varint,5,opt,name=head,proto3" json:"head,omitempty"`
+	Ihead         uint64                 `protobuf:"varint,6,opt,name=ihead,proto3" json:"ihead,omitempty"`
+	Tail          uint64                 `protobuf:"varint,7,opt,name=tail,proto3" json:"tail,omitempty"`
+	Count         uint64                 `protobuf:"varint,8,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueueStat) Reset() {
+	*x = QueueStat{}
+	mi := &file_uq_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueueStat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueueStat) ProtoMessage() {}
+
+func (x *QueueStat) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueueStat.ProtoReflect.Descriptor instead.
+func (*QueueStat) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *QueueStat) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *QueueStat) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *QueueStat) GetLines() []*QueueStat {
+	if x != nil {
+		return x.Lines
+	}
+	return nil
+}
+
+func (x *QueueStat) GetRecycle() string {
+	if x != nil {
+		return x.Recycle
+	}
+	return ""
+}
+
+func (x *QueueStat) GetHead() uint64 {
+	if x != nil {
+		return x.Head
+	}
+	return 0
+}
+
+func (x *QueueStat) GetIhead() uint64 {
+	if x != nil {
+		return x.Ihead
+	}
+	return 0
+}
+
+func (x *QueueStat) GetTail() uint64 {
+	if x != nil {
+		return x.Tail
+	}
+	return 0
+}
+
+func (x *QueueStat) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type EmptyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmptyRequest) Reset() {
+	*x = EmptyRequest{}
+	mi := &file_uq_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmptyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmptyRequest) ProtoMessage() {}
+
+func (x *EmptyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmptyRequest.ProtoReflect.Descriptor instead.
+func (*EmptyRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *EmptyRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type EmptyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmptyResponse) Reset() {
+	*x = EmptyResponse{}
+	mi := &file_uq_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmptyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmptyResponse) ProtoMessage() {}
+
+func (x *EmptyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmptyResponse.ProtoReflect.Descriptor instead.
+func (*EmptyResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{20}
+}
+
+type RemoveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveRequest) Reset() {
+	*x = RemoveRequest{}
+	mi := &file_uq_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveRequest) ProtoMessage() {}
+
+func (x *RemoveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveRequest.ProtoReflect.Descriptor instead.
+func (*RemoveRequest) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RemoveRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type RemoveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveResponse) Reset() {
+	*x = RemoveResponse{}
+	mi := &file_uq_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveResponse) ProtoMessage() {}
+
+func (x *RemoveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uq_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveResponse.ProtoReflect.Descriptor instead.
+func (*RemoveResponse) Descriptor() ([]byte, []int) {
+	return file_uq_proto_rawDescGZIP(), []int{22}
+}
+
+var File_uq_proto protoreflect.FileDescriptor
+
+const file_uq_proto_rawDesc = "" +
+	"\n" +
+	"\buq.proto\x12\x02uq\"-\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\";\n" +
+	"\rCreateRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x18\n" +
+	"\arecycle\x18\x02 \x01(\tR\arecycle\"\x10\n" +
+	"\x0eCreateResponse\"3\n" +
+	"\vPushRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"\x0e\n" +
+	"\fPushResponse\":\n" +
+	"\x10MultiPushRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05datas\x18\x02 \x03(\fR\x05datas\"\x13\n" +
+	"\x11MultiPushResponse\"\x1e\n" +
+	"\n" +
+	"PopRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"1\n" +
+	"\x0fMultiPopRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\f\n" +
+	"\x01n\x18\x02 \x01(\x05R\x01n\";\n" +
+	"\x10MultiPopResponse\x12'\n" +
+	"\bmessages\x18\x01 \x03(\v2\v.uq.MessageR\bmessages\" \n" +
+	"\x0eConfirmRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x11\n" +
+	"\x0fConfirmResponse\"'\n" +
+	"\x13MultiConfirmRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\".\n" +
+	"\x14MultiConfirmResponse\x12\x16\n" +
+	"\x06errors\x18\x01 \x03(\tR\x06errors\"8\n" +
+	"\x0eConsumeRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05batch\x18\x02 \x01(\x05R\x05batch\"\x1c\n" +
+	"\n" +
+	"AckRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x93\x01\n" +
+	"\vAckResponse\x12\x14\n" +
+	"\x05acked\x18\x01 \x01(\x04R\x05acked\x123\n" +
+	"\x06failed\x18\x02 \x03(\v2\x1b.uq.AckResponse.FailedEntryR\x06failed\x1a9\n" +
+	"\vFailedEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x1f\n" +
+	"\vStatRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"\xc6\x01\n" +
+	"\tQueueStat\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12#\n" +
+	"\x05lines\x18\x03 \x03(\v2\r.uq.QueueStatR\x05lines\x12\x18\n" +
+	"\arecycle\x18\x04 \x01(\tR\arecycle\x12\x12\n" +
+	"\x04head\x18\x05 \x01(\x04R\x04head\x12\x14\n" +
+	"\x05ihead\x18\x06 \x01(\x04R\x05ihead\x12\x12\n" +
+	"\x04tail\x18\a \x01(\x04R\x04tail\x12\x14\n" +
+	"\x05count\x18\b \x01(\x04R\x05count\" \n" +
+	"\fEmptyRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"\x0f\n" +
+	"\rEmptyResponse\"!\n" +
+	"\rRemoveRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"\x10\n" +
+	"\x0eRemoveResponse2\xd4\x04\n" +
+	"\vUnitedQueue\x12/\n" +
+	"\x06Create\x12\x11.uq.CreateRequest\x1a\x12.uq.CreateResponse\x12)\n" +
+	"\x04Push\x12\x0f.uq.PushRequest\x1a\x10.uq.PushResponse\x128\n" +
+	"\tMultiPush\x12\x14.uq.MultiPushRequest\x1a\x15.uq.MultiPushResponse\x12\"\n" +
+	"\x03Pop\x12\x0e.uq.PopRequest\x1a\v.uq.Message\x125\n" +
+	"\bMultiPop\x12\x13.uq.MultiPopRequest\x1a\x14.uq.MultiPopResponse\x122\n" +
+	"\aConfirm\x12\x12.uq.ConfirmRequest\x1a\x13.uq.ConfirmResponse\x12A\n" +
+	"\fMultiConfirm\x12\x17.uq.MultiConfirmRequest\x1a\x18.uq.MultiConfirmResponse\x12,\n" +
+	"\aConsume\x12\x12.uq.ConsumeRequest\x1a\v.uq.Message0\x01\x12(\n" +
+	"\x03Ack\x12\x0e.uq.AckRequest\x1a\x0f.uq.AckResponse(\x01\x12&\n" +
+	"\x04Stat\x12\x0f.uq.StatRequest\x1a\r.uq.QueueStat\x12,\n" +
+	"\x05Empty\x12\x10.uq.EmptyRequest\x1a\x11.uq.EmptyResponse\x12/\n" +
+	"\x06Remove\x12\x11.uq.RemoveRequest\x1a\x12.uq.RemoveResponseB!Z\x1fgithub.com/buaazp/uq/entry/uqpbb\x06proto3"
+
+var (
+	file_uq_proto_rawDescOnce sync.Once
+	file_uq_proto_rawDescData []byte
+)
+
+func file_uq_proto_rawDescGZIP() []byte {
+	file_uq_proto_rawDescOnce.Do(func() {
+		file_uq_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_uq_proto_rawDesc), len(file_uq_proto_rawDesc)))
+	})
+	return file_uq_proto_rawDescData
+}
+
+var file_uq_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
+var file_uq_proto_goTypes = []any{
+	(*Message)(nil),              // 0: uq.Message
+	(*CreateRequest)(nil),        // 1: uq.CreateRequest
+	(*CreateResponse)(nil),       // 2: uq.CreateResponse
+	(*PushRequest)(nil),          // 3: uq.PushRequest
+	(*PushResponse)(nil),         // 4: uq.PushResponse
+	(*MultiPushRequest)(nil),     // 5: uq.MultiPushRequest
+	(*MultiPushResponse)(nil),    // 6: uq.MultiPushResponse
+	(*PopRequest)(nil),           // 7: uq.PopRequest
+	(*MultiPopRequest)(nil),      // 8: uq.MultiPopRequest
+	(*MultiPopResponse)(nil),     // 9: uq.MultiPopResponse
+	(*ConfirmRequest)(nil),       // 10: uq.ConfirmRequest
+	(*ConfirmResponse)(nil),      // 11: uq.ConfirmResponse
+	(*MultiConfirmRequest)(nil),  // 12: uq.MultiConfirmRequest
+	(*MultiConfirmResponse)(nil), // 13: uq.MultiConfirmResponse
+	(*ConsumeRequest)(nil),       // 14: uq.ConsumeRequest
+	(*AckRequest)(nil),           // 15: uq.AckRequest
+	(*AckResponse)(nil),          // 16: uq.AckResponse
+	(*StatRequest)(nil),          // 17: uq.StatRequest
+	(*QueueStat)(nil),            // 18: uq.QueueStat
+	(*EmptyRequest)(nil),         // 19: uq.EmptyRequest
+	(*EmptyResponse)(nil),        // 20: uq.EmptyResponse
+	(*RemoveRequest)(nil),        // 21: uq.RemoveRequest
+	(*RemoveResponse)(nil),       // 22: uq.RemoveResponse
+	nil,                          // 23: uq.AckResponse.FailedEntry
+}
+var file_uq_proto_depIdxs = []int32{
+	0,  // 0: uq.MultiPopResponse.messages:type_name -> uq.Message
+	23, // 1: uq.AckResponse.failed:type_name -> uq.AckResponse.FailedEntry
+	18, // 2: uq.QueueStat.lines:type_name -> uq.QueueStat
+	1,  // 3: uq.UnitedQueue.Create:input_type -> uq.CreateRequest
+	3,  // 4: uq.UnitedQueue.Push:input_type -> uq.PushRequest
+	5,  // 5: uq.UnitedQueue.MultiPush:input_type -> uq.MultiPushRequest
+	7,  // 6: uq.UnitedQueue.Pop:input_type -> uq.PopRequest
+	8,  // 7: uq.UnitedQueue.MultiPop:input_type -> uq.MultiPopRequest
+	10, // 8: uq.UnitedQueue.Confirm:input_type -> uq.ConfirmRequest
+	12, // 9: uq.UnitedQueue.MultiConfirm:input_type -> uq.MultiConfirmRequest
+	14, // 10: uq.UnitedQueue.Consume:input_type -> uq.ConsumeRequest
+	15, // 11: uq.UnitedQueue.Ack:input_type -> uq.AckRequest
+	17, // 12: uq.UnitedQueue.Stat:input_type -> uq.StatRequest
+	19, // 13: uq.UnitedQueue.Empty:input_type -> uq.EmptyRequest
+	21, // 14: uq.UnitedQueue.Remove:input_type -> uq.RemoveRequest
+	2,  // 15: uq.UnitedQueue.Create:output_type -> uq.CreateResponse
+	4,  // 16: uq.UnitedQueue.Push:output_type -> uq.PushResponse
+	6,  // 17: uq.UnitedQueue.MultiPush:output_type -> uq.MultiPushResponse
+	0,  // 18: uq.UnitedQueue.Pop:output_type -> uq.Message
+	9,  // 19: uq.UnitedQueue.MultiPop:output_type -> uq.MultiPopResponse
+	11, // 20: uq.UnitedQueue.Confirm:output_type -> uq.ConfirmResponse
+	13, // 21: uq.UnitedQueue.MultiConfirm:output_type -> uq.MultiConfirmResponse
+	0,  // 22: uq.UnitedQueue.Consume:output_type -> uq.Message
+	16, // 23: uq.UnitedQueue.Ack:output_type -> uq.AckResponse
+	18, // 24: uq.UnitedQueue.Stat:output_type -> uq.QueueStat
+	20, // 25: uq.UnitedQueue.Empty:output_type -> uq.EmptyResponse
+	22, // 26: uq.UnitedQueue.Remove:output_type -> uq.RemoveResponse
+	15, // [15:27] is the sub-list for method output_type
+	3,  // [3:15] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_uq_proto_init() }
+func file_uq_proto_init() {
+	if File_uq_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_uq_proto_rawDesc), len(file_uq_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   24,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_uq_proto_goTypes,
+		DependencyIndexes: file_uq_proto_depIdxs,
+		MessageInfos:      file_uq_proto_msgTypes,
+	}.Build()
+	File_uq_proto = out.File
+	file_uq_proto_goTypes = nil
+	file_uq_proto_depIdxs = nil
+}
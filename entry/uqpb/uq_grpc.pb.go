@@ -0,0 +1,590 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: uq.proto
+
+package uqpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	UnitedQueue_Create_FullMethodName       = "/uq.UnitedQueue/Create"
+	UnitedQueue_Push_FullMethodName         = "/uq.UnitedQueue/Push"
+	UnitedQueue_MultiPush_FullMethodName    = "/uq.UnitedQueue/MultiPush"
+	UnitedQueue_Pop_FullMethodName          = "/uq.UnitedQueue/Pop"
+	UnitedQueue_MultiPop_FullMethodName     = "/uq.UnitedQueue/MultiPop"
+	UnitedQueue_Confirm_FullMethodName      = "/uq.UnitedQueue/Confirm"
+	UnitedQueue_MultiConfirm_FullMethodName = "/uq.UnitedQueue/MultiConfirm"
+	UnitedQueue_Consume_FullMethodName      = "/uq.UnitedQueue/Consume"
+	UnitedQueue_Ack_FullMethodName          = "/uq.UnitedQueue/Ack"
+	UnitedQueue_Stat_FullMethodName         = "/uq.UnitedQueue/Stat"
+	UnitedQueue_Empty_FullMethodName        = "/uq.UnitedQueue/Empty"
+	UnitedQueue_Remove_FullMethodName       = "/uq.UnitedQueue/Remove"
+)
+
+// UnitedQueueClient is the client API for UnitedQueue service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UnitedQueueClient interface {
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error)
+	MultiPush(ctx context.Context, in *MultiPushRequest, opts ...grpc.CallOption) (*MultiPushResponse, error)
+	Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*Message, error)
+	MultiPop(ctx context.Context, in *MultiPopRequest, opts ...grpc.CallOption) (*MultiPopResponse, error)
+	Confirm(ctx context.Context, in *ConfirmRequest, opts ...grpc.CallOption) (*ConfirmResponse, error)
+	MultiConfirm(ctx context.Context, in *MultiConfirmRequest, opts ...grpc.CallOption) (*MultiConfirmResponse, error)
+	Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (UnitedQueue_ConsumeClient, error)
+	Ack(ctx context.Context, opts ...grpc.CallOption) (UnitedQueue_AckClient, error)
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*QueueStat, error)
+	Empty(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyResponse, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+}
+
+type unitedQueueClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUnitedQueueClient(cc grpc.ClientConnInterface) UnitedQueueClient {
+	return &unitedQueueClient{cc}
+}
+
+func (c *unitedQueueClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_Create_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PushResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_Push_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) MultiPush(ctx context.Context, in *MultiPushRequest, opts ...grpc.CallOption) (*MultiPushResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiPushResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_MultiPush_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Pop(ctx context.Context, in *PopRequest, opts ...grpc.CallOption) (*Message, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Message)
+	err := c.cc.Invoke(ctx, UnitedQueue_Pop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) MultiPop(ctx context.Context, in *MultiPopRequest, opts ...grpc.CallOption) (*MultiPopResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiPopResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_MultiPop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Confirm(ctx context.Context, in *ConfirmRequest, opts ...grpc.CallOption) (*ConfirmResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfirmResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_Confirm_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) MultiConfirm(ctx context.Context, in *MultiConfirmRequest, opts ...grpc.CallOption) (*MultiConfirmResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiConfirmResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_MultiConfirm_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (UnitedQueue_ConsumeClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UnitedQueue_ServiceDesc.Streams[0], UnitedQueue_Consume_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &unitedQueueConsumeClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UnitedQueue_ConsumeClient interface {
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type unitedQueueConsumeClient struct {
+	grpc.ClientStream
+}
+
+func (x *unitedQueueConsumeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *unitedQueueClient) Ack(ctx context.Context, opts ...grpc.CallOption) (UnitedQueue_AckClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UnitedQueue_ServiceDesc.Streams[1], UnitedQueue_Ack_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &unitedQueueAckClient{ClientStream: stream}
+	return x, nil
+}
+
+type UnitedQueue_AckClient interface {
+	Send(*AckRequest) error
+	CloseAndRecv() (*AckResponse, error)
+	grpc.ClientStream
+}
+
+type unitedQueueAckClient struct {
+	grpc.ClientStream
+}
+
+func (x *unitedQueueAckClient) Send(m *AckRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *unitedQueueAckClient) CloseAndRecv() (*AckResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(AckResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *unitedQueueClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*QueueStat, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueueStat)
+	err := c.cc.Invoke(ctx, UnitedQueue_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Empty(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EmptyResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_Empty_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *unitedQueueClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, UnitedQueue_Remove_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UnitedQueueServer is the server API for UnitedQueue service.
+// All implementations must embed UnimplementedUnitedQueueServer
+// for forward compatibility
+type UnitedQueueServer interface {
+	Create(context.Context, *CreateRequest) (*CreateResponse, error)
+	Push(context.Context, *PushRequest) (*PushResponse, error)
+	MultiPush(context.Context, *MultiPushRequest) (*MultiPushResponse, error)
+	Pop(context.Context, *PopRequest) (*Message, error)
+	MultiPop(context.Context, *MultiPopRequest) (*MultiPopResponse, error)
+	Confirm(context.Context, *ConfirmRequest) (*ConfirmResponse, error)
+	MultiConfirm(context.Context, *MultiConfirmRequest) (*MultiConfirmResponse, error)
+	Consume(*ConsumeRequest, UnitedQueue_ConsumeServer) error
+	Ack(UnitedQueue_AckServer) error
+	Stat(context.Context, *StatRequest) (*QueueStat, error)
+	Empty(context.Context, *EmptyRequest) (*EmptyResponse, error)
+	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	mustEmbedUnimplementedUnitedQueueServer()
+}
+
+// UnimplementedUnitedQueueServer must be embedded to have forward compatible implementations.
+type UnimplementedUnitedQueueServer struct {
+}
+
+func (UnimplementedUnitedQueueServer) Create(context.Context, *CreateRequest) (*CreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedUnitedQueueServer) Push(context.Context, *PushRequest) (*PushResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (UnimplementedUnitedQueueServer) MultiPush(context.Context, *MultiPushRequest) (*MultiPushResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiPush not implemented")
+}
+func (UnimplementedUnitedQueueServer) Pop(context.Context, *PopRequest) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pop not implemented")
+}
+func (UnimplementedUnitedQueueServer) MultiPop(context.Context, *MultiPopRequest) (*MultiPopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiPop not implemented")
+}
+func (UnimplementedUnitedQueueServer) Confirm(context.Context, *ConfirmRequest) (*ConfirmResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Confirm not implemented")
+}
+func (UnimplementedUnitedQueueServer) MultiConfirm(context.Context, *MultiConfirmRequest) (*MultiConfirmResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiConfirm not implemented")
+}
+func (UnimplementedUnitedQueueServer) Consume(*ConsumeRequest, UnitedQueue_ConsumeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Consume not implemented")
+}
+func (UnimplementedUnitedQueueServer) Ack(UnitedQueue_AckServer) error {
+	return status.Errorf(codes.Unimplemented, "method Ack not implemented")
+}
+func (UnimplementedUnitedQueueServer) Stat(context.Context, *StatRequest) (*QueueStat, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedUnitedQueueServer) Empty(context.Context, *EmptyRequest) (*EmptyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Empty not implemented")
+}
+func (UnimplementedUnitedQueueServer) Remove(context.Context, *RemoveRequest) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedUnitedQueueServer) mustEmbedUnimplementedUnitedQueueServer() {}
+
+// UnsafeUnitedQueueServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UnitedQueueServer will
+// result in compilation errors.
+type UnsafeUnitedQueueServer interface {
+	mustEmbedUnimplementedUnitedQueueServer()
+}
+
+func RegisterUnitedQueueServer(s grpc.ServiceRegistrar, srv UnitedQueueServer) {
+	s.RegisterService(&UnitedQueue_ServiceDesc, srv)
+}
+
+func _UnitedQueue_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Push_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_MultiPush_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiPushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).MultiPush(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_MultiPush_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).MultiPush(ctx, req.(*MultiPushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Pop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Pop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Pop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Pop(ctx, req.(*PopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_MultiPop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiPopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).MultiPop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_MultiPop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).MultiPop(ctx, req.(*MultiPopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Confirm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfirmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Confirm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Confirm_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Confirm(ctx, req.(*ConfirmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_MultiConfirm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiConfirmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).MultiConfirm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_MultiConfirm_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).MultiConfirm(ctx, req.(*MultiConfirmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Consume_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsumeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UnitedQueueServer).Consume(m, &unitedQueueConsumeServer{ServerStream: stream})
+}
+
+type UnitedQueue_ConsumeServer interface {
+	Send(*Message) error
+	grpc.ServerStream
+}
+
+type unitedQueueConsumeServer struct {
+	grpc.ServerStream
+}
+
+func (x *unitedQueueConsumeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _UnitedQueue_Ack_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UnitedQueueServer).Ack(&unitedQueueAckServer{ServerStream: stream})
+}
+
+type UnitedQueue_AckServer interface {
+	SendAndClose(*AckResponse) error
+	Recv() (*AckRequest, error)
+	grpc.ServerStream
+}
+
+type unitedQueueAckServer struct {
+	grpc.ServerStream
+}
+
+func (x *unitedQueueAckServer) SendAndClose(m *AckResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *unitedQueueAckServer) Recv() (*AckRequest, error) {
+	m := new(AckRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _UnitedQueue_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Empty_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Empty(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Empty_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Empty(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UnitedQueue_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UnitedQueueServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UnitedQueue_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UnitedQueueServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UnitedQueue_ServiceDesc is the grpc.ServiceDesc for UnitedQueue service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UnitedQueue_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "uq.UnitedQueue",
+	HandlerType: (*UnitedQueueServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _UnitedQueue_Create_Handler,
+		},
+		{
+			MethodName: "Push",
+			Handler:    _UnitedQueue_Push_Handler,
+		},
+		{
+			MethodName: "MultiPush",
+			Handler:    _UnitedQueue_MultiPush_Handler,
+		},
+		{
+			MethodName: "Pop",
+			Handler:    _UnitedQueue_Pop_Handler,
+		},
+		{
+			MethodName: "MultiPop",
+			Handler:    _UnitedQueue_MultiPop_Handler,
+		},
+		{
+			MethodName: "Confirm",
+			Handler:    _UnitedQueue_Confirm_Handler,
+		},
+		{
+			MethodName: "MultiConfirm",
+			Handler:    _UnitedQueue_MultiConfirm_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _UnitedQueue_Stat_Handler,
+		},
+		{
+			MethodName: "Empty",
+			Handler:    _UnitedQueue_Empty_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _UnitedQueue_Remove_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Consume",
+			Handler:       _UnitedQueue_Consume_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Ack",
+			Handler:       _UnitedQueue_Ack_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "uq.proto",
+}
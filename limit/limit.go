@@ -0,0 +1,232 @@
+package limit
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+// Rate limits the messages and the bytes pushed per second. A zero field
+// is unlimited.
+type Rate struct {
+	Messages float64
+	Bytes    float64
+}
+
+// ParseRate parses a rate like '<messages>[:<bytes>]', e.g. '100:1048576'
+// for 100 messages and 1MB per second, or ':1048576' for the bytes only.
+func ParseRate(s string) (Rate, error) {
+	var r Rate
+	if s == "" {
+		return r, nil
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+	var err error
+	if parts[0] != "" {
+		r.Messages, err = strconv.ParseFloat(parts[0], 64)
+		if err != nil || r.Messages < 0 {
+			return r, NewError(
+				ErrBadRequest,
+				`bad messages rate: `+s,
+			)
+		}
+	}
+	if len(parts) == 2 && parts[1] != "" {
+		r.Bytes, err = strconv.ParseFloat(parts[1], 64)
+		if err != nil || r.Bytes < 0 {
+			return r, NewError(
+				ErrBadRequest,
+				`bad bytes rate: `+s,
+			)
+		}
+	}
+	return r, nil
+}
+
+func (r Rate) unlimited() bool {
+	return r.Messages == 0 && r.Bytes == 0
+}
+
+// bucket is a token bucket holding one second of tokens at most.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, now time.Time) *bucket {
+	if rate == 0 {
+		return nil
+	}
+	return &bucket{rate, rate, now}
+}
+
+// ready refills the bucket and reports if n tokens can be taken. A request
+// larger than the bucket is taken as soon as the bucket is full, and the
+// debt is paid by the following requests.
+func (b *bucket) ready(n float64, now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	if n > b.rate {
+		n = b.rate
+	}
+	return b.tokens >= n
+}
+
+func (b *bucket) take(n float64) {
+	if b != nil {
+		b.tokens -= n
+	}
+}
+
+type buckets struct {
+	messages *bucket
+	bytes    *bucket
+}
+
+func newBuckets(r Rate, now time.Time) *buckets {
+	return &buckets{newBucket(r.Messages, now), newBucket(r.Bytes, now)}
+}
+
+func (b *buckets) ready(n, size int, now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	return b.messages.ready(float64(n), now) && b.bytes.ready(float64(size), now)
+}
+
+func (b *buckets) take(n, size int) {
+	if b != nil {
+		b.messages.take(float64(n))
+		b.bytes.take(float64(size))
+	}
+}
+
+// Conn is the limit of a connection.
+type Conn struct {
+	b *buckets
+}
+
+// Limiter limits the pushes of every connection, every authenticated client
+// and every topic.
+type Limiter struct {
+	conn   Rate
+	client Rate
+	topic  Rate
+
+	mu        sync.Mutex
+	clients   map[string]*buckets
+	topics    map[string]*buckets
+	throttled map[string]uint64
+}
+
+func New(conn, client, topic Rate) *Limiter {
+	l := new(Limiter)
+	l.conn = conn
+	l.client = client
+	l.topic = topic
+	l.clients = make(map[string]*buckets)
+	l.topics = make(map[string]*buckets)
+	l.throttled = make(map[string]uint64)
+	return l
+}
+
+// NewConn returns the limit of a new connection. It is nil if the
+// connections are unlimited.
+func (l *Limiter) NewConn() *Conn {
+	if l == nil || l.conn.unlimited() {
+		return nil
+	}
+	return &Conn{newBuckets(l.conn, time.Now())}
+}
+
+func topicOf(key string) string {
+	return strings.SplitN(strings.Trim(key, "/"), "/", 2)[0]
+}
+
+// Allow takes n messages of size bytes pushed to the key by the connection
+// and the client, which is the name of the authenticated user or empty. It
+// returns ErrTooManyRequests if any of the limits is exceeded, and nothing
+// is taken then. A nil limiter allows everything.
+func (l *Limiter) Allow(c *Conn, client, key string, n, size int) error {
+	if l == nil {
+		return nil
+	}
+
+	now := time.Now()
+	topic := topicOf(key)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var cb, ub, tb *buckets
+	if c != nil {
+		cb = c.b
+	}
+	if client != "" && !l.client.unlimited() {
+		ub = l.clients[client]
+		if ub == nil {
+			ub = newBuckets(l.client, now)
+			l.clients[client] = ub
+		}
+	}
+	if !l.topic.unlimited() {
+		tb = l.topics[topic]
+		if tb == nil {
+			tb = newBuckets(l.topic, now)
+			l.topics[topic] = tb
+		}
+	}
+
+	var cause string
+	if !cb.ready(n, size, now) {
+		cause = `connection rate exceeded`
+	} else if !ub.ready(n, size, now) {
+		cause = `client rate of ` + client + ` exceeded`
+	} else if !tb.ready(n, size, now) {
+		cause = `topic rate of ` + topic + ` exceeded`
+	}
+	if cause != "" {
+		l.throttled[topic] += uint64(n)
+		return NewError(
+			ErrTooManyRequests,
+			cause,
+		)
+	}
+
+	cb.take(n, size)
+	ub.take(n, size)
+	tb.take(n, size)
+	return nil
+}
+
+// Throttled returns the number of messages of the topic rejected by the
+// limits.
+func (l *Limiter) Throttled(topic string) uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throttled[topic]
+}
+
+// Forget drops the limits and the counter of a removed topic.
+func (l *Limiter) Forget(topic string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.topics, topic)
+	delete(l.throttled, topic)
+}
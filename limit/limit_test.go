@@ -0,0 +1,66 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func errorCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.ErrorCode
+	}
+	return 0
+}
+
+func TestParseRate(t *testing.T) {
+	Convey("Test Parse Rate", t, func() {
+		r, err := ParseRate("100:1024")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, Rate{100, 1024})
+		r, err = ParseRate(":1024")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, Rate{0, 1024})
+		r, err = ParseRate("0.5")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, Rate{0.5, 0})
+		_, err = ParseRate("fast")
+		So(err, ShouldNotBeNil)
+		_, err = ParseRate("1:-1")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAllow(t *testing.T) {
+	Convey("Test Allow", t, func() {
+		var nilLimiter *Limiter
+		So(nilLimiter.Allow(nil, "", "foo", 1, 1), ShouldBeNil)
+
+		l := New(Rate{Messages: 2}, Rate{Bytes: 10}, Rate{Messages: 20})
+		c := l.NewConn()
+		So(l.Allow(c, "alice", "foo", 2, 2), ShouldBeNil)
+		err := l.Allow(c, "alice", "foo", 1, 1)
+		So(errorCode(err), ShouldEqual, ErrTooManyRequests)
+
+		// the client limit is shared by the connections of alice
+		c2 := l.NewConn()
+		So(l.Allow(c2, "alice", "foo", 1, 8), ShouldBeNil)
+		err = l.Allow(c2, "alice", "foo/x", 1, 1)
+		So(errorCode(err), ShouldEqual, ErrTooManyRequests)
+		So(l.Allow(c2, "", "foo", 1, 1), ShouldBeNil)
+		So(l.Throttled("foo"), ShouldEqual, 2)
+
+		// a batch larger than the bucket passes when the bucket is full
+		c3 := l.NewConn()
+		So(l.Allow(c3, "", "bar", 5, 5), ShouldBeNil)
+		So(l.Allow(c3, "", "bar", 1, 1), ShouldNotBeNil)
+
+		time.Sleep(time.Second)
+		So(l.Allow(c, "alice", "foo", 1, 1), ShouldBeNil)
+
+		l.Forget("foo")
+		So(l.Throttled("foo"), ShouldEqual, 0)
+	})
+}
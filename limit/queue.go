@@ -0,0 +1,38 @@
+package limit
+
+import (
+	"strings"
+
+	"github.com/buaazp/uq/queue"
+)
+
+type limitedQueue struct {
+	queue.MessageQueue
+	limiter *Limiter
+}
+
+// NewQueue wraps the message queue to report the messages throttled by
+// the limiter in the topic stats.
+func NewQueue(mq queue.MessageQueue, l *Limiter) queue.MessageQueue {
+	return &limitedQueue{mq, l}
+}
+
+func isTopicKey(key string) bool {
+	return !strings.Contains(strings.Trim(key, "/"), "/")
+}
+
+func (q *limitedQueue) Stat(key string) (*queue.QueueStat, error) {
+	qs, err := q.MessageQueue.Stat(key)
+	if err == nil && qs.Type == "topic" {
+		qs.Throttled = q.limiter.Throttled(qs.Name)
+	}
+	return qs, err
+}
+
+func (q *limitedQueue) Remove(key string) error {
+	err := q.MessageQueue.Remove(key)
+	if err == nil && isTopicKey(key) {
+		q.limiter.Forget(topicOf(key))
+	}
+	return err
+}
@@ -8,10 +8,15 @@ type MessageQueue interface {
 	MultiPop(key string, n int) ([]string, [][]byte, error)
 	Confirm(key string) error
 	MultiConfirm(keys []string) []error
+	// the media types of the messages pushed over http
+	PushType(key string, data []byte, mediaType string) error
+	PopType(key string) (string, []byte, string, error)
+	MultiPopType(key string, n int) ([]string, [][]byte, []string, error)
 	// admin functions
 	Create(key, recycle string) error
 	Empty(key string) error
 	Remove(key string) error
 	Stat(key string) (*QueueStat, error)
+	Topics() []string
 	Close()
 }
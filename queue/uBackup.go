@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/buaazp/uq/store"
+	. "github.com/buaazp/uq/utils"
+)
+
+// Backup writes a snapshot of the queue to w as a tar.gz archive. Each key
+// of the storage is an entry, named by the key path escaped. The topics
+// and lines are exported first, so the snapshot has their latest state,
+// but the consumers may get the messages popped since again after it is
+// restored.
+func (u *UnitedQueue) Backup(w io.Writer) error {
+	snapshotter, ok := u.storage.(store.Snapshotter)
+	if !ok {
+		return NewError(
+			ErrInternalError,
+			`storage can not snapshot`,
+		)
+	}
+
+	err := u.exportTopics()
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	var n int
+	err = snapshotter.Snapshot(func(key string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    url.PathEscape(key),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		n++
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gw.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("uq backup %d keys succ.", n)
+	return nil
+}
+
+// Restore writes the keys of the archive made by Backup to the storage,
+// which NewUnitedQueue then loads the queue from. The storage should be
+// blank.
+func Restore(storage store.Storage, r io.Reader) error {
+	if _, err := storage.Get(StorageKeyWord); err == nil {
+		return errors.New("restore to a storage not blank")
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	// the queue key is written last, so that a storage restored partly
+	// is still blank
+	var queueData []byte
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key, err := url.PathUnescape(hdr.Name)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if key == StorageKeyWord {
+			queueData = data
+			continue
+		}
+		err = storage.Set(key, data)
+		if err != nil {
+			return err
+		}
+	}
+	if queueData == nil {
+		// a blank queue
+		return nil
+	}
+	return storage.Set(StorageKeyWord, queueData)
+}
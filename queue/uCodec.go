@@ -0,0 +1,272 @@
+package queue
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone   string = ""
+	CompressionSnappy string = "snappy"
+	CompressionZstd   string = "zstd"
+
+	DefaultChunkSize int = 1024 * 1024
+)
+
+// The formats of the messages stored by a topic. Topics created before the
+// encoding keep their raw messages.
+const (
+	topicFormatRaw int = iota
+	topicFormatEncoded
+)
+
+// The header byte of an encoded message holds the codec in the low bits
+// and the chunked, typed and timed flags. The raw size follows as an
+// uvarint, then the count of chunks stored under the chunk keys if
+// chunked, the push time in unix nanoseconds if timed, and the length and
+// the media type if typed, then the payload if not chunked. The messages
+// stored before the push time have no timed flag.
+const (
+	codecNone   byte = 0
+	codecSnappy byte = 1
+	codecZstd   byte = 2
+
+	codecMask   byte = 0x0f
+	flagTyped   byte = 0x20
+	flagTimed   byte = 0x40
+	flagChunked byte = 0x80
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+func codecOf(compression string) byte {
+	switch compression {
+	case CompressionSnappy:
+		return codecSnappy
+	case CompressionZstd:
+		return codecZstd
+	}
+	return codecNone
+}
+
+func compress(codec byte, data []byte) []byte {
+	switch codec {
+	case codecSnappy:
+		return snappy.Encode(nil, data)
+	case codecZstd:
+		zstdOnce.Do(initZstd)
+		return zstdEncoder.EncodeAll(data, nil)
+	}
+	return data
+}
+
+func decompress(codec byte, data []byte) ([]byte, error) {
+	var err error
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecSnappy:
+		data, err = snappy.Decode(nil, data)
+	case codecZstd:
+		zstdOnce.Do(initZstd)
+		data, err = zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, NewError(
+			ErrInternalError,
+			`unknown message codec `+strconv.Itoa(int(codec)),
+		)
+	}
+	if err != nil {
+		return nil, NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	return data, nil
+}
+
+// messageMeta is kept with a message besides its data.
+type messageMeta struct {
+	pushed    int64  // the push time in unix nanoseconds, or 0 if unknown
+	mediaType string // the content type pushed over http, or blank
+}
+
+// messageHeader is the decoded header of a stored message.
+type messageHeader struct {
+	messageMeta
+	codec   byte
+	size    uint64 // the raw size of the message
+	chunks  uint64 // the count of chunks, or 0 if not chunked
+	payload []byte
+}
+
+func encodeHeader(flags byte, size, chunks uint64, meta messageMeta) []byte {
+	buf := make([]byte, 1+4*binary.MaxVarintLen64+len(meta.mediaType))
+	buf[0] = flags | flagTimed
+	n := 1 + binary.PutUvarint(buf[1:], size)
+	if flags&flagChunked != 0 {
+		n += binary.PutUvarint(buf[n:], chunks)
+	}
+	n += binary.PutUvarint(buf[n:], uint64(meta.pushed))
+	if meta.mediaType != "" {
+		buf[0] |= flagTyped
+		n += binary.PutUvarint(buf[n:], uint64(len(meta.mediaType)))
+		n += copy(buf[n:], meta.mediaType)
+	}
+	return buf[:n]
+}
+
+func decodeHeader(value []byte) (*messageHeader, error) {
+	bad := NewError(
+		ErrInternalError,
+		`bad message header`,
+	)
+	if len(value) < 1 {
+		return nil, bad
+	}
+	h := &messageHeader{codec: value[0] & codecMask}
+	size, n := binary.Uvarint(value[1:])
+	if n <= 0 {
+		return nil, bad
+	}
+	h.size = size
+	pos := 1 + n
+	if value[0]&flagChunked != 0 {
+		chunks, n := binary.Uvarint(value[pos:])
+		if n <= 0 || chunks == 0 {
+			return nil, bad
+		}
+		h.chunks = chunks
+		pos += n
+	}
+	if value[0]&flagTimed != 0 {
+		pushed, n := binary.Uvarint(value[pos:])
+		if n <= 0 {
+			return nil, bad
+		}
+		h.pushed = int64(pushed)
+		pos += n
+	}
+	if value[0]&flagTyped != 0 {
+		size, n := binary.Uvarint(value[pos:])
+		if n <= 0 || uint64(len(value)-pos-n) < size {
+			return nil, bad
+		}
+		pos += n
+		h.mediaType = string(value[pos : pos+int(size)])
+		pos += int(size)
+	}
+	if h.chunks == 0 {
+		h.payload = value[pos:]
+	}
+	return h, nil
+}
+
+func chunkKey(key string, i uint64) string {
+	return Acatui(key, ":", i)
+}
+
+// encodeMessage compresses the data by the compression of the topic and
+// stores it under the key, split into chunks if larger than the chunk
+// size of the queue. The chunks are stored before the key.
+func (t *topic) encodeMessage(key string, data []byte) error {
+	return t.encodeMessageMeta(key, data, messageMeta{pushed: time.Now().UnixNano()})
+}
+
+// encodeMessageMeta encodes the message with its meta, like the push time
+// of an imported one.
+func (t *topic) encodeMessageMeta(key string, data []byte, meta messageMeta) error {
+	codec := codecOf(t.getOptions().Compression)
+	payload := compress(codec, data)
+	size := uint64(len(data))
+
+	chunkSize := t.q.chunkSize
+	if chunkSize <= 0 || len(payload) <= chunkSize {
+		header := encodeHeader(codec, size, 0, meta)
+		return t.q.setData(key, append(header, payload...))
+	}
+
+	var chunks uint64
+	for start := 0; start < len(payload); start += chunkSize {
+		end := start + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunks++
+		err := t.q.setData(chunkKey(key, chunks), payload[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return t.q.setData(key, encodeHeader(codec|flagChunked, size, chunks, meta))
+}
+
+func (t *topic) decodeMessage(key string) ([]byte, error) {
+	data, _, err := t.decodeMessageMeta(key)
+	return data, err
+}
+
+// decodeMessageMeta decodes the message stored under the key with its
+// meta.
+func (t *topic) decodeMessageMeta(key string) ([]byte, messageMeta, error) {
+	value, err := t.q.getData(key)
+	if err != nil {
+		return nil, messageMeta{}, err
+	}
+	h, err := decodeHeader(value)
+	if err != nil {
+		return nil, messageMeta{}, err
+	}
+
+	payload := h.payload
+	if h.chunks > 0 {
+		payload = make([]byte, 0, h.size)
+		for i := uint64(1); i <= h.chunks; i++ {
+			chunk, err := t.q.getData(chunkKey(key, i))
+			if err != nil {
+				return nil, messageMeta{}, err
+			}
+			payload = append(payload, chunk...)
+		}
+	}
+	data, err := decompress(h.codec, payload)
+	if err != nil {
+		return nil, messageMeta{}, err
+	}
+	return data, h.messageMeta, nil
+}
+
+// deleteMessage deletes the message stored under the key with its chunks,
+// and returns its raw size.
+func (t *topic) deleteMessage(key string) (uint64, error) {
+	value, err := t.q.getData(key)
+	if err != nil {
+		return 0, err
+	}
+	h, err := decodeHeader(value)
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(1); i <= h.chunks; i++ {
+		err = t.q.delData(chunkKey(key, i))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return h.size, t.q.delData(key)
+}
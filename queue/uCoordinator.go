@@ -0,0 +1,298 @@
+package queue
+
+import (
+	"log"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	EventCreate string = "create"
+	EventRemove string = "remove"
+
+	CoordRegisterDelay    time.Duration = 3 * time.Second
+	CoordRegisterInterval time.Duration = 60 * time.Second
+	CoordWatchDelay       time.Duration = 3 * time.Second
+)
+
+// Event is a change of the topics and lines registered in the cluster.
+// The key is a topic or topic/line, and the value is the recycle of a line.
+type Event struct {
+	Type  string
+	Key   string
+	Value string
+}
+
+// Coordinator registers the servers, topics and lines of a cluster, so
+// that all the servers have the same topics and lines.
+type Coordinator interface {
+	// Register registers the server with the address of its admin
+	// server, blank if none, for a while. It is called every
+	// CoordRegisterInterval to keep the server alive.
+	Register(addr, admin string) error
+	UnRegister(addr string) error
+	// Servers lists the alive servers.
+	Servers() ([]string, error)
+	// Admins lists the admin servers registered by the alive servers.
+	Admins() ([]string, error)
+
+	// The topics and lines are registered and unregistered by compare
+	// and swap, so that only one of the servers racing wins. The others
+	// get ErrTopicExisted or ErrLineExisted, and ErrTopicNotExisted or
+	// ErrLineNotExisted if it is not registered. A line is registered
+	// only if its topic is, and unregistering a topic unregisters its
+	// lines too. The options of a topic are stored as its value.
+	RegisterTopic(topic, options string) error
+	UnRegisterTopic(topic string) error
+	RegisterLine(topic, line, recycle string) error
+	UnRegisterLine(topic, line string) error
+
+	// Pull lists the registered topics and lines as create events, the
+	// topics before their lines. The ones removed may be listed as remove
+	// events after them.
+	Pull() ([]Event, error)
+	// Watch sends the changes to the events until stop is closed or an
+	// error occurs.
+	Watch(events chan<- Event, stop chan bool) error
+
+	Close() error
+}
+
+// SetCoordinator coordinates the queue in a cluster by c, which is closed
+// with the queue. It should be called before the queue serves, as the
+// local topics are reconciled with the cluster first.
+func (u *UnitedQueue) SetCoordinator(c Coordinator) {
+	u.coordinator = c
+	u.reconcile()
+	u.wg.Add(1)
+	go u.coordRun()
+}
+
+func (u *UnitedQueue) applyEvent(e Event) error {
+	u.registryLock.Lock()
+	defer u.registryLock.Unlock()
+	return u.apply(e)
+}
+
+// apply applies the event. The registry lock is held.
+func (u *UnitedQueue) apply(e Event) error {
+	switch e.Type {
+	case EventCreate:
+		return u.create(e.Key, e.Value, true)
+	case EventRemove:
+		return u.remove(e.Key, true)
+	}
+	return nil
+}
+
+// isError tells if err is an Error of code.
+func isError(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.ErrorCode == code
+}
+
+// registerTopics registers the local topics and lines which are not in
+// registered, like the ones loaded from the storage. The registry lock is
+// held, and the topics are listed first so that the topics lock is not
+// held while registering.
+func (u *UnitedQueue) registerTopics(registered map[string]bool) {
+	u.topicsLock.RLock()
+	topics := make(map[string]map[string]string, len(u.topics))
+	options := make(map[string]string, len(u.topics))
+	for name, t := range u.topics {
+		options[name] = t.getOptions().String()
+		lines := make(map[string]string)
+		t.linesLock.RLock()
+		for lineName, l := range t.lines {
+			lines[lineName] = l.recycle.String()
+		}
+		t.linesLock.RUnlock()
+		topics[name] = lines
+	}
+	u.topicsLock.RUnlock()
+
+	for name, lines := range topics {
+		if !registered[name] {
+			err := u.registerTopic(name, options[name])
+			if err != nil && !isError(err, ErrTopicExisted) {
+				log.Printf("register topic[%s] error: %s", name, err)
+				continue
+			}
+		}
+		for lineName, recycle := range lines {
+			if registered[name+"/"+lineName] {
+				continue
+			}
+			err := u.registerLine(name, lineName, recycle)
+			if err != nil && !isError(err, ErrLineExisted) {
+				log.Printf("register line[%s/%s] error: %s", name, lineName, err)
+			}
+		}
+	}
+}
+
+// reconcile makes the local topics and lines the same as the registered
+// ones. The ones registered are created, the ones unregistered since the
+// last pull are removed, and the local ones missing are registered.
+func (u *UnitedQueue) reconcile() error {
+	// locked before pulling, so that no topic is created or removed here
+	// before the ones pulled are applied
+	u.registryLock.Lock()
+	defer u.registryLock.Unlock()
+	events, err := u.coordinator.Pull()
+	if err != nil {
+		log.Printf("coordinator pull error: %s", err)
+		return err
+	}
+
+	registered := make(map[string]bool, len(events))
+	for _, e := range events {
+		if e.Type == EventCreate {
+			registered[e.Key] = true
+		}
+		u.apply(e)
+	}
+	u.registerTopics(registered)
+	return nil
+}
+
+// watchRun applies the changes of the cluster, and restarts the watch
+// after it fails.
+func (u *UnitedQueue) watchRun() {
+	defer u.wg.Done()
+
+	events := make(chan Event)
+	done := make(chan bool)
+	go func() {
+		for e := range events {
+			u.applyEvent(e)
+		}
+		close(done)
+	}()
+
+	for {
+		err := u.coordinator.Watch(events, u.coordStop)
+		select {
+		case <-u.coordStop:
+			close(events)
+			<-done
+			return
+		default:
+		}
+		log.Printf("coordinator watch error: %v", err)
+
+		select {
+		case <-u.coordStop:
+			close(events)
+			<-done
+			return
+		case <-time.After(CoordWatchDelay):
+			u.reconcile()
+		}
+	}
+}
+
+func (u *UnitedQueue) coordRun() {
+	defer u.wg.Done()
+
+	u.wg.Add(1)
+	go u.watchRun()
+
+	select {
+	case <-time.After(CoordRegisterDelay):
+		u.coordinator.Register(u.selfAddr, u.AdminAddr())
+	case <-u.coordStop:
+		return
+	}
+
+	ticker := time.NewTicker(CoordRegisterInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.coordinator.Register(u.selfAddr, u.AdminAddr())
+			u.reconcile()
+		case <-u.coordStop:
+			u.coordinator.UnRegister(u.selfAddr)
+			return
+		}
+	}
+}
+
+func (u *UnitedQueue) registerTopic(topic, options string) error {
+	if u.coordinator == nil {
+		return nil
+	}
+	return u.coordinator.RegisterTopic(topic, options)
+}
+
+func (u *UnitedQueue) unRegisterTopic(topic string) error {
+	if u.coordinator == nil {
+		return nil
+	}
+	return u.coordinator.UnRegisterTopic(topic)
+}
+
+// registerLine registers the line, and its topic first if the topic is
+// missing in the cluster.
+func (u *UnitedQueue) registerLine(topic, line, recycle string) error {
+	if u.coordinator == nil {
+		return nil
+	}
+	err := u.coordinator.RegisterLine(topic, line, recycle)
+	if !isError(err, ErrTopicNotExisted) {
+		return err
+	}
+	var options string
+	u.topicsLock.RLock()
+	t, ok := u.topics[topic]
+	u.topicsLock.RUnlock()
+	if ok {
+		options = t.getOptions().String()
+	}
+	err = u.coordinator.RegisterTopic(topic, options)
+	if err != nil && !isError(err, ErrTopicExisted) {
+		return err
+	}
+	return u.coordinator.RegisterLine(topic, line, recycle)
+}
+
+func (u *UnitedQueue) unRegisterLine(topic, line string) error {
+	if u.coordinator == nil {
+		return nil
+	}
+	return u.coordinator.UnRegisterLine(topic, line)
+}
+
+// Servers returns the servers registered in the cluster, or this server
+// alone without a coordinator.
+func (u *UnitedQueue) Servers() ([]string, error) {
+	if u.coordinator == nil {
+		return []string{u.selfAddr}, nil
+	}
+	return u.coordinator.Servers()
+}
+
+// SetAdminAddr sets the address of the admin server, which is registered
+// with this server in the cluster.
+func (u *UnitedQueue) SetAdminAddr(addr string) {
+	u.adminAddr.Store(addr)
+}
+
+func (u *UnitedQueue) AdminAddr() string {
+	addr, _ := u.adminAddr.Load().(string)
+	return addr
+}
+
+// Admins returns the admin servers registered in the cluster, or the one
+// of this server without a coordinator.
+func (u *UnitedQueue) Admins() ([]string, error) {
+	if u.coordinator == nil {
+		if addr := u.AdminAddr(); addr != "" {
+			return []string{addr}, nil
+		}
+		return nil, nil
+	}
+	return u.coordinator.Admins()
+}
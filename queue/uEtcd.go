@@ -1,251 +1,351 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/coreos/go-etcd/etcd"
+	. "github.com/buaazp/uq/utils"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 const (
 	EtcdUqServerListValue string        = "online"
-	EtcdTTL               uint64        = 60
-	OneSecond             uint64        = uint64(time.Second)
-	EtcdWatchDelay        time.Duration = 3 * time.Second
-	EtcdRegisterDelay     time.Duration = 3 * time.Second
+	EtcdTTL               int64         = 60
+	EtcdTimeout           time.Duration = 5 * time.Second
 )
 
-func (u *UnitedQueue) nodeCreate(node *etcd.Node) error {
-	// key: /uq/topics/foo/z
-	key := node.Key
-	name := strings.TrimPrefix(key, "/"+u.etcdKey+"/topics/")
-	recycle := node.Value
-
-	return u.create(name, recycle, true)
+var errWatchClosed = errors.New("etcd watch closed")
+
+// etcdCoordinator keeps the cluster in etcd v3 like:
+//
+//	/uq/servers/127.0.0.1:8808 = <admin address> or online (leased)
+//	/uq/topics/foo =
+//	/uq/topics/foo/z = 10s
+//
+// The servers are registered with a lease kept alive, so they are removed
+// soon after they are lost. The topics are watched from the revision last
+// pulled or watched, so no change is missed between the watches. If the
+// revision is compacted, the topics are pulled again entirely.
+type etcdCoordinator struct {
+	client *clientv3.Client
+	prefix string
+
+	mu    sync.Mutex
+	lease clientv3.LeaseID
+	rev   int64
+	known map[string]bool
 }
 
-func (u *UnitedQueue) nodeRemove(node *etcd.Node) error {
-	// key: /uq/topics/foo/z
-	key := node.Key
-	name := strings.TrimPrefix(key, "/"+u.etcdKey+"/topics/")
+// NewEtcdCoordinator coordinates the cluster named key by the etcd
+// servers.
+func NewEtcdCoordinator(servers []string, key string) (Coordinator, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   servers,
+		DialTimeout: EtcdTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := new(etcdCoordinator)
+	c.client = client
+	c.prefix = "/" + strings.Trim(key, "/")
+	c.known = make(map[string]bool)
+	return c, nil
+}
 
-	return u.remove(name, true)
+func (c *etcdCoordinator) serverKey(addr string) string {
+	return c.prefix + "/servers/" + addr
 }
 
-func (u *UnitedQueue) pullTopics() error {
-	// log.Printf("etcd pull topics start...")
+func (c *etcdCoordinator) topicKey(key string) string {
+	return c.prefix + "/topics/" + key
+}
 
-	resp, err := u.etcdClient.Get(u.etcdKey+"/topics", false, true)
-	if err != nil {
-		return err
+// keepAlive consumes the keep alive responses of the lease, and forgets
+// the lease once it is lost, so that the next Register grants another.
+func (c *etcdCoordinator) keepAlive(lease clientv3.LeaseID, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for range ch {
 	}
-
-	for _, node := range resp.Node.Nodes {
-		if node.Dir {
-			err := u.nodeCreate(node)
-			if err != nil {
-				// log.Printf("nodeCreate error: %s", err)
-				continue
-			}
-			for _, nd := range node.Nodes {
-				err := u.nodeCreate(nd)
-				if err != nil {
-					// log.Printf("nodeCreate error: %s", err)
-					continue
-				}
-			}
-		}
+	c.mu.Lock()
+	if c.lease == lease {
+		c.lease = clientv3.NoLease
 	}
-	return nil
+	c.mu.Unlock()
 }
 
-func (u *UnitedQueue) watchRun(succChan, stopChan chan bool) {
-	// log.Printf("etcd watchRun start...")
-
-	u.wg.Add(1)
-	defer u.wg.Done()
+func (c *etcdCoordinator) Register(addr, admin string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
 
-	for {
-		resp, err := u.etcdClient.Watch(u.etcdKey+"/topics", 0, true, nil, stopChan)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lease == clientv3.NoLease {
+		grant, err := c.client.Grant(ctx, EtcdTTL)
 		if err != nil {
-			if strings.Contains(err.Error(), "stop channel") {
-				close(succChan)
-			} else {
-				succChan <- false
-			}
-			// log.Printf("etcd watch error: %v", err)
-			break
+			return err
 		}
-		// log.Printf("resp: %v", resp)
-		if resp.Action == "create" || resp.Action == "set" {
-			u.nodeCreate(resp.Node)
-			// err := u.nodeCreate(resp.Node)
-			// if err != nil {
-			// 	log.Printf("nodeCreate error: %s", err)
-			// }
-		} else if resp.Action == "delete" {
-			u.nodeRemove(resp.Node)
-			// err := u.nodeRemove(resp.Node)
-			// if err != nil {
-			// 	log.Printf("nodeRemove error: %s", err)
-			// }
+		ch, err := c.client.KeepAlive(context.Background(), grant.ID)
+		if err != nil {
+			c.client.Revoke(ctx, grant.ID)
+			return err
 		}
+		c.lease = grant.ID
+		go c.keepAlive(grant.ID, ch)
+	}
+	value := admin
+	if value == "" {
+		value = EtcdUqServerListValue
 	}
+	_, err := c.client.Put(ctx, c.serverKey(addr), value, clientv3.WithLease(c.lease))
+	return err
+}
 
-	// log.Printf("watchRun stoped.")
+func (c *etcdCoordinator) UnRegister(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	lease := c.lease
+	c.lease = clientv3.NoLease
+	c.mu.Unlock()
+	if lease != clientv3.NoLease {
+		// revoking deletes the key too
+		c.client.Revoke(ctx, lease)
+	}
+	_, err := c.client.Delete(ctx, c.serverKey(addr))
+	return err
 }
 
-func (u *UnitedQueue) scanRun() {
-	// log.Printf("etcd scanRun start...")
+func (c *etcdCoordinator) Servers() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+
+	prefix := c.serverKey("")
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		servers = append(servers, strings.TrimPrefix(string(kv.Key), prefix))
+	}
+	return servers, nil
+}
 
-	u.wg.Add(1)
-	defer u.wg.Done()
+func (c *etcdCoordinator) Admins() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
 
-	stopChan := make(chan bool)
-	succChan := make(chan bool, 1)
-	succChan <- false
-	watchDelay := time.NewTicker(EtcdWatchDelay)
-	quit := false
-	for !quit {
-		select {
-		case <-watchDelay.C:
-			// log.Printf("watchRun ticked.")
-			select {
-			case succStatus := <-succChan:
-				if succStatus == false {
-					// log.Printf("watchRun not succ.")
-					go u.watchRun(succChan, stopChan)
-				}
-			default:
-				// log.Printf("watchRun succ. just passed.")
-			}
-		case <-u.etcdStop:
-			// log.Printf("scanRun stoping...")
-			quit = true
+	resp, err := c.client.Get(ctx, c.serverKey(""), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	admins := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if admin := string(kv.Value); admin != EtcdUqServerListValue {
+			admins = append(admins, admin)
 		}
 	}
+	return admins, nil
+}
 
-	close(stopChan)
-	// log.Printf("scanRun stoped.")
+// registered compares the create revision of the key. The topics and
+// lines are created and deleted by such transactions, so that only one
+// of the servers racing wins.
+func registered(key string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.CreateRevision(key), ">", 0)
 }
 
-func (u *UnitedQueue) register() error {
-	// log.Printf("etcd register self...")
+func unregistered(key string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+}
 
-	key := u.etcdKey + "/servers/" + u.selfAddr
-	_, err := u.etcdClient.Set(key, EtcdUqServerListValue, EtcdTTL)
+func (c *etcdCoordinator) RegisterTopic(topic, options string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+	key := c.topicKey(topic)
+	resp, err := c.client.Txn(ctx).If(unregistered(key)).Then(clientv3.OpPut(key, options)).Commit()
 	if err != nil {
 		return err
 	}
+	if !resp.Succeeded {
+		return NewError(
+			ErrTopicExisted,
+			`cluster registerTopic`,
+		)
+	}
 	return nil
 }
 
-func (u *UnitedQueue) unRegister() error {
-	// log.Printf("etcd unregister self...")
-
-	key := u.etcdKey + "/servers/" + u.selfAddr
-	_, err := u.etcdClient.Delete(key, true)
+// UnRegisterTopic deletes the topic and its lines at once.
+func (c *etcdCoordinator) UnRegisterTopic(topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+	key := c.topicKey(topic)
+	resp, err := c.client.Txn(ctx).If(registered(key)).Then(
+		clientv3.OpDelete(key),
+		clientv3.OpDelete(key+"/", clientv3.WithPrefix()),
+	).Commit()
 	if err != nil {
 		return err
 	}
+	if !resp.Succeeded {
+		return NewError(
+			ErrTopicNotExisted,
+			`cluster unRegisterTopic`,
+		)
+	}
 	return nil
 }
 
-func (u *UnitedQueue) etcdRun() {
-	if u.etcdClient == nil {
-		return
-	}
-
-	u.wg.Add(1)
-	defer u.wg.Done()
-
-	u.pullTopics()
-	// err := u.pullTopics()
-	// if err != nil {
-	// 	log.Printf("pull topics error: %s", err)
-	// }
-	go u.scanRun()
-
-	registerDelay := time.NewTicker(EtcdRegisterDelay)
-	select {
-	case <-registerDelay.C:
-		// log.Printf("entry succ. etcdRun first register...")
-		u.register()
-	case <-u.etcdStop:
-		// log.Printf("entry failed. etcdRun stoping...")
-		return
+func (c *etcdCoordinator) RegisterLine(topic, line, recycle string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+	topicKey := c.topicKey(topic)
+	key := c.topicKey(topic + "/" + line)
+	resp, err := c.client.Txn(ctx).
+		If(registered(topicKey), unregistered(key)).
+		Then(clientv3.OpPut(key, recycle)).
+		Else(clientv3.OpGet(topicKey, clientv3.WithCountOnly())).
+		Commit()
+	if err != nil {
+		return err
 	}
-
-	ticker := time.NewTicker(time.Duration(EtcdTTL * OneSecond))
-	quit := false
-	for !quit {
-		select {
-		case <-ticker.C:
-			// log.Printf("etcdRun ticked.")
-			u.register()
-		case <-u.etcdStop:
-			// log.Printf("etcdRun stoping...")
-			quit = true
-			break
+	if !resp.Succeeded {
+		if resp.Responses[0].GetResponseRange().Count == 0 {
+			return NewError(
+				ErrTopicNotExisted,
+				`cluster registerLine`,
+			)
 		}
+		return NewError(
+			ErrLineExisted,
+			`cluster registerLine`,
+		)
 	}
-
-	u.unRegister()
-	// log.Printf("etcdRun stoped.")
+	return nil
 }
 
-func (u *UnitedQueue) registerTopic(topic string) error {
-	if u.etcdClient == nil {
-		return nil
-	}
-	// log.Printf("etcd register topic[%s]...", topic)
-
-	topicKey := u.etcdKey + "/topics/" + topic
-	_, err := u.etcdClient.CreateDir(topicKey, 0)
+func (c *etcdCoordinator) UnRegisterLine(topic, line string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
+	key := c.topicKey(topic + "/" + line)
+	resp, err := c.client.Txn(ctx).If(registered(key)).Then(clientv3.OpDelete(key)).Commit()
 	if err != nil {
 		return err
 	}
+	if !resp.Succeeded {
+		return NewError(
+			ErrLineNotExisted,
+			`cluster unRegisterLine`,
+		)
+	}
 	return nil
 }
 
-func (u *UnitedQueue) unRegisterTopic(topic string) error {
-	if u.etcdClient == nil {
-		return nil
-	}
-	// log.Printf("etcd unregister topic[%s]...", topic)
+// Pull lists the topics and lines at the latest revision, which the
+// next watch starts after. The ones known before but deleted since are
+// listed as remove events, as their deletions may have been compacted.
+func (c *etcdCoordinator) Pull() ([]Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeout)
+	defer cancel()
 
-	topicKey := u.etcdKey + "/topics/" + topic
-	_, err := u.etcdClient.Delete(topicKey, true)
+	prefix := c.topicKey("")
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
-}
 
-func (u *UnitedQueue) registerLine(topic, line, recycle string) error {
-	if u.etcdClient == nil {
-		return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	known := make(map[string]bool, len(resp.Kvs))
+	events := make([]Event, 0, len(resp.Kvs))
+	// the keys are sorted, so the topics are before their lines
+	for _, kv := range resp.Kvs {
+		name := strings.TrimPrefix(string(kv.Key), prefix)
+		known[name] = true
+		events = append(events, Event{Type: EventCreate, Key: name, Value: string(kv.Value)})
 	}
-	// log.Printf("etcd register topic[%s]...", topic)
+	for name := range c.known {
+		if !known[name] {
+			events = append(events, Event{Type: EventRemove, Key: name})
+		}
+	}
+	c.known = known
+	c.rev = resp.Header.Revision
+	return events, nil
+}
 
-	lineKey := u.etcdKey + "/topics/" + topic + "/" + line
-	_, err := u.etcdClient.Set(lineKey, recycle, 0)
-	if err != nil {
-		return err
+// seen records the event watched at the revision.
+func (c *etcdCoordinator) seen(e Event, rev int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.Type == EventCreate {
+		c.known[e.Key] = true
+	} else {
+		delete(c.known, e.Key)
+	}
+	if rev > c.rev {
+		c.rev = rev
 	}
-	return nil
 }
 
-func (u *UnitedQueue) unRegisterLine(topic, line string) error {
-	if u.etcdClient == nil {
-		return nil
+func (c *etcdCoordinator) Watch(events chan<- Event, stop chan bool) error {
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.mu.Lock()
+	rev := c.rev
+	c.mu.Unlock()
+	prefix := c.topicKey("")
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
 	}
-	// log.Printf("etcd register topic[%s]...", topic)
 
-	lineKey := u.etcdKey + "/topics/" + topic + "/" + line
-	_, err := u.etcdClient.Delete(lineKey, false)
-	if err != nil {
-		return err
+	for resp := range c.client.Watch(ctx, prefix, opts...) {
+		// a compacted revision fails the watch, and the topics are
+		// pulled entirely before the next one
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			e := Event{Key: strings.TrimPrefix(string(ev.Kv.Key), prefix)}
+			if ev.Type == mvccpb.PUT {
+				e.Type = EventCreate
+				e.Value = string(ev.Kv.Value)
+			} else {
+				e.Type = EventRemove
+			}
+			select {
+			case events <- e:
+				c.seen(e, ev.Kv.ModRevision)
+			case <-stop:
+				return nil
+			}
+		}
 	}
-	return nil
+
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	return errWatchClosed
+}
+
+func (c *etcdCoordinator) Close() error {
+	return c.client.Close()
 }
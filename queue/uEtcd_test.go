@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/buaazp/uq/store"
+	. "github.com/buaazp/uq/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+const etcdAddr = "http://127.0.0.1:8894"
+
+// startEtcd starts an embedded etcd server in dir.
+func startEtcd(dir string) (*embed.Etcd, error) {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	client, _ := url.Parse(etcdAddr)
+	peer, _ := url.Parse("http://127.0.0.1:8895")
+	cfg.ListenClientUrls = []url.URL{*client}
+	cfg.AdvertiseClientUrls = []url.URL{*client}
+	cfg.ListenPeerUrls = []url.URL{*peer}
+	cfg.AdvertisePeerUrls = []url.URL{*peer}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.LogLevel = "error"
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+		return e, nil
+	case <-time.After(10 * time.Second):
+		e.Close()
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// watchFor watches the coordinator until n events are received.
+func watchFor(c Coordinator, n int) ([]Event, error) {
+	events := make(chan Event)
+	stop := make(chan bool)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Watch(events, stop)
+	}()
+	defer close(stop)
+
+	received := make([]Event, 0, n)
+	for len(received) < n {
+		select {
+		case e := <-events:
+			received = append(received, e)
+		case err := <-errc:
+			return received, err
+		case <-time.After(5 * time.Second):
+			return received, context.DeadlineExceeded
+		}
+	}
+	return received, nil
+}
+
+func TestEtcdCoordinator(t *testing.T) {
+	Convey("Test Etcd V3 Coordinator", t, func() {
+		dir, err := ioutil.TempDir("", "uq.etcd.test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		e, err := startEtcd(dir)
+		So(err, ShouldBeNil)
+		defer e.Close()
+
+		c, err := NewEtcdCoordinator([]string{etcdAddr}, "uq")
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		Convey("servers are registered with a lease", func() {
+			So(c.Register("127.0.0.1:8808", ""), ShouldBeNil)
+			So(c.Register("127.0.0.1:8808", "127.0.0.1:8809"), ShouldBeNil)
+			servers, err := c.Servers()
+			So(err, ShouldBeNil)
+			So(servers, ShouldResemble, []string{"127.0.0.1:8808"})
+			admins, err := c.Admins()
+			So(err, ShouldBeNil)
+			So(admins, ShouldResemble, []string{"127.0.0.1:8809"})
+
+			lease := c.(*etcdCoordinator).lease
+			ttl, err := c.(*etcdCoordinator).client.TimeToLive(context.Background(), lease)
+			So(err, ShouldBeNil)
+			So(ttl.TTL, ShouldBeGreaterThan, 0)
+
+			So(c.UnRegister("127.0.0.1:8808"), ShouldBeNil)
+			servers, err = c.Servers()
+			So(err, ShouldBeNil)
+			So(servers, ShouldBeEmpty)
+		})
+
+		Convey("watches resume from the revision pulled", func() {
+			So(c.RegisterTopic("foo", "max-messages=10,policy=reject"), ShouldBeNil)
+			events, err := c.Pull()
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []Event{{Type: EventCreate, Key: "foo", Value: "max-messages=10,policy=reject"}})
+
+			// changed while not watching
+			So(c.RegisterLine("foo", "x", "10s"), ShouldBeNil)
+			events, err = watchFor(c, 1)
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []Event{{Type: EventCreate, Key: "foo/x", Value: "10s"}})
+
+			So(c.UnRegisterTopic("foo"), ShouldBeNil)
+			events, err = watchFor(c, 2)
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []Event{{Type: EventRemove, Key: "foo"}, {Type: EventRemove, Key: "foo/x"}})
+		})
+
+		Convey("compacted watches are resynced by a full pull", func() {
+			So(c.RegisterTopic("bar", ""), ShouldBeNil)
+			So(c.RegisterLine("bar", "y", ""), ShouldBeNil)
+			_, err := c.Pull()
+			So(err, ShouldBeNil)
+
+			So(c.UnRegisterLine("bar", "y"), ShouldBeNil)
+			So(c.RegisterTopic("baz", ""), ShouldBeNil)
+			client := c.(*etcdCoordinator).client
+			resp, err := client.Get(context.Background(), "/uq")
+			So(err, ShouldBeNil)
+			_, err = client.Compact(context.Background(), resp.Header.Revision)
+			So(err, ShouldBeNil)
+
+			_, err = watchFor(c, 1)
+			So(err, ShouldNotBeNil)
+			events, err := c.Pull()
+			So(err, ShouldBeNil)
+			So(events, ShouldResemble, []Event{
+				{Type: EventCreate, Key: "bar"},
+				{Type: EventCreate, Key: "baz"},
+				{Type: EventRemove, Key: "bar/y"},
+			})
+			So(c.UnRegisterTopic("bar"), ShouldBeNil)
+			So(c.UnRegisterTopic("baz"), ShouldBeNil)
+		})
+
+		Convey("topics and lines are registered by compare and swap", func() {
+			c2, err := NewEtcdCoordinator([]string{etcdAddr}, "uq")
+			So(err, ShouldBeNil)
+			defer c2.Close()
+
+			So(c.RegisterTopic("cas", ""), ShouldBeNil)
+			err = c2.RegisterTopic("cas", "")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicExisted)
+			So(c2.RegisterLine("cas", "x", ""), ShouldBeNil)
+			err = c.RegisterLine("cas", "x", "1s")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrLineExisted)
+			err = c.RegisterLine("nocas", "x", "")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicNotExisted)
+
+			So(c.UnRegisterTopic("cas"), ShouldBeNil)
+			err = c2.UnRegisterTopic("cas")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicNotExisted)
+			err = c2.UnRegisterLine("cas", "x")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrLineNotExisted)
+		})
+
+		Convey("queues are coordinated", func() {
+			uqs := make([]*UnitedQueue, 2)
+			for i := range uqs {
+				storage, err := store.NewMemStore()
+				So(err, ShouldBeNil)
+				uqs[i], err = NewUnitedQueue(storage, "127.0.0.1", 8808+i, []string{etcdAddr}, "uq")
+				So(err, ShouldBeNil)
+			}
+			defer func() {
+				for _, u := range uqs {
+					u.Close()
+				}
+			}()
+
+			So(uqs[0].Create("qux", ""), ShouldBeNil)
+			So(uqs[0].Create("qux/z", "1s"), ShouldBeNil)
+			So(eventually(func() bool {
+				_, err := uqs[1].Stat("qux/z")
+				return err == nil
+			}), ShouldBeTrue)
+
+			// created on one of the servers only
+			err := uqs[1].Create("qux", "")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicExisted)
+			err = uqs[1].Create("qux/z", "")
+			So(err.(*Error).ErrorCode, ShouldEqual, ErrLineExisted)
+
+			// the local ones are registered when joining the cluster
+			storage, err := store.NewMemStore()
+			So(err, ShouldBeNil)
+			u, err := NewUnitedQueue(storage, "127.0.0.1", 8810, nil, "")
+			So(err, ShouldBeNil)
+			So(u.Create("quux", ""), ShouldBeNil)
+			So(u.Create("quux/w", "1s"), ShouldBeNil)
+			c3, err := NewEtcdCoordinator([]string{etcdAddr}, "uq")
+			So(err, ShouldBeNil)
+			u.SetCoordinator(c3)
+			uqs = append(uqs, u)
+			So(eventually(func() bool {
+				_, err := uqs[0].Stat("quux/w")
+				return err == nil
+			}), ShouldBeTrue)
+			So(eventually(func() bool {
+				_, err := u.Stat("qux/z")
+				return err == nil
+			}), ShouldBeTrue)
+
+			So(uqs[1].Remove("qux"), ShouldBeNil)
+			So(eventually(func() bool {
+				_, err := uqs[0].Stat("qux")
+				return err != nil
+			}), ShouldBeTrue)
+		})
+	})
+}
+
+// eventually polls the condition for a few seconds.
+func eventually(cond func() bool) bool {
+	for i := 0; i < 50; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
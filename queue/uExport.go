@@ -0,0 +1,394 @@
+package queue
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+// TopicExport is the first record of an exported topic, which is followed
+// by its messages. The records are JSON objects, one per line.
+type TopicExport struct {
+	Topic   string       `json:"topic"`
+	Options string       `json:"options,omitempty"`
+	Head    uint64       `json:"head"`
+	Tail    uint64       `json:"tail"`
+	Lines   []LineExport `json:"lines,omitempty"`
+}
+
+// LineExport is the cursors of an exported line.
+type LineExport struct {
+	Name      string           `json:"name"`
+	Recycle   string           `json:"recycle"`
+	Head      uint64           `json:"head"`
+	IHead     uint64           `json:"ihead"`
+	Inflights []InflightExport `json:"inflights,omitempty"`
+}
+
+// InflightExport is a message popped by a line and not confirmed yet.
+type InflightExport struct {
+	ID      uint64    `json:"id"`
+	Exptime time.Time `json:"exptime"`
+}
+
+// MessageExport is an exported message. The time is when it was pushed,
+// and is missing for the messages stored before the push time was kept.
+// The type is the content type pushed over http.
+type MessageExport struct {
+	ID   uint64     `json:"id"`
+	Time *time.Time `json:"time,omitempty"`
+	Type string     `json:"type,omitempty"`
+	Data []byte     `json:"data"`
+}
+
+func (t *topic) exportLineCursors() []LineExport {
+	t.linesLock.RLock()
+	defer t.linesLock.RUnlock()
+
+	lines := make([]LineExport, 0, len(t.lines))
+	for name, l := range t.lines {
+		l.inflightLock.RLock()
+		le := LineExport{
+			Name:    name,
+			Recycle: l.recycle.String(),
+			Head:    l.head,
+			IHead:   l.ihead,
+		}
+		for m := l.inflight.Front(); m != nil; m = m.Next() {
+			msg := m.Value.(*inflightMessage)
+			le.Inflights = append(le.Inflights, InflightExport{ID: msg.Tid, Exptime: msg.Exptime})
+		}
+		l.inflightLock.RUnlock()
+		lines = append(lines, le)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Name < lines[j].Name
+	})
+	return lines
+}
+
+// Export writes the topic to w as NDJSON: a TopicExport with the cursors
+// of the lines, then a MessageExport for each message with its id.
+func (u *UnitedQueue) Export(name string, w io.Writer) error {
+	u.topicsLock.RLock()
+	t, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return NewError(
+			ErrTopicNotExisted,
+			`queue export`,
+		)
+	}
+
+	// the cursors first, so that the messages cover them
+	te := new(TopicExport)
+	te.Topic = name
+	te.Options = t.getOptions().String()
+	te.Lines = t.exportLineCursors()
+	te.Head = t.getHead()
+	te.Tail = t.getTail()
+
+	enc := json.NewEncoder(w)
+	err := enc.Encode(te)
+	if err != nil {
+		return err
+	}
+	var n int
+	for id := te.Head; id < te.Tail; id++ {
+		data, meta, err := t.getDataMeta(id)
+		if err != nil {
+			// cleaned since
+			continue
+		}
+		me := MessageExport{ID: id, Type: meta.mediaType, Data: data}
+		if meta.pushed > 0 {
+			at := time.Unix(0, meta.pushed)
+			me.Time = &at
+		}
+		err = enc.Encode(&me)
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	log.Printf("topic[%s] exported %d messages.", name, n)
+	return nil
+}
+
+// Import reads a topic exported by Export into the topic of name, which
+// is created if not existed. If the topic has no message yet, the message
+// ids and line cursors are kept. Otherwise the messages not consumed by
+// all the lines are appended to it, and the ids they get are returned. A
+// draining queue imports nothing.
+func (u *UnitedQueue) Import(name string, r io.Reader) ([]IDRange, error) {
+	if u.Draining() {
+		return nil, NewError(
+			ErrDraining,
+			`queue import`,
+		)
+	}
+
+	dec := json.NewDecoder(r)
+	te := new(TopicExport)
+	err := dec.Decode(te)
+	if err != nil {
+		return nil, NewError(
+			ErrBadRequest,
+			`import header: `+err.Error(),
+		)
+	}
+	if name == "" {
+		name = te.Topic
+	}
+
+	u.topicsLock.RLock()
+	_, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok {
+		err = u.Create(name, te.Options)
+		if err != nil && !isError(err, ErrTopicExisted) {
+			return nil, err
+		}
+	}
+	u.topicsLock.RLock()
+	t, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return nil, NewError(
+			ErrTopicNotExisted,
+			`queue import`,
+		)
+	}
+
+	for _, le := range te.Lines {
+		err = u.Create(name+"/"+le.Name, le.Recycle)
+		if err != nil && !isError(err, ErrLineExisted) {
+			return nil, err
+		}
+	}
+
+	if t.getTail() == 0 {
+		err = u.importMessages(t, te, dec)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("topic[%s] imported.", name)
+		return nil, nil
+	}
+	ranges, err := u.appendImported(t, te, dec)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("topic[%s] imported by appending.", name)
+	return ranges, nil
+}
+
+func nextMessage(dec *json.Decoder) (*MessageExport, error) {
+	me := new(MessageExport)
+	err := dec.Decode(me)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, NewError(
+			ErrBadRequest,
+			`import message: `+err.Error(),
+		)
+	}
+	return me, nil
+}
+
+func (me *MessageExport) meta() messageMeta {
+	meta := messageMeta{mediaType: me.Type}
+	if me.Time != nil {
+		meta.pushed = me.Time.UnixNano()
+	}
+	return meta
+}
+
+// importMessages stores the messages by their ids in the blank topic, and
+// sets the line cursors. The topic is left blank if it fails.
+func (u *UnitedQueue) importMessages(t *topic, te *TopicExport, dec *json.Decoder) error {
+	t.pushLock.Lock()
+	t.tailLock.Lock()
+	var written []uint64
+	err := func() error {
+		if t.tail != 0 {
+			return NewError(
+				ErrTopicExisted,
+				`queue import pushed meanwhile`,
+			)
+		}
+		for {
+			me, err := nextMessage(dec)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if me.ID < te.Head || me.ID >= te.Tail {
+				return NewError(
+					ErrBadRequest,
+					`import message `+strconv.FormatUint(me.ID, 10)+` out of range`,
+				)
+			}
+			err = u.checkSize(t, me.Data)
+			if err != nil {
+				return err
+			}
+			err = t.setDataMeta(me.ID, me.Data, me.meta())
+			if err != nil {
+				return err
+			}
+			written = append(written, me.ID)
+		}
+
+		t.headLock.Lock()
+		t.head = te.Head
+		err := t.exportHead()
+		t.headLock.Unlock()
+		if err != nil {
+			return err
+		}
+		t.tail = te.Tail
+		err = t.exportTail()
+		if err != nil {
+			return err
+		}
+		if t.getOptions().MaxBytes > 0 {
+			return t.countBytes()
+		}
+		return nil
+	}()
+	if err != nil {
+		t.dropImported(written)
+	}
+	t.tailLock.Unlock()
+	t.pushLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	exported := make(map[string]*LineExport, len(te.Lines))
+	for i := range te.Lines {
+		exported[te.Lines[i].Name] = &te.Lines[i]
+	}
+	t.linesLock.RLock()
+	defer t.linesLock.RUnlock()
+	for name, l := range t.lines {
+		le, ok := exported[name]
+		if !ok {
+			// the lines not exported start from the head
+			l.skipTo(te.Head)
+			continue
+		}
+		inflights := make([]inflightMessage, len(le.Inflights))
+		for i, m := range le.Inflights {
+			inflights[i] = inflightMessage{Tid: m.ID, Exptime: m.Exptime}
+		}
+		err = l.restore(le.Head, le.IHead, inflights)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropImported deletes the messages written by a failed importMessages,
+// and moves the head and tail back to the blank topic. The push and tail
+// locks are held.
+func (t *topic) dropImported(ids []uint64) {
+	for _, id := range ids {
+		key := Acatui(t.name, ":", id)
+		if t.format == topicFormatRaw {
+			t.q.delData(key)
+		} else {
+			t.deleteMessage(key)
+		}
+	}
+
+	t.headLock.Lock()
+	if t.head != 0 {
+		t.head = 0
+		t.exportHead()
+	}
+	t.headLock.Unlock()
+	if t.tail != 0 {
+		t.tail = 0
+		t.exportTail()
+	}
+	atomic.StoreUint64(&t.bytes, 0)
+}
+
+// appendImported appends the messages from the slowest cursor of the
+// lines exported, like migrateMessages.
+func (u *UnitedQueue) appendImported(t *topic, te *TopicExport, dec *json.Decoder) ([]IDRange, error) {
+	start := te.Tail
+	for _, le := range te.Lines {
+		recycle, _ := time.ParseDuration(le.Recycle)
+		if cursor := unconsumed(le.Head, le.IHead, recycle); cursor < start {
+			start = cursor
+		}
+	}
+	if len(te.Lines) == 0 || start < te.Head {
+		start = te.Head
+	}
+
+	var ranges []IDRange
+	ids := make([]uint64, 0, ReplicaBatchSize)
+	datas := make([][]byte, 0, ReplicaBatchSize)
+	metas := make([]messageMeta, 0, ReplicaBatchSize)
+	flush := func() error {
+		if len(datas) == 0 {
+			return nil
+		}
+		err := u.checkSize(t, datas...)
+		if err != nil {
+			return err
+		}
+		first, err := t.append(datas, metas)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			ranges = addIDRange(ranges, id, first+uint64(i))
+		}
+		ids = ids[:0]
+		datas = datas[:0]
+		metas = metas[:0]
+		return nil
+	}
+	for {
+		me, err := nextMessage(dec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if me.ID < start {
+			continue
+		}
+		ids = append(ids, me.ID)
+		datas = append(datas, me.Data)
+		metas = append(metas, me.meta())
+		if len(datas) == ReplicaBatchSize {
+			err = flush()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err := flush()
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
@@ -117,7 +117,8 @@ func (l *line) updateiHead() {
 	}
 }
 
-func (l *line) pop() (uint64, []byte, error) {
+// pop pops a message with its media type.
+func (l *line) pop() (uint64, []byte, string, error) {
 	l.inflightLock.Lock()
 	defer l.inflightLock.Unlock()
 
@@ -130,14 +131,14 @@ func (l *line) pop() (uint64, []byte, error) {
 			if now.After(msg.Exptime) {
 				// log.Printf("key[%s/%d] is expired.", l.name, msg.Tid)
 				msg.Exptime = now.Add(l.recycle)
-				data, err := l.t.getData(msg.Tid)
+				data, meta, err := l.t.getDataMeta(msg.Tid)
 				if err != nil {
-					return 0, nil, err
+					return 0, nil, "", err
 				}
 				l.inflight.Remove(m)
 				l.inflight.PushBack(msg)
 				// log.Printf("key[%s/%s/%d] poped.", l.t.name, l.name, msg.Tid)
-				return msg.Tid, data, nil
+				return msg.Tid, data, meta.mediaType, nil
 			}
 		}
 	}
@@ -149,15 +150,15 @@ func (l *line) pop() (uint64, []byte, error) {
 	topicTail := l.t.getTail()
 	if l.head >= topicTail {
 		// log.Printf("line[%s] is blank. head:%d - tail:%d", l.name, l.head, l.t.tail)
-		return 0, nil, NewError(
+		return 0, nil, "", NewError(
 			ErrNone,
 			`line pop`,
 		)
 	}
 
-	data, err := l.t.getData(tid)
+	data, meta, err := l.t.getDataMeta(tid)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, "", err
 	}
 
 	l.head++
@@ -172,28 +173,30 @@ func (l *line) pop() (uint64, []byte, error) {
 		l.imap[tid] = true
 	}
 
-	return tid, data, nil
+	return tid, data, meta.mediaType, nil
 }
 
-func (l *line) mPop(n int) ([]uint64, [][]byte, error) {
+func (l *line) mPop(n int) ([]uint64, [][]byte, []string, error) {
 	l.inflightLock.Lock()
 	defer l.inflightLock.Unlock()
 
 	fc := 0
 	ids := make([]uint64, 0)
 	datas := make([][]byte, 0)
+	types := make([]string, 0)
 	now := time.Now()
 	if l.recycle > 0 {
 		for m := l.inflight.Front(); m != nil && fc < n; m = m.Next() {
 			msg := m.Value.(*inflightMessage)
 			if now.After(msg.Exptime) {
 				msg := m.Value.(*inflightMessage)
-				data, err := l.t.getData(msg.Tid)
+				data, meta, err := l.t.getDataMeta(msg.Tid)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, nil, err
 				}
 				ids = append(ids, msg.Tid)
 				datas = append(datas, data)
+				types = append(types, meta.mediaType)
 				fc++
 			} else {
 				break
@@ -208,7 +211,7 @@ func (l *line) mPop(n int) ([]uint64, [][]byte, error) {
 			l.inflight.PushBack(msg)
 		}
 		if fc >= n {
-			return ids, datas, nil
+			return ids, datas, types, nil
 		}
 	}
 
@@ -223,7 +226,7 @@ func (l *line) mPop(n int) ([]uint64, [][]byte, error) {
 			break
 		}
 
-		data, err := l.t.getData(tid)
+		data, meta, err := l.t.getDataMeta(tid)
 		if err != nil {
 			log.Printf("get data failed: %s", err)
 			break
@@ -232,6 +235,7 @@ func (l *line) mPop(n int) ([]uint64, [][]byte, error) {
 		l.head++
 		ids = append(ids, tid)
 		datas = append(datas, data)
+		types = append(types, meta.mediaType)
 
 		if l.recycle > 0 {
 			msg := new(inflightMessage)
@@ -245,9 +249,9 @@ func (l *line) mPop(n int) ([]uint64, [][]byte, error) {
 	}
 
 	if len(ids) > 0 {
-		return ids, datas, nil
+		return ids, datas, types, nil
 	}
-	return nil, nil, NewError(
+	return nil, nil, nil, NewError(
 		ErrNone,
 		`line mPop`,
 	)
@@ -310,6 +314,68 @@ func (l *line) stat() *QueueStat {
 	return qs
 }
 
+// skipTo moves the line to the head of its topic after the oldest messages
+// are dropped. The dropped inflight messages are forgotten.
+func (l *line) skipTo(head uint64) {
+	l.inflightLock.Lock()
+	defer l.inflightLock.Unlock()
+	l.headLock.Lock()
+	defer l.headLock.Unlock()
+
+	if l.head < head {
+		l.head = head
+	}
+	for m := l.inflight.Front(); m != nil; {
+		next := m.Next()
+		if msg := m.Value.(*inflightMessage); msg.Tid < head {
+			l.inflight.Remove(m)
+		}
+		m = next
+	}
+	for id := range l.imap {
+		if id < head {
+			delete(l.imap, id)
+		}
+	}
+	if l.ihead < head {
+		l.ihead = head
+	}
+	l.updateiHead()
+}
+
+// restore sets the cursors of the line, like the ones imported.
+func (l *line) restore(head, ihead uint64, inflights []inflightMessage) error {
+	l.inflightLock.Lock()
+	defer l.inflightLock.Unlock()
+	l.headLock.Lock()
+	defer l.headLock.Unlock()
+
+	imap := make(map[uint64]bool)
+	for i := ihead; i < head; i++ {
+		imap[i] = false
+	}
+	inflight := list.New()
+	for index := range inflights {
+		msg := inflights[index]
+		inflight.PushBack(&msg)
+		imap[msg.Tid] = true
+	}
+	l.head = head
+	l.ihead = ihead
+	l.imap = imap
+	l.inflight = inflight
+	return l.exportLine()
+}
+
+// unconsumed returns the first message the line has not consumed, which
+// is the inflight head if the messages inflight may be recycled.
+func unconsumed(head, ihead uint64, recycle time.Duration) uint64 {
+	if recycle > 0 && ihead < head {
+		return ihead
+	}
+	return head
+}
+
 func (l *line) empty() error {
 	l.inflightLock.Lock()
 	defer l.inflightLock.Unlock()
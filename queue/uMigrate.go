@@ -0,0 +1,405 @@
+package queue
+
+import (
+	"log"
+	"net/rpc"
+	"sync/atomic"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+// KeyMigratePrefix is the leader namespace of the topics migrated to a
+// node, such as replica/migrate/<node>/<key>.
+const KeyMigratePrefix string = "migrate/"
+
+// IDRange maps the message ids From...From+Count-1 of a migrated topic to
+// the ids To...To+Count-1 on the node it is migrated to.
+type IDRange struct {
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Count uint64 `json:"count"`
+}
+
+// TailArgs asks the tail of the topic.
+type TailArgs struct {
+	Secret string
+	Topic  string
+}
+
+// TakeoverArgs takes over the topic stored under the leader namespace.
+type TakeoverArgs struct {
+	Secret string
+	Leader string
+	Topic  string
+}
+
+// AppendArgs appends the messages of a migrated topic to the same topic
+// of another node. Lines are the recycles of the lines by name, which are
+// created at the tail if missing.
+type AppendArgs struct {
+	Secret string
+	Topic  string
+	Lines  map[string]string
+	Datas  [][]byte
+}
+
+// CursorsArgs sets the cursors of the lines after the messages appended,
+// whose ids are mapped already. From is the id of the first one.
+type CursorsArgs struct {
+	Secret string
+	Topic  string
+	From   uint64
+	Lines  []LineExport
+}
+
+// Drain refuses the pushes to this node or accepts them again. The pops
+// and confirms are still served while draining.
+func (u *UnitedQueue) Drain(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&u.draining, v)
+	log.Printf("uq draining: %v", draining)
+}
+
+func (u *UnitedQueue) Draining() bool {
+	return atomic.LoadInt32(&u.draining) == 1
+}
+
+// Migrate copies the messages and line cursors of the topic to the node
+// whose replica port is addr. If the topic of that node has no message
+// yet, it is replaced and the message ids are preserved. Otherwise the
+// messages not consumed by all the lines are appended to it, and the ids
+// they get are returned. The topic is left here, and should be drained
+// first so that no message is pushed meanwhile.
+func (u *UnitedQueue) Migrate(name, addr string) ([]IDRange, error) {
+	u.topicsLock.RLock()
+	t, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return nil, NewError(
+			ErrTopicNotExisted,
+			`queue migrate`,
+		)
+	}
+
+	// copy the latest cursors
+	t.exportLines()
+
+	client, err := u.dialReplica(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var tail uint64
+	err = client.Call("Replica.Tail", &TailArgs{Secret: u.replicaSecret, Topic: name}, &tail)
+	if err != nil {
+		return nil, err
+	}
+	if tail == 0 {
+		err = u.migrateKeys(client, t)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("topic[%s] migrated to %s.", name, addr)
+		return nil, nil
+	}
+
+	ranges, err := u.migrateMessages(client, t)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("topic[%s] appended to %s.", name, addr)
+	return ranges, nil
+}
+
+// migrateKeys sends the topic as it is stored, which the node takes over.
+func (u *UnitedQueue) migrateKeys(client *rpc.Client, t *topic) error {
+	leader := KeyMigratePrefix + u.selfAddr
+	keys, err := topicKeys(u.getData, t.name)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	ops := make([]ReplicaOp, 0, ReplicaBatchSize)
+	for i, key := range keys {
+		data, err := u.getData(key)
+		if err == nil {
+			ops = append(ops, ReplicaOp{Key: key, Data: data})
+		}
+		if len(ops) < ReplicaBatchSize && i < len(keys)-1 {
+			continue
+		}
+		err = client.Call("Replica.Apply", &ReplicaArgs{Secret: u.replicaSecret, Leader: leader, Ops: ops}, &n)
+		if err != nil {
+			return err
+		}
+		ops = ops[:0]
+	}
+
+	var taken bool
+	args := &TakeoverArgs{Secret: u.replicaSecret, Leader: leader, Topic: t.name}
+	return client.Call("Replica.Takeover", args, &taken)
+}
+
+// migrateMessages appends the messages from the slowest cursor of the
+// lines to the topic of the node, then moves the cursors of its lines to
+// the ids the messages got.
+func (u *UnitedQueue) migrateMessages(client *rpc.Client, t *topic) ([]IDRange, error) {
+	head := t.getHead()
+	tail := t.getTail()
+	start := tail
+	cursors := t.exportLineCursors()
+	lines := make(map[string]string, len(cursors))
+	for _, le := range cursors {
+		lines[le.Name] = le.Recycle
+		recycle, _ := time.ParseDuration(le.Recycle)
+		if cursor := unconsumed(le.Head, le.IHead, recycle); cursor < start {
+			start = cursor
+		}
+	}
+	if len(lines) == 0 || start < head {
+		start = head
+	}
+
+	var ranges []IDRange
+	ids := make([]uint64, 0, ReplicaBatchSize)
+	datas := make([][]byte, 0, ReplicaBatchSize)
+	for id := start; id < tail; id++ {
+		data, err := t.getData(id)
+		if err == nil {
+			ids = append(ids, id)
+			datas = append(datas, data)
+		}
+		if len(datas) < ReplicaBatchSize && id < tail-1 {
+			continue
+		}
+		if len(datas) == 0 {
+			break
+		}
+
+		var first uint64
+		args := &AppendArgs{Secret: u.replicaSecret, Topic: t.name, Lines: lines, Datas: datas}
+		err = client.Call("Replica.Append", args, &first)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			ranges = addIDRange(ranges, id, first+uint64(i))
+		}
+		ids = ids[:0]
+		datas = datas[:0]
+	}
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	last := ranges[len(ranges)-1]
+	end := last.To + last.Count
+	for i := range cursors {
+		le := &cursors[i]
+		inflights := le.Inflights[:0]
+		for _, m := range le.Inflights {
+			if id, ok := mapMigrated(ranges, m.ID); ok {
+				inflights = append(inflights, InflightExport{ID: id, Exptime: m.Exptime})
+			}
+		}
+		le.Head = mapID(ranges, le.Head, end)
+		le.IHead = mapID(ranges, le.IHead, end)
+		le.Inflights = inflights
+	}
+	var n int
+	args := &CursorsArgs{Secret: u.replicaSecret, Topic: t.name, From: ranges[0].To, Lines: cursors}
+	err := client.Call("Replica.Cursors", args, &n)
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// mapMigrated returns the id the message migrated got.
+func mapMigrated(ranges []IDRange, id uint64) (uint64, bool) {
+	for _, r := range ranges {
+		if id >= r.From && id < r.From+r.Count {
+			return r.To + id - r.From, true
+		}
+	}
+	return 0, false
+}
+
+// mapID maps the cursor at id to the id of the first message migrated
+// at or after it, or end if there is none.
+func mapID(ranges []IDRange, id, end uint64) uint64 {
+	for _, r := range ranges {
+		if id < r.From {
+			return r.To
+		}
+		if id < r.From+r.Count {
+			return r.To + id - r.From
+		}
+	}
+	return end
+}
+
+// addIDRange maps the id from to the id to, extending the last range if
+// they both follow it.
+func addIDRange(ranges []IDRange, from, to uint64) []IDRange {
+	if n := len(ranges); n > 0 {
+		last := &ranges[n-1]
+		if from == last.From+last.Count && to == last.To+last.Count {
+			last.Count++
+			return ranges
+		}
+	}
+	return append(ranges, IDRange{From: from, To: to, Count: 1})
+}
+
+// appendMessages appends the messages migrated from another node like a
+// push, and creates the lines missing at the tail, so that their cursors
+// can be moved to the messages appended.
+func (u *UnitedQueue) appendMessages(args *AppendArgs) (uint64, error) {
+	if u.Draining() {
+		return 0, NewError(
+			ErrDraining,
+			`queue append`,
+		)
+	}
+
+	u.topicsLock.RLock()
+	t, ok := u.topics[args.Topic]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return 0, NewError(
+			ErrTopicNotExisted,
+			`queue append`,
+		)
+	}
+	err := u.checkSize(t, args.Datas...)
+	if err != nil {
+		return 0, err
+	}
+
+	for name, recycle := range args.Lines {
+		t.linesLock.RLock()
+		_, ok := t.lines[name]
+		t.linesLock.RUnlock()
+		if ok {
+			continue
+		}
+		err := u.Create(args.Topic+"/"+name, recycle)
+		if err != nil && !isError(err, ErrLineExisted) {
+			return 0, err
+		}
+		if err == nil {
+			t.linesLock.RLock()
+			l, ok := t.lines[name]
+			t.linesLock.RUnlock()
+			if ok {
+				l.skipTo(t.getTail())
+			}
+		}
+	}
+	return t.append(args.Datas, nil)
+}
+
+// restoreCursors sets the cursors of the lines which have popped nothing
+// since from, like the ones created by appendMessages. The other lines
+// pop the messages appended after their own ones.
+func (u *UnitedQueue) restoreCursors(args *CursorsArgs) (int, error) {
+	u.topicsLock.RLock()
+	t, ok := u.topics[args.Topic]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return 0, NewError(
+			ErrTopicNotExisted,
+			`queue cursors`,
+		)
+	}
+
+	var n int
+	t.linesLock.RLock()
+	defer t.linesLock.RUnlock()
+	for _, le := range args.Lines {
+		l, ok := t.lines[le.Name]
+		if !ok {
+			continue
+		}
+		l.inflightLock.RLock()
+		popped := l.ihead != args.From || l.head != args.From
+		l.inflightLock.RUnlock()
+		if popped {
+			continue
+		}
+		inflights := make([]inflightMessage, len(le.Inflights))
+		for i, m := range le.Inflights {
+			inflights[i] = inflightMessage{Tid: m.ID, Exptime: m.Exptime}
+		}
+		err := l.restore(le.Head, le.IHead, inflights)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Tail returns the tail of the topic, or 0 if it is not existed.
+func (s *replicaService) Tail(args *TailArgs, tail *uint64) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	s.u.topicsLock.RLock()
+	t, ok := s.u.topics[args.Topic]
+	s.u.topicsLock.RUnlock()
+	if ok {
+		*tail = t.getTail()
+	}
+	return nil
+}
+
+// Takeover takes over the topic sent by Apply, like a migrated one. A
+// draining node takes no topic.
+func (s *replicaService) Takeover(args *TakeoverArgs, taken *bool) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	if s.u.Draining() {
+		return NewError(
+			ErrDraining,
+			`queue takeover`,
+		)
+	}
+	err = s.u.Takeover(args.Leader, args.Topic)
+	*taken = err == nil
+	return err
+}
+
+// Append appends the messages of a migrated topic, and returns the id of
+// the first one.
+func (s *replicaService) Append(args *AppendArgs, first *uint64) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	id, err := s.u.appendMessages(args)
+	*first = id
+	return err
+}
+
+// Cursors moves the lines of a migrated topic to the messages appended,
+// and returns the number of the lines moved.
+func (s *replicaService) Cursors(args *CursorsArgs, n *int) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	moved, err := s.u.restoreCursors(args)
+	*n = moved
+	return err
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	PolicyReject string = "reject"
+	PolicyBlock  string = "block"
+	PolicyDrop   string = "drop"
+
+	TopicBlockInterval time.Duration = 100 * time.Millisecond
+	TopicBlockTimeout  time.Duration = 10 * time.Second
+)
+
+// TopicOptions limits the messages kept by a topic, which are those
+// between its head and tail. When the topic is full, pushes are rejected,
+// blocked until space frees, or the oldest messages are dropped according
+// to the policy. A zero limit is unlimited. The max message size limits a
+// single message under the global one of the queue. The messages are
+// stored compressed by the compression of the topic.
+type TopicOptions struct {
+	MaxMessages    uint64
+	MaxBytes       uint64
+	Policy         string
+	MaxMessageSize int
+	Compression    string
+}
+
+// ParseTopicOptions parses the options passed as the recycle argument of a
+// topic creation, like 'max-messages=1000,max-bytes=1048576,policy=drop'.
+// The default policy is reject.
+func ParseTopicOptions(s string) (TopicOptions, error) {
+	var o TopicOptions
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return o, NewError(
+				ErrBadRequest,
+				`bad topic option: `+opt,
+			)
+		}
+
+		var err error
+		switch kv[0] {
+		case "max-messages":
+			o.MaxMessages, err = strconv.ParseUint(kv[1], 10, 64)
+		case "max-bytes":
+			o.MaxBytes, err = strconv.ParseUint(kv[1], 10, 64)
+		case "max-message-size":
+			o.MaxMessageSize, err = strconv.Atoi(kv[1])
+			if o.MaxMessageSize < 0 {
+				err = strconv.ErrRange
+			}
+		case "compression":
+			o.Compression = kv[1]
+			if o.Compression != CompressionSnappy && o.Compression != CompressionZstd {
+				return o, NewError(
+					ErrBadRequest,
+					`unknown topic compression: `+o.Compression,
+				)
+			}
+		case "policy":
+			o.Policy = kv[1]
+			if o.Policy != PolicyReject && o.Policy != PolicyBlock && o.Policy != PolicyDrop {
+				return o, NewError(
+					ErrBadRequest,
+					`unknown topic policy: `+o.Policy,
+				)
+			}
+		default:
+			return o, NewError(
+				ErrBadRequest,
+				`unknown topic option: `+kv[0],
+			)
+		}
+		if err != nil {
+			return o, NewError(
+				ErrBadRequest,
+				`bad topic option: `+opt,
+			)
+		}
+	}
+
+	if o.Policy == "" && o.limited() {
+		o.Policy = PolicyReject
+	}
+	return o, nil
+}
+
+func (o TopicOptions) limited() bool {
+	return o.MaxMessages > 0 || o.MaxBytes > 0
+}
+
+func (o TopicOptions) String() string {
+	opts := make([]string, 0, 5)
+	if o.MaxMessages > 0 {
+		opts = append(opts, "max-messages="+strconv.FormatUint(o.MaxMessages, 10))
+	}
+	if o.MaxBytes > 0 {
+		opts = append(opts, "max-bytes="+strconv.FormatUint(o.MaxBytes, 10))
+	}
+	if o.Policy != "" {
+		opts = append(opts, "policy="+o.Policy)
+	}
+	if o.MaxMessageSize > 0 {
+		opts = append(opts, "max-message-size="+strconv.Itoa(o.MaxMessageSize))
+	}
+	if o.Compression != "" {
+		opts = append(opts, "compression="+o.Compression)
+	}
+	return strings.Join(opts, ",")
+}
@@ -2,18 +2,20 @@ package queue
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/buaazp/uq/store"
 	. "github.com/buaazp/uq/utils"
-	"github.com/coreos/go-etcd/etcd"
 )
 
 func init() {
@@ -32,18 +34,28 @@ const (
 	KeyLineHead      string        = ":head"
 	KeyLineRecycle   string        = ":recycle"
 	KeyLineInflight  string        = ":inflight"
+
+	DefaultMaxMessageSize int = 10 * 1024 * 1024
 )
 
 type UnitedQueue struct {
-	topics     map[string]*topic
-	topicsLock sync.RWMutex
-	storage    store.Storage
-	etcdLock   sync.RWMutex
-	selfAddr   string
-	etcdClient *etcd.Client
-	etcdKey    string
-	etcdStop   chan bool
-	wg         sync.WaitGroup
+	topics      map[string]*topic
+	topicsLock  sync.RWMutex
+	storage     store.Storage
+	selfAddr    string
+	adminAddr   atomic.Value
+	coordinator Coordinator
+	coordStop   chan bool
+	// serializes the creates and removes against the registry
+	registryLock sync.Mutex
+	wg           sync.WaitGroup
+
+	maxMessageSize int
+	chunkSize      int
+	replicator     *replicator
+	replicaSecret  string
+	replicaTLS     *tls.Config
+	draining       int32
 }
 
 type unitedQueueStore struct {
@@ -52,29 +64,59 @@ type unitedQueueStore struct {
 
 func NewUnitedQueue(storage store.Storage, ip string, port int, etcdServers []string, etcdKey string) (*UnitedQueue, error) {
 	topics := make(map[string]*topic)
-	etcdStop := make(chan bool)
+	coordStop := make(chan bool)
 	uq := new(UnitedQueue)
 	uq.topics = topics
 	uq.storage = storage
-	uq.etcdStop = etcdStop
-
-	if len(etcdServers) > 0 {
-		selfAddr := Addrcat(ip, port)
-		uq.selfAddr = selfAddr
-		etcdClient := etcd.NewClient(etcdServers)
-		uq.etcdClient = etcdClient
-		uq.etcdKey = etcdKey
-	}
+	uq.coordStop = coordStop
+	uq.selfAddr = Addrcat(ip, port)
+	uq.maxMessageSize = DefaultMaxMessageSize
+	uq.chunkSize = DefaultChunkSize
 
 	err := uq.loadQueue()
 	if err != nil {
 		return nil, err
 	}
 
-	go uq.etcdRun()
+	if len(etcdServers) > 0 {
+		coordinator, err := NewEtcdCoordinator(etcdServers, etcdKey)
+		if err != nil {
+			return nil, err
+		}
+		uq.SetCoordinator(coordinator)
+	}
 	return uq, nil
 }
 
+// SetMaxMessageSize sets the global max size of a message. Topics may
+// limit their messages smaller.
+func (u *UnitedQueue) SetMaxMessageSize(size int) {
+	u.maxMessageSize = size
+}
+
+// SetChunkSize sets the max size of a value stored for a message. Larger
+// messages are split into chunks stored under several keys.
+func (u *UnitedQueue) SetChunkSize(size int) {
+	u.chunkSize = size
+}
+
+// checkSize checks the size of the messages pushed to the topic.
+func (u *UnitedQueue) checkSize(t *topic, datas ...[]byte) error {
+	max := u.maxMessageSize
+	if o := t.getOptions(); o.MaxMessageSize > 0 && o.MaxMessageSize < max {
+		max = o.MaxMessageSize
+	}
+	for i, data := range datas {
+		if len(data) > max {
+			return NewError(
+				ErrMessageTooLarge,
+				`message `+strconv.Itoa(i)+` of `+strconv.Itoa(len(data))+` bytes exceeds `+strconv.Itoa(max),
+			)
+		}
+	}
+	return nil
+}
+
 func (u *UnitedQueue) setData(key string, data []byte) error {
 	err := u.storage.Set(key, data)
 	if err != nil {
@@ -84,6 +126,7 @@ func (u *UnitedQueue) setData(key string, data []byte) error {
 			err.Error(),
 		)
 	}
+	u.replicate(ReplicaOp{Key: key, Data: data})
 	return nil
 }
 
@@ -108,6 +151,7 @@ func (u *UnitedQueue) delData(key string) error {
 			err.Error(),
 		)
 	}
+	u.replicate(ReplicaOp{Del: true, Key: key})
 	return nil
 }
 
@@ -186,6 +230,14 @@ func (u *UnitedQueue) loadTopic(topicName string, topicStoreValue topicStore) (*
 		return nil, err
 	}
 	t.tail = binary.LittleEndian.Uint64(topicTailData)
+	t.options = topicStoreValue.Options
+	t.format = topicStoreValue.Format
+	if t.options.MaxBytes > 0 {
+		err = t.countBytes()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	lines := make(map[string]*line)
 	for _, lineName := range topicStoreValue.Lines {
@@ -210,7 +262,7 @@ func (u *UnitedQueue) loadTopic(topicName string, topicStoreValue topicStore) (*
 	}
 	t.lines = lines
 
-	u.registerTopic(t.name)
+	u.registerTopic(t.name, t.options.String())
 
 	t.start()
 	// log.Printf("topic[%s] load succ.", topicName)
@@ -257,7 +309,7 @@ func (u *UnitedQueue) loadQueue() error {
 	return nil
 }
 
-func (u *UnitedQueue) newTopic(name string) (*topic, error) {
+func (u *UnitedQueue) newTopic(name string, options TopicOptions) (*topic, error) {
 	lines := make(map[string]*line)
 	t := new(topic)
 	t.name = name
@@ -268,6 +320,8 @@ func (u *UnitedQueue) newTopic(name string) (*topic, error) {
 	t.tailKey = name + KeyTopicTail
 	t.q = u
 	t.quit = make(chan bool)
+	t.options = options
+	t.format = topicFormatEncoded
 
 	err := t.exportHead()
 	if err != nil {
@@ -282,7 +336,7 @@ func (u *UnitedQueue) newTopic(name string) (*topic, error) {
 	return t, nil
 }
 
-func (u *UnitedQueue) createTopic(name string, fromEtcd bool) error {
+func (u *UnitedQueue) createTopic(name string, options TopicOptions, fromEtcd bool) error {
 	u.topicsLock.RLock()
 	_, ok := u.topics[name]
 	u.topicsLock.RUnlock()
@@ -293,7 +347,41 @@ func (u *UnitedQueue) createTopic(name string, fromEtcd bool) error {
 		)
 	}
 
-	t, err := u.newTopic(name)
+	// registered first, so that a topic created by another server is
+	// not created here
+	if !fromEtcd {
+		err := u.registerTopic(name, options.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	err := u.newLocalTopic(name, options)
+	if err != nil {
+		if !fromEtcd {
+			u.unRegisterTopic(name)
+		}
+		return err
+	}
+	log.Printf("topic[%s:%s] created.", name, options)
+	return nil
+}
+
+// reconcileOptions changes the options of the topic to the ones
+// registered if it is existed. The topics registered without options are
+// left as they are.
+func (u *UnitedQueue) reconcileOptions(name string, options TopicOptions) error {
+	u.topicsLock.RLock()
+	t, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok || t.getOptions() == options {
+		return nil
+	}
+	return t.setOptions(options)
+}
+
+func (u *UnitedQueue) newLocalTopic(name string, options TopicOptions) error {
+	t, err := u.newTopic(name, options)
 	if err != nil {
 		return err
 	}
@@ -302,20 +390,22 @@ func (u *UnitedQueue) createTopic(name string, fromEtcd bool) error {
 	defer u.topicsLock.Unlock()
 	u.topics[name] = t
 
-	err = u.exportQueue()
+	err = t.exportTopic()
 	if err != nil {
 		t.remove()
 		delete(u.topics, name)
 		return err
 	}
-
-	if !fromEtcd {
-		u.registerTopic(t.name)
+	err = u.exportQueue()
+	if err != nil {
+		t.remove()
+		delete(u.topics, name)
+		return err
 	}
-	log.Printf("topic[%s] created.", name)
 	return nil
 }
 
+// create creates the topic or line. The registry lock is held.
 func (u *UnitedQueue) create(key, rec string, fromEtcd bool) error {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
@@ -367,7 +457,23 @@ func (u *UnitedQueue) create(key, rec string, fromEtcd bool) error {
 			return err
 		}
 	} else {
-		err = u.createTopic(topicName, fromEtcd)
+		// the recycle of a topic is its options, and a bare duration
+		// is accepted and ignored like before the options
+		if !strings.Contains(rec, "=") {
+			rec = ""
+		}
+		var options TopicOptions
+		options, err = ParseTopicOptions(rec)
+		if err != nil {
+			return err
+		}
+		if fromEtcd && rec != "" {
+			err = u.reconcileOptions(topicName, options)
+			if err != nil {
+				return err
+			}
+		}
+		err = u.createTopic(topicName, options, fromEtcd)
 		if err != nil {
 			// log.Printf("create topic[%s] error: %s", topicName, err)
 			return err
@@ -378,13 +484,28 @@ func (u *UnitedQueue) create(key, rec string, fromEtcd bool) error {
 }
 
 func (u *UnitedQueue) Create(key, rec string) error {
+	u.registryLock.Lock()
+	defer u.registryLock.Unlock()
 	return u.create(key, rec, false)
 }
 
 func (u *UnitedQueue) Push(key string, data []byte) error {
+	return u.PushType(key, data, "")
+}
+
+// PushType pushes the message with its media type, which is returned by
+// PopType. The media type is dropped by the topics of the raw format.
+func (u *UnitedQueue) PushType(key string, data []byte, mediaType string) error {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
 
+	if u.Draining() {
+		return NewError(
+			ErrDraining,
+			`queue push`,
+		)
+	}
+
 	if len(data) <= 0 {
 		return NewError(
 			ErrBadRequest,
@@ -402,13 +523,24 @@ func (u *UnitedQueue) Push(key string, data []byte) error {
 		)
 	}
 
-	return t.push(data)
+	err := u.checkSize(t, data)
+	if err != nil {
+		return err
+	}
+	return t.push(data, mediaType)
 }
 
 func (u *UnitedQueue) MultiPush(key string, datas [][]byte) error {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
 
+	if u.Draining() {
+		return NewError(
+			ErrDraining,
+			`queue push`,
+		)
+	}
+
 	for i, data := range datas {
 		if len(data) <= 0 {
 			cause := "message " + strconv.Itoa(i) + " has no content"
@@ -429,16 +561,27 @@ func (u *UnitedQueue) MultiPush(key string, datas [][]byte) error {
 		)
 	}
 
+	err := u.checkSize(t, datas...)
+	if err != nil {
+		return err
+	}
 	return t.mPush(datas)
 }
 
 func (u *UnitedQueue) Pop(key string) (string, []byte, error) {
+	id, data, _, err := u.PopType(key)
+	return id, data, err
+}
+
+// PopType pops a message with its media type, which is blank if it was
+// pushed without one.
+func (u *UnitedQueue) PopType(key string) (string, []byte, string, error) {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
 
 	parts := strings.Split(key, "/")
 	if len(parts) != 2 {
-		return "", nil, NewError(
+		return "", nil, "", NewError(
 			ErrBadKey,
 			`pop key parts error: `+ItoaQuick(len(parts)),
 		)
@@ -452,27 +595,34 @@ func (u *UnitedQueue) Pop(key string) (string, []byte, error) {
 	u.topicsLock.RUnlock()
 	if !ok {
 		// log.Printf("topic[%s] not existed.", tName)
-		return "", nil, NewError(
+		return "", nil, "", NewError(
 			ErrTopicNotExisted,
 			`queue pop`,
 		)
 	}
 
-	id, data, err := t.pop(lName)
+	id, data, mediaType, err := t.pop(lName)
 	if err != nil {
-		return "", nil, err
+		return "", nil, "", err
 	}
+	u.replicateLine(t, lName)
 
-	return Acatui(key, "/", id), data, nil
+	return Acatui(key, "/", id), data, mediaType, nil
 }
 
 func (u *UnitedQueue) MultiPop(key string, n int) ([]string, [][]byte, error) {
+	ids, datas, _, err := u.MultiPopType(key, n)
+	return ids, datas, err
+}
+
+// MultiPopType pops n messages at most with their media types.
+func (u *UnitedQueue) MultiPopType(key string, n int) ([]string, [][]byte, []string, error) {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
 
 	parts := strings.Split(key, "/")
 	if len(parts) != 2 {
-		return nil, nil, NewError(
+		return nil, nil, nil, NewError(
 			ErrBadKey,
 			`mPop key parts error: `+ItoaQuick(len(parts)),
 		)
@@ -486,22 +636,23 @@ func (u *UnitedQueue) MultiPop(key string, n int) ([]string, [][]byte, error) {
 	u.topicsLock.RUnlock()
 	if !ok {
 		// log.Printf("topic[%s] not existed.", tName)
-		return nil, nil, NewError(
+		return nil, nil, nil, NewError(
 			ErrTopicNotExisted,
 			`queue multiPop`,
 		)
 	}
 
-	ids, datas, err := t.mPop(lName, n)
+	ids, datas, types, err := t.mPop(lName, n)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	u.replicateLine(t, lName)
 
 	keys := make([]string, len(ids))
 	for i, id := range ids {
 		keys[i] = Acatui(key, "/", id)
 	}
-	return keys, datas, nil
+	return keys, datas, types, nil
 }
 
 func (u *UnitedQueue) Confirm(key string) error {
@@ -540,7 +691,12 @@ func (u *UnitedQueue) Confirm(key string) error {
 		)
 	}
 
-	return t.confirm(lineName, id)
+	err = t.confirm(lineName, id)
+	if err != nil {
+		return err
+	}
+	u.replicateLine(t, lineName)
+	return nil
 }
 
 func (u *UnitedQueue) MultiConfirm(keys []string) []error {
@@ -591,6 +747,15 @@ func (u *UnitedQueue) Stat(key string) (*QueueStat, error) {
 	return qs, nil
 }
 
+func (u *UnitedQueue) Topics() []string {
+	u.topicsLock.RLock()
+	defer u.topicsLock.RUnlock()
+
+	qs := u.genQueueStore()
+	sort.Strings(qs.Topics)
+	return qs.Topics
+}
+
 func (u *UnitedQueue) Empty(key string) error {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
@@ -637,31 +802,56 @@ func (u *UnitedQueue) Empty(key string) error {
 }
 
 func (u *UnitedQueue) removeTopic(name string, fromEtcd bool) error {
-	u.topicsLock.Lock()
-	defer u.topicsLock.Unlock()
+	u.topicsLock.RLock()
+	_, ok := u.topics[name]
+	u.topicsLock.RUnlock()
+	if !ok {
+		return NewError(
+			ErrTopicNotExisted,
+			`queue remove`,
+		)
+	}
 
+	// unregistered first, so that the topic is not created again by the
+	// registry. The registry lock is held, not the topics lock.
+	if !fromEtcd {
+		err := u.unRegisterTopic(name)
+		if err != nil && !isError(err, ErrTopicNotExisted) {
+			return err
+		}
+	}
+
+	u.topicsLock.Lock()
 	t, ok := u.topics[name]
 	if !ok {
+		u.topicsLock.Unlock()
 		return NewError(
 			ErrTopicNotExisted,
 			`queue remove`,
 		)
 	}
-
 	delete(u.topics, name)
 	err := u.exportQueue()
 	if err != nil {
 		u.topics[name] = t
-		return err
 	}
-
-	if !fromEtcd {
-		u.unRegisterTopic(name)
+	u.topicsLock.Unlock()
+	if err != nil {
+		if !fromEtcd {
+			u.registerTopic(name, t.getOptions().String())
+			t.linesLock.RLock()
+			for lineName, l := range t.lines {
+				u.registerLine(name, lineName, l.recycle.String())
+			}
+			t.linesLock.RUnlock()
+		}
+		return err
 	}
 
 	return t.remove()
 }
 
+// remove removes the topic or line. The registry lock is held.
 func (u *UnitedQueue) remove(key string, fromEtcd bool) error {
 	key = strings.TrimPrefix(key, "/")
 	key = strings.TrimSuffix(key, "/")
@@ -702,13 +892,18 @@ func (u *UnitedQueue) remove(key string, fromEtcd bool) error {
 }
 
 func (u *UnitedQueue) Remove(key string) error {
+	u.registryLock.Lock()
+	defer u.registryLock.Unlock()
 	return u.remove(key, false)
 }
 
 func (u *UnitedQueue) Close() {
 	log.Printf("uq stoping...")
-	close(u.etcdStop)
+	close(u.coordStop)
 	u.wg.Wait()
+	if u.coordinator != nil {
+		u.coordinator.Close()
+	}
 
 	for _, t := range u.topics {
 		t.close()
@@ -718,6 +913,7 @@ func (u *UnitedQueue) Close() {
 	if err != nil {
 		log.Printf("export queue error: %s", err)
 	}
+	u.stopReplication()
 
 	u.storage.Close()
 }
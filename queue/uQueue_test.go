@@ -1,11 +1,17 @@
 package queue
 
 import (
+	"bytes"
+	"net"
+	"net/rpc"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/buaazp/uq/store"
+	. "github.com/buaazp/uq/utils"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -190,6 +196,522 @@ func TestRemove(t *testing.T) {
 	})
 }
 
+func TestTopicCapacity(t *testing.T) {
+	Convey("Test Topic Options", t, func() {
+		o, err := ParseTopicOptions("max-messages=2,max-bytes=10")
+		So(err, ShouldBeNil)
+		So(o.Policy, ShouldEqual, PolicyReject)
+		So(o.String(), ShouldEqual, "max-messages=2,max-bytes=10,policy=reject")
+		_, err = ParseTopicOptions("policy=wait")
+		So(err, ShouldNotBeNil)
+		err = uq.Create("bad", "max-messages=x")
+		So(err, ShouldNotBeNil)
+
+		// a bare duration is ignored
+		err = uq.Create("dur", "10s")
+		So(err, ShouldBeNil)
+		qs, err := uq.Stat("dur")
+		So(err, ShouldBeNil)
+		So(qs.Policy, ShouldEqual, "")
+
+		// the options registered are reconciled
+		err = uq.applyEvent(Event{Type: EventCreate, Key: "dur", Value: "max-messages=5"})
+		So(err, ShouldNotBeNil)
+		qs, err = uq.Stat("dur")
+		So(err, ShouldBeNil)
+		So(qs.MaxMessages, ShouldEqual, 5)
+		So(qs.Policy, ShouldEqual, PolicyReject)
+		err = uq.applyEvent(Event{Type: EventCreate, Key: "dur", Value: ""})
+		So(err, ShouldNotBeNil)
+		qs, err = uq.Stat("dur")
+		So(err, ShouldBeNil)
+		So(qs.MaxMessages, ShouldEqual, 5)
+	})
+
+	Convey("Test Reject Policy", t, func() {
+		err := uq.Create("cap", "max-messages=2")
+		So(err, ShouldBeNil)
+		err = uq.Create("cap/x", "")
+		So(err, ShouldBeNil)
+		err = uq.MultiPush("cap", [][]byte{[]byte("1"), []byte("2")})
+		So(err, ShouldBeNil)
+		err = uq.Push("cap", []byte("3"))
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrTopicFull)
+
+		// consumed messages are cleaned to make room
+		_, _, err = uq.Pop("cap/x")
+		So(err, ShouldBeNil)
+		err = uq.Push("cap", []byte("3"))
+		So(err, ShouldBeNil)
+
+		qs, err := uq.Stat("cap")
+		So(err, ShouldBeNil)
+		So(qs.Count, ShouldEqual, 2)
+		So(qs.Fill, ShouldEqual, "100.0%")
+	})
+
+	Convey("Test Drop Policy", t, func() {
+		err := uq.Create("capd", "max-bytes=4,policy=drop")
+		So(err, ShouldBeNil)
+		err = uq.Create("capd/x", "10s")
+		So(err, ShouldBeNil)
+		err = uq.Push("capd", []byte("12"))
+		So(err, ShouldBeNil)
+		_, _, err = uq.Pop("capd/x")
+		So(err, ShouldBeNil)
+		err = uq.Push("capd", []byte("34"))
+		So(err, ShouldBeNil)
+		err = uq.Push("capd", []byte("56"))
+		So(err, ShouldBeNil)
+		err = uq.Push("capd", []byte("78910"))
+		So(err, ShouldNotBeNil)
+
+		_, data, err := uq.Pop("capd/x")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "34")
+		qs, err := uq.Stat("capd")
+		So(err, ShouldBeNil)
+		So(qs.Bytes, ShouldEqual, 4)
+		ls, err := uq.Stat("capd/x")
+		So(err, ShouldBeNil)
+		So(ls.IHead, ShouldEqual, 1)
+	})
+
+	Convey("Test Block Policy", t, func() {
+		err := uq.Create("capb", "max-messages=1,policy=block")
+		So(err, ShouldBeNil)
+		err = uq.Create("capb/x", "")
+		So(err, ShouldBeNil)
+		err = uq.Push("capb", []byte("1"))
+		So(err, ShouldBeNil)
+
+		go func() {
+			time.Sleep(3 * TopicBlockInterval)
+			uq.Pop("capb/x")
+		}()
+		begin := time.Now()
+		err = uq.Push("capb", []byte("2"))
+		So(err, ShouldBeNil)
+		So(time.Since(begin), ShouldBeGreaterThanOrEqualTo, 3*TopicBlockInterval)
+	})
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	Convey("Test Max Message Size", t, func() {
+		err := uq.Create("small", "max-message-size=2")
+		So(err, ShouldBeNil)
+		err = uq.Push("small", []byte("12"))
+		So(err, ShouldBeNil)
+		err = uq.MultiPush("small", [][]byte{[]byte("1"), []byte("123")})
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrMessageTooLarge)
+
+		uq.SetMaxMessageSize(1)
+		defer uq.SetMaxMessageSize(DefaultMaxMessageSize)
+		err = uq.Push("small", []byte("12"))
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrMessageTooLarge)
+	})
+}
+
+func TestCompression(t *testing.T) {
+	Convey("Test Compression And Chunks", t, func() {
+		err := uq.Create("zc", "compression=snappy")
+		So(err, ShouldBeNil)
+		err = uq.Create("zc/x", "")
+		So(err, ShouldBeNil)
+		err = uq.Create("zz", "compression=zstd")
+		So(err, ShouldBeNil)
+		err = uq.Create("zz/x", "")
+		So(err, ShouldBeNil)
+
+		data := make([]byte, 100)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		uq.SetChunkSize(16)
+		defer uq.SetChunkSize(DefaultChunkSize)
+		for _, name := range []string{"zc", "zz"} {
+			err = uq.MultiPush(name, [][]byte{data, []byte("1")})
+			So(err, ShouldBeNil)
+			_, err = ldb.Get(name + ":0:1")
+			So(err, ShouldBeNil)
+
+			_, msg, err := uq.Pop(name + "/x")
+			So(err, ShouldBeNil)
+			So(msg, ShouldResemble, data)
+			_, msg, err = uq.Pop(name + "/x")
+			So(err, ShouldBeNil)
+			So(string(msg), ShouldEqual, "1")
+		}
+
+		qs, err := uq.Stat("zz")
+		So(err, ShouldBeNil)
+		So(qs.Compression, ShouldEqual, CompressionZstd)
+
+		err = uq.Push("zc", data)
+		So(err, ShouldBeNil)
+	})
+}
+
+// slowCoordinator takes a while to unregister a topic, like an etcd far
+// away.
+type slowCoordinator struct {
+	Coordinator
+}
+
+func (c *slowCoordinator) Pull() ([]Event, error)                    { return nil, nil }
+func (c *slowCoordinator) RegisterTopic(topic, options string) error { return nil }
+func (c *slowCoordinator) Close() error                              { return nil }
+
+func (c *slowCoordinator) Watch(events chan<- Event, stop chan bool) error {
+	<-stop
+	return nil
+}
+
+func (c *slowCoordinator) UnRegisterTopic(topic string) error {
+	time.Sleep(500 * time.Millisecond)
+	return nil
+}
+
+func TestRegistryLockScope(t *testing.T) {
+	Convey("Test Pushes Not Blocked By The Registry", t, func() {
+		ms, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		u, err := NewUnitedQueue(ms, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer u.Close()
+		u.SetCoordinator(&slowCoordinator{})
+		So(u.Create("slow", ""), ShouldBeNil)
+		So(u.Create("fast", ""), ShouldBeNil)
+
+		removed := make(chan error)
+		go func() {
+			removed <- u.Remove("slow")
+		}()
+		time.Sleep(100 * time.Millisecond)
+		begin := time.Now()
+		So(u.Push("fast", []byte("1")), ShouldBeNil)
+		So(time.Since(begin), ShouldBeLessThan, 200*time.Millisecond)
+		So(<-removed, ShouldBeNil)
+	})
+}
+
+func TestReplication(t *testing.T) {
+	Convey("Test Replication And Takeover", t, func() {
+		ms1, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		leader, err := NewUnitedQueue(ms1, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		ms2, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		follower, err := NewUnitedQueue(ms2, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer ln.Close()
+		follower.SetReplicaAuth("secret", nil)
+		leader.SetReplicaAuth("secret", nil)
+		go follower.ServeReplica(ln)
+
+		// a topic removed from the leader while the follower was away
+		ms3, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		old, err := NewUnitedQueue(ms3, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		err = old.Create("gone", "")
+		So(err, ShouldBeNil)
+		err = old.Push("gone", []byte("x"))
+		So(err, ShouldBeNil)
+		keys, err := queueKeys(old.getData)
+		So(err, ShouldBeNil)
+		var ops []ReplicaOp
+		for _, key := range keys {
+			data, err := old.getData(key)
+			So(err, ShouldBeNil)
+			ops = append(ops, ReplicaOp{Key: key, Data: data})
+		}
+		old.Close()
+		client, err := rpc.Dial("tcp", ln.Addr().String())
+		So(err, ShouldBeNil)
+		var n int
+		err = client.Call("Replica.Apply", &ReplicaArgs{Secret: "wrong", Leader: "leader", Ops: ops}, &n)
+		So(err, ShouldNotBeNil)
+		err = client.Call("Replica.Apply", &ReplicaArgs{Secret: "secret", Leader: "leader", Ops: ops}, &n)
+		So(err, ShouldBeNil)
+		client.Close()
+		_, err = ms2.Get(replicaKey("leader", "gone:0"))
+		So(err, ShouldBeNil)
+
+		err = leader.Create("rep", "compression=snappy")
+		So(err, ShouldBeNil)
+		err = leader.Create("rep/x", "")
+		So(err, ShouldBeNil)
+		err = leader.MultiPush("rep", [][]byte{[]byte("0"), []byte("1"), []byte("2")})
+		So(err, ShouldBeNil)
+
+		leader.Replicate("leader", []string{ln.Addr().String()})
+		_, _, err = leader.MultiPop("rep/x", 2)
+		So(err, ShouldBeNil)
+		err = leader.MultiPush("rep", [][]byte{[]byte("3"), []byte("4")})
+		So(err, ShouldBeNil)
+		for i := 0; i < 20; i++ {
+			if _, err = ms2.Get(replicaKey("leader", "rep:4")); err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		So(err, ShouldBeNil)
+		_, err = ms2.Get(replicaKey("leader", "gone:0"))
+		So(err, ShouldNotBeNil)
+		leader.Close()
+
+		err = follower.Takeover("leader", "nope")
+		So(err, ShouldNotBeNil)
+		err = follower.Takeover("leader", "rep")
+		So(err, ShouldBeNil)
+		id, data, err := follower.Pop("rep/x")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "rep/x/2")
+		So(string(data), ShouldEqual, "2")
+		qs, err := follower.Stat("rep")
+		So(err, ShouldBeNil)
+		So(qs.Tail, ShouldEqual, 5)
+		follower.Close()
+	})
+}
+
+func TestMigration(t *testing.T) {
+	Convey("Test Drain And Migration", t, func() {
+		ms1, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		source, err := NewUnitedQueue(ms1, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer source.Close()
+		source.SetReplicaAuth("secret", nil)
+		targets := make([]*UnitedQueue, 2)
+		addrs := make([]string, 2)
+		for i := range targets {
+			ms, err := store.NewMemStore()
+			So(err, ShouldBeNil)
+			targets[i], err = NewUnitedQueue(ms, "127.0.0.1", 0, nil, "uq")
+			So(err, ShouldBeNil)
+			defer targets[i].Close()
+			targets[i].SetReplicaAuth("secret", nil)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer ln.Close()
+			go targets[i].ServeReplica(ln)
+			addrs[i] = ln.Addr().String()
+		}
+
+		err = source.Create("mig", "")
+		So(err, ShouldBeNil)
+		err = source.Create("mig/x", "")
+		So(err, ShouldBeNil)
+		err = source.Create("mig/y", "")
+		So(err, ShouldBeNil)
+		err = source.MultiPush("mig", [][]byte{[]byte("0"), []byte("1"), []byte("2"), []byte("3")})
+		So(err, ShouldBeNil)
+		_, _, err = source.MultiPop("mig/y", 2)
+		So(err, ShouldBeNil)
+
+		source.Drain(true)
+		err = source.Push("mig", []byte("4"))
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrDraining)
+		id, _, err := source.Pop("mig/x")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "mig/x/0")
+
+		// only with the secret of the target
+		source.SetReplicaAuth("wrong", nil)
+		_, err = source.Migrate("mig", addrs[0])
+		So(err, ShouldNotBeNil)
+		source.SetReplicaAuth("secret", nil)
+
+		// the ids are preserved on a blank target
+		ids, err := source.Migrate("mig", addrs[0])
+		So(err, ShouldBeNil)
+		So(ids, ShouldBeEmpty)
+		id, data, err := targets[0].Pop("mig/x")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "mig/x/1")
+		So(string(data), ShouldEqual, "1")
+
+		// or mapped to the ones appended
+		err = targets[1].Create("mig", "")
+		So(err, ShouldBeNil)
+		err = targets[1].Push("mig", []byte("a"))
+		So(err, ShouldBeNil)
+		targets[1].Drain(true)
+		_, err = source.Migrate("mig", addrs[1])
+		So(err, ShouldNotBeNil)
+		targets[1].Drain(false)
+		ids, err = source.Migrate("mig", addrs[1])
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []IDRange{{From: 1, To: 1, Count: 3}})
+		// the cursors of the lines are moved to the ids appended
+		ids2, datas, err := targets[1].MultiPop("mig/x", 5)
+		So(err, ShouldBeNil)
+		So(ids2, ShouldResemble, []string{"mig/x/1", "mig/x/2", "mig/x/3"})
+		So(string(datas[0]), ShouldEqual, "1")
+		ids2, datas, err = targets[1].MultiPop("mig/y", 5)
+		So(err, ShouldBeNil)
+		So(ids2, ShouldResemble, []string{"mig/y/2", "mig/y/3"})
+		So(string(datas[0]), ShouldEqual, "2")
+
+		_, err = source.Migrate("nope", addrs[1])
+		So(err, ShouldNotBeNil)
+		source.Drain(false)
+		So(source.Draining(), ShouldBeFalse)
+	})
+}
+
+func TestBackup(t *testing.T) {
+	Convey("Test Backup And Restore", t, func() {
+		ms1, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		u1, err := NewUnitedQueue(ms1, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer u1.Close()
+		err = u1.Create("bak", "compression=snappy")
+		So(err, ShouldBeNil)
+		err = u1.Create("bak/x", "")
+		So(err, ShouldBeNil)
+		err = u1.MultiPush("bak", [][]byte{[]byte("0"), []byte("1"), []byte("2")})
+		So(err, ShouldBeNil)
+		_, _, err = u1.Pop("bak/x")
+		So(err, ShouldBeNil)
+
+		buf := new(bytes.Buffer)
+		err = u1.Backup(buf)
+		So(err, ShouldBeNil)
+
+		ms2, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		err = Restore(ms2, bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		err = Restore(ms2, bytes.NewReader(buf.Bytes()))
+		So(err, ShouldNotBeNil)
+		u2, err := NewUnitedQueue(ms2, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer u2.Close()
+		qs, err := u2.Stat("bak")
+		So(err, ShouldBeNil)
+		So(qs.Tail, ShouldEqual, 3)
+		id, data, err := u2.Pop("bak/x")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "bak/x/1")
+		So(string(data), ShouldEqual, "1")
+	})
+}
+
+func TestExport(t *testing.T) {
+	Convey("Test Export And Import", t, func() {
+		ms1, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		u1, err := NewUnitedQueue(ms1, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer u1.Close()
+		err = u1.Create("exp", "")
+		So(err, ShouldBeNil)
+		err = u1.Create("exp/x", "10s")
+		So(err, ShouldBeNil)
+		err = u1.Create("exp/y", "")
+		So(err, ShouldBeNil)
+		err = u1.MultiPush("exp", [][]byte{[]byte("0"), []byte("1"), []byte("2"), []byte("3")})
+		So(err, ShouldBeNil)
+		_, _, err = u1.Pop("exp/x")
+		So(err, ShouldBeNil)
+		_, _, err = u1.Pop("exp/x")
+		So(err, ShouldBeNil)
+		err = u1.Confirm("exp/x/0")
+		So(err, ShouldBeNil)
+		_, _, err = u1.Pop("exp/y")
+		So(err, ShouldBeNil)
+
+		buf := new(bytes.Buffer)
+		err = u1.Export("exp", buf)
+		So(err, ShouldBeNil)
+		So(bytes.Count(buf.Bytes(), []byte("\n")), ShouldEqual, 5)
+		err = u1.Export("none", buf)
+		So(err, ShouldNotBeNil)
+
+		// a fresh topic keeps the ids, times and cursors
+		ms2, err := store.NewMemStore()
+		So(err, ShouldBeNil)
+		u2, err := NewUnitedQueue(ms2, "127.0.0.1", 0, nil, "uq")
+		So(err, ShouldBeNil)
+		defer u2.Close()
+		ranges, err := u2.Import("", bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(ranges, ShouldBeEmpty)
+		qs, err := u2.Stat("exp")
+		So(err, ShouldBeNil)
+		So(qs.Tail, ShouldEqual, 4)
+		_, meta1, err := u1.topics["exp"].getDataMeta(3)
+		So(err, ShouldBeNil)
+		_, meta2, err := u2.topics["exp"].getDataMeta(3)
+		So(err, ShouldBeNil)
+		So(meta2.pushed, ShouldEqual, meta1.pushed)
+		So(meta2.pushed, ShouldBeGreaterThan, 0)
+		err = u2.Confirm("exp/x/1")
+		So(err, ShouldBeNil)
+		id, data, err := u2.Pop("exp/x")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "exp/x/2")
+		So(string(data), ShouldEqual, "2")
+		id, _, err = u2.Pop("exp/y")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "exp/y/1")
+
+		// an existing topic gets the messages not consumed by all lines
+		err = u2.Create("other", "")
+		So(err, ShouldBeNil)
+		err = u2.Push("other", []byte("a"))
+		So(err, ShouldBeNil)
+		ranges, err = u2.Import("other", bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(ranges, ShouldResemble, []IDRange{{From: 1, To: 1, Count: 3}})
+		qs, err = u2.Stat("other")
+		So(err, ShouldBeNil)
+		So(qs.Tail, ShouldEqual, 4)
+
+		_, err = u2.Import("bad", bytes.NewReader([]byte("{")))
+		So(err, ShouldNotBeNil)
+
+		// a draining queue imports nothing
+		u2.Drain(true)
+		_, err = u2.Import("drained", bytes.NewReader(buf.Bytes()))
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrDraining)
+		u2.Drain(false)
+
+		// the messages too large fail, and a fresh topic is left blank
+		big := `{"topic":"big","head":0,"tail":2}
+{"id":0,"data":"YQ=="}
+{"id":1,"data":"YWJjZA=="}
+`
+		u2.SetMaxMessageSize(3)
+		_, err = u2.Import("", strings.NewReader(big))
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrMessageTooLarge)
+		_, err = u2.getData("big:0")
+		So(err, ShouldNotBeNil)
+		qs, err = u2.Stat("big")
+		So(err, ShouldBeNil)
+		So(qs.Head, ShouldEqual, 0)
+		So(qs.Tail, ShouldEqual, 0)
+		_, err = u2.Import("other", strings.NewReader(big))
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrMessageTooLarge)
+		qs, err = u2.Stat("other")
+		So(err, ShouldBeNil)
+		So(qs.Tail, ShouldEqual, 4)
+	})
+}
+
 func TestClose(t *testing.T) {
 	Convey("Test Close Queue", t, func() {
 		uq.Close()
@@ -205,6 +727,11 @@ func TestLoad(t *testing.T) {
 		uq, err = NewUnitedQueue(ldb, "127.0.0.1", 9689, nil, "uq")
 		So(err, ShouldBeNil)
 		So(uq, ShouldNotBeNil)
+		So(uq.topics["cap"].options.MaxMessages, ShouldEqual, 2)
+		So(uq.topics["capd"].bytes, ShouldEqual, 4)
+		_, msg, err := uq.Pop("zc/x")
+		So(err, ShouldBeNil)
+		So(len(msg), ShouldEqual, 100)
 
 		uq.Close()
 
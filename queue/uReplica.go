@@ -0,0 +1,486 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/gob"
+	"log"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/buaazp/uq/utils"
+)
+
+const (
+	ReplicaRetryInterval time.Duration = time.Second
+	ReplicaBufferSize    int           = 10240
+	ReplicaBatchSize     int           = 256
+
+	// KeyReplicaPrefix is the namespace of the data replicated from other
+	// nodes, such as replica/<leader>/<key>.
+	KeyReplicaPrefix string = "replica/"
+)
+
+// ReplicaOp is a write to the storage of the leader.
+type ReplicaOp struct {
+	Del  bool
+	Key  string
+	Data []byte
+}
+
+// ReplicaArgs carries the writes of a leader to a replica. The secret
+// should be the one of the replica port.
+type ReplicaArgs struct {
+	Secret string
+	Leader string
+	Ops    []ReplicaOp
+}
+
+func replicaKey(leader, key string) string {
+	return KeyReplicaPrefix + leader + "/" + key
+}
+
+// SetReplicaAuth sets the secret shared by the replica ports, which this
+// node requires and sends on each call. The config dials the replica
+// ports of other nodes by tls, nil for plain tcp.
+func (u *UnitedQueue) SetReplicaAuth(secret string, config *tls.Config) {
+	u.replicaSecret = secret
+	u.replicaTLS = config
+}
+
+// dialReplica connects the replica port of another node.
+func (u *UnitedQueue) dialReplica(addr string) (*rpc.Client, error) {
+	if u.replicaTLS == nil {
+		return rpc.Dial("tcp", addr)
+	}
+	conn, err := tls.Dial("tcp", addr, u.replicaTLS)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// replica streams the writes of the leader to a follower. The follower
+// is resynced from the storage after it was unreachable or the writes
+// overflowed the buffer.
+type replica struct {
+	addr   string
+	client *rpc.Client
+	ops    chan ReplicaOp
+	resync bool
+	mu     sync.Mutex
+}
+
+type replicator struct {
+	self     string
+	replicas []*replica
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+// Replicate streams the topics of the queue to the replicas. The self is
+// the name of this node as a leader, which the replicas keep the data
+// under. It should be called before the queue serves.
+func (u *UnitedQueue) Replicate(self string, addrs []string) {
+	rp := new(replicator)
+	rp.self = self
+	rp.quit = make(chan bool)
+	for _, addr := range addrs {
+		r := new(replica)
+		r.addr = addr
+		r.ops = make(chan ReplicaOp, ReplicaBufferSize)
+		r.resync = true
+		rp.replicas = append(rp.replicas, r)
+	}
+	u.replicator = rp
+
+	for _, r := range rp.replicas {
+		rp.wg.Add(1)
+		go u.replicaRun(r)
+	}
+}
+
+func (u *UnitedQueue) stopReplication() {
+	if u.replicator == nil {
+		return
+	}
+	close(u.replicator.quit)
+	u.replicator.wg.Wait()
+}
+
+// replicate queues the write to the replicas without blocking.
+func (u *UnitedQueue) replicate(op ReplicaOp) {
+	if u.replicator == nil || strings.HasPrefix(op.Key, KeyReplicaPrefix) {
+		return
+	}
+	for _, r := range u.replicator.replicas {
+		select {
+		case r.ops <- op:
+		default:
+			r.mu.Lock()
+			r.resync = true
+			r.mu.Unlock()
+		}
+	}
+}
+
+// replicateLine exports the line after its cursor moved, so the replicas
+// follow the consumption.
+func (u *UnitedQueue) replicateLine(t *topic, name string) {
+	if u.replicator == nil {
+		return
+	}
+	t.linesLock.RLock()
+	l, ok := t.lines[name]
+	t.linesLock.RUnlock()
+	if !ok {
+		return
+	}
+
+	l.inflightLock.RLock()
+	l.headLock.RLock()
+	err := l.exportLine()
+	l.headLock.RUnlock()
+	l.inflightLock.RUnlock()
+	if err != nil {
+		log.Printf("topic[%s] line[%s] export error: %s", t.name, name, err)
+	}
+}
+
+func (u *UnitedQueue) replicaRun(r *replica) {
+	rp := u.replicator
+	defer rp.wg.Done()
+	defer func() {
+		if r.client != nil {
+			r.client.Close()
+		}
+	}()
+
+	for {
+		r.mu.Lock()
+		resync := r.resync
+		r.resync = false
+		r.mu.Unlock()
+		if r.client == nil || resync {
+			err := u.resyncReplica(r)
+			if err != nil {
+				log.Printf("replica[%s] resync error: %s", r.addr, err)
+				r.mu.Lock()
+				r.resync = true
+				r.mu.Unlock()
+				select {
+				case <-rp.quit:
+					return
+				case <-time.After(ReplicaRetryInterval):
+				}
+				continue
+			}
+			log.Printf("replica[%s] resynced.", r.addr)
+		}
+
+		select {
+		case <-rp.quit:
+			// flush the writes left, best effort
+			u.sendOps(r, drainOps(r.ops, len(r.ops)))
+			return
+		case op := <-r.ops:
+			ops := append([]ReplicaOp{op}, drainOps(r.ops, ReplicaBatchSize-1)...)
+			err := u.sendOps(r, ops)
+			if err != nil {
+				log.Printf("replica[%s] send error: %s", r.addr, err)
+				r.mu.Lock()
+				r.resync = true
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+func drainOps(ch chan ReplicaOp, n int) []ReplicaOp {
+	ops := make([]ReplicaOp, 0, n)
+	for len(ops) < n {
+		select {
+		case op := <-ch:
+			ops = append(ops, op)
+		default:
+			return ops
+		}
+	}
+	return ops
+}
+
+func (u *UnitedQueue) sendOps(r *replica, ops []ReplicaOp) error {
+	if len(ops) == 0 || r.client == nil {
+		return nil
+	}
+	args := &ReplicaArgs{Secret: u.replicaSecret, Leader: u.replicator.self, Ops: ops}
+	var n int
+	err := r.client.Call("Replica.Apply", args, &n)
+	if err != nil {
+		r.client.Close()
+		r.client = nil
+		return err
+	}
+	return nil
+}
+
+// resyncReplica connects the replica, clears what it has of this node
+// and sends all the topics in the storage. The writes queued before are
+// covered by the snapshot.
+func (u *UnitedQueue) resyncReplica(r *replica) error {
+	if r.client == nil {
+		client, err := u.dialReplica(r.addr)
+		if err != nil {
+			return err
+		}
+		r.client = client
+	}
+	drainOps(r.ops, len(r.ops))
+
+	// the keys deleted while the replica was unreachable
+	var n int
+	args := &ReplicaArgs{Secret: u.replicaSecret, Leader: u.replicator.self}
+	err := r.client.Call("Replica.Reset", args, &n)
+	if err != nil {
+		r.client.Close()
+		r.client = nil
+		return err
+	}
+
+	keys, err := queueKeys(u.getData)
+	if err != nil {
+		return err
+	}
+	ops := make([]ReplicaOp, 0, ReplicaBatchSize)
+	for _, key := range keys {
+		data, err := u.getData(key)
+		if err != nil {
+			// removed since listed
+			continue
+		}
+		ops = append(ops, ReplicaOp{Key: key, Data: data})
+		if len(ops) == ReplicaBatchSize {
+			err = u.sendOps(r, ops)
+			if err != nil {
+				return err
+			}
+			ops = ops[:0]
+		}
+	}
+	return u.sendOps(r, ops)
+}
+
+// queueKeys lists the keys of the queue and all its topics.
+func queueKeys(get func(string) ([]byte, error)) ([]string, error) {
+	data, err := get(StorageKeyWord)
+	if err != nil {
+		// a blank queue
+		return nil, nil
+	}
+	var qs unitedQueueStore
+	err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&qs)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{StorageKeyWord}
+	for _, name := range qs.Topics {
+		topicKeys, err := topicKeys(get, name)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, topicKeys...)
+	}
+	return keys, nil
+}
+
+// topicKeys lists the keys of the topic stored by the getter, which are
+// its store, head, tail, lines and messages with their chunks.
+func topicKeys(get func(string) ([]byte, error), name string) ([]string, error) {
+	data, err := get(name)
+	if err != nil {
+		return nil, NewError(
+			ErrTopicNotExisted,
+			`topic keys `+name,
+		)
+	}
+	var ts topicStore
+	err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&ts)
+	if err != nil {
+		return nil, NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	headData, err := get(name + KeyTopicHead)
+	if err != nil {
+		return nil, err
+	}
+	tailData, err := get(name + KeyTopicTail)
+	if err != nil {
+		return nil, err
+	}
+	head := binary.LittleEndian.Uint64(headData)
+	tail := binary.LittleEndian.Uint64(tailData)
+
+	keys := []string{name, name + KeyTopicHead, name + KeyTopicTail}
+	for _, lineName := range ts.Lines {
+		keys = append(keys, name+"/"+lineName, name+"/"+lineName+KeyLineRecycle)
+	}
+	for id := head; id < tail; id++ {
+		key := Acatui(name, ":", id)
+		keys = append(keys, key)
+		if ts.Format == topicFormatRaw {
+			continue
+		}
+		value, err := get(key)
+		if err != nil {
+			continue
+		}
+		h, err := decodeHeader(value)
+		if err != nil {
+			continue
+		}
+		for i := uint64(1); i <= h.chunks; i++ {
+			keys = append(keys, chunkKey(key, i))
+		}
+	}
+	return keys, nil
+}
+
+type replicaService struct {
+	u *UnitedQueue
+}
+
+// authorize checks the secret of a call. No call is served if this node
+// has no secret.
+func (s *replicaService) authorize(secret string) error {
+	if s.u.replicaSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(secret), []byte(s.u.replicaSecret)) != 1 {
+		return NewError(
+			ErrUnauthorized,
+			`replica secret`,
+		)
+	}
+	return nil
+}
+
+// Apply stores the writes of the leader under its namespace.
+func (s *replicaService) Apply(args *ReplicaArgs, n *int) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	for _, op := range args.Ops {
+		key := replicaKey(args.Leader, op.Key)
+		if op.Del {
+			s.u.storage.Del(key)
+			continue
+		}
+		err := s.u.storage.Set(key, op.Data)
+		if err != nil {
+			return err
+		}
+		*n++
+	}
+	return nil
+}
+
+// Reset deletes the topics of the leader under its namespace, before it
+// sends them all again.
+func (s *replicaService) Reset(args *ReplicaArgs, n *int) error {
+	err := s.authorize(args.Secret)
+	if err != nil {
+		return err
+	}
+	get := func(key string) ([]byte, error) {
+		return s.u.getData(replicaKey(args.Leader, key))
+	}
+	keys, err := queueKeys(get)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		s.u.storage.Del(replicaKey(args.Leader, key))
+		*n++
+	}
+	return nil
+}
+
+// ServeReplica accepts the leaders streaming their topics to this node
+// until the listener is closed.
+func (u *UnitedQueue) ServeReplica(ln net.Listener) {
+	server := rpc.NewServer()
+	server.RegisterName("Replica", &replicaService{u})
+	log.Printf("replica serving at %s...", ln.Addr())
+	server.Accept(ln)
+}
+
+// Takeover serves the topic replicated from the leader on this node. A
+// blank local topic of the same name, like one created by etcd, is
+// replaced.
+func (u *UnitedQueue) Takeover(leader, name string) error {
+	get := func(key string) ([]byte, error) {
+		return u.getData(replicaKey(leader, key))
+	}
+	keys, err := topicKeys(get, name)
+	if err != nil {
+		return err
+	}
+
+	u.topicsLock.Lock()
+	defer u.topicsLock.Unlock()
+
+	if t, ok := u.topics[name]; ok {
+		if t.getTail() > 0 {
+			return NewError(
+				ErrTopicExisted,
+				`queue takeover`,
+			)
+		}
+		delete(u.topics, name)
+		t.remove()
+	}
+
+	for _, key := range keys {
+		data, err := get(key)
+		if err != nil {
+			continue
+		}
+		err = u.setData(key, data)
+		if err != nil {
+			return err
+		}
+		u.storage.Del(replicaKey(leader, key))
+	}
+
+	topicStoreData, err := u.getData(name)
+	if err != nil {
+		return err
+	}
+	var topicStoreValue topicStore
+	err = gob.NewDecoder(bytes.NewBuffer(topicStoreData)).Decode(&topicStoreValue)
+	if err != nil {
+		return NewError(
+			ErrInternalError,
+			err.Error(),
+		)
+	}
+	t, err := u.loadTopic(name, topicStoreValue)
+	if err != nil {
+		return err
+	}
+	u.topics[name] = t
+
+	err = u.exportQueue()
+	if err != nil {
+		return err
+	}
+	log.Printf("topic[%s] taken over from %s.", name, leader)
+	return nil
+}
@@ -15,6 +15,17 @@ type QueueStat struct {
 	IHead   uint64       `json:"ihead"`
 	Tail    uint64       `json:"tail"`
 	Count   uint64       `json:"count"`
+
+	Throttled uint64 `json:"throttled,omitempty"`
+
+	Policy      string `json:"policy,omitempty"`
+	MaxMessages uint64 `json:"maxMessages,omitempty"`
+	MaxBytes    uint64 `json:"maxBytes,omitempty"`
+	Bytes       uint64 `json:"bytes,omitempty"`
+	Fill        string `json:"fill,omitempty"`
+
+	MaxMessageSize int    `json:"maxMessageSize,omitempty"`
+	Compression    string `json:"compression,omitempty"`
 }
 
 func (q *QueueStat) ToString() string {
@@ -46,6 +57,26 @@ func (q *QueueStat) ToStrings() []string {
 	}
 	replys = append(replys, "tail:"+strconv.FormatUint(q.Tail, 10))
 	replys = append(replys, "count:"+strconv.FormatUint(q.Count, 10))
+	if q.Policy != "" {
+		replys = append(replys, "policy:"+q.Policy)
+		if q.MaxMessages > 0 {
+			replys = append(replys, "max_messages:"+strconv.FormatUint(q.MaxMessages, 10))
+		}
+		if q.MaxBytes > 0 {
+			replys = append(replys, "max_bytes:"+strconv.FormatUint(q.MaxBytes, 10))
+			replys = append(replys, "bytes:"+strconv.FormatUint(q.Bytes, 10))
+		}
+		replys = append(replys, "fill:"+q.Fill)
+	}
+	if q.MaxMessageSize > 0 {
+		replys = append(replys, "max_message_size:"+strconv.Itoa(q.MaxMessageSize))
+	}
+	if q.Compression != "" {
+		replys = append(replys, "compression:"+q.Compression)
+	}
+	if q.Throttled > 0 {
+		replys = append(replys, "throttled:"+strconv.FormatUint(q.Throttled, 10))
+	}
 
 	if q.Type == "topic" && q.Lines != nil {
 		for _, lineStat := range q.Lines {
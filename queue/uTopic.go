@@ -6,7 +6,9 @@ import (
 	"encoding/binary"
 	"encoding/gob"
 	"log"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/buaazp/uq/utils"
@@ -28,22 +30,59 @@ type topic struct {
 	tailKey   string
 	q         *UnitedQueue
 
+	options     TopicOptions
+	optionsLock sync.RWMutex
+	format      int        // the format of the stored messages
+	bytes       uint64     // bytes between head and tail if max bytes is set
+	pushLock    sync.Mutex // serializes the pushes checking the capacity
+
 	quit chan bool
 	wg   sync.WaitGroup
 }
 
 type topicStore struct {
-	Lines []string
+	Lines   []string
+	Options TopicOptions
+	Format  int
 }
 
 func (t *topic) getData(id uint64) ([]byte, error) {
 	key := Acatui(t.name, ":", id)
-	return t.q.getData(key)
+	if t.format == topicFormatRaw {
+		return t.q.getData(key)
+	}
+	return t.decodeMessage(key)
 }
 
 func (t *topic) setData(id uint64, data []byte) error {
 	key := Acatui(t.name, ":", id)
-	return t.q.setData(key, data)
+	if t.format == topicFormatRaw {
+		return t.q.setData(key, data)
+	}
+	return t.encodeMessage(key, data)
+}
+
+// getDataMeta returns the message of id with its meta. The raw messages
+// have no meta.
+func (t *topic) getDataMeta(id uint64) ([]byte, messageMeta, error) {
+	key := Acatui(t.name, ":", id)
+	if t.format == topicFormatRaw {
+		data, err := t.q.getData(key)
+		return data, messageMeta{}, err
+	}
+	return t.decodeMessageMeta(key)
+}
+
+// setDataMeta stores the message of id with its meta, pushed now if the
+// push time is 0. The meta is dropped by the raw format.
+func (t *topic) setDataMeta(id uint64, data []byte, meta messageMeta) error {
+	if t.format == topicFormatRaw {
+		return t.q.setData(Acatui(t.name, ":", id), data)
+	}
+	if meta.pushed == 0 {
+		meta.pushed = time.Now().UnixNano()
+	}
+	return t.encodeMessageMeta(Acatui(t.name, ":", id), data, meta)
 }
 
 func (t *topic) getHead() uint64 {
@@ -104,6 +143,8 @@ func (t *topic) genTopicStore() *topicStore {
 
 	ts := new(topicStore)
 	ts.Lines = lines
+	ts.Options = t.getOptions()
+	ts.Format = t.format
 
 	return ts
 }
@@ -248,10 +289,9 @@ func (t *topic) clean() (quit bool) {
 			return
 		}
 
-		key := Acatui(t.name, ":", t.head)
-		err := t.q.delData(key)
+		err := t.delMessage(t.head)
 		if err != nil {
-			log.Printf("topic[%s] del %s error; %s", t.name, key, err)
+			log.Printf("topic[%s] del %d error; %s", t.name, t.head, err)
 			return
 		}
 
@@ -326,9 +366,9 @@ func (t *topic) newLine(name string, recycle time.Duration) (*line, error) {
 }
 
 func (t *topic) createLine(name string, recycle time.Duration, fromEtcd bool) error {
-	t.linesLock.Lock()
-	defer t.linesLock.Unlock()
+	t.linesLock.RLock()
 	_, ok := t.lines[name]
+	t.linesLock.RUnlock()
 	if ok {
 		return NewError(
 			ErrLineExisted,
@@ -336,35 +376,216 @@ func (t *topic) createLine(name string, recycle time.Duration, fromEtcd bool) er
 		)
 	}
 
+	// registered first, so that a line created by another server is not
+	// created here. The registry lock is held, not the lines lock.
+	if !fromEtcd {
+		err := t.q.registerLine(t.name, name, recycle.String())
+		if err != nil {
+			return err
+		}
+	}
+
 	l, err := t.newLine(name, recycle)
+	if err == nil {
+		t.linesLock.Lock()
+		t.lines[name] = l
+		err = t.exportTopic()
+		if err != nil {
+			delete(t.lines, name)
+		}
+		t.linesLock.Unlock()
+	}
 	if err != nil {
+		if !fromEtcd {
+			t.q.unRegisterLine(t.name, name)
+		}
 		return err
 	}
 
-	t.lines[name] = l
+	log.Printf("topic[%s] line[%s:%v] created.", t.name, name, recycle)
+	return nil
+}
+
+// delMessage deletes the message of id, and counts its bytes off if the
+// max bytes is set.
+func (t *topic) delMessage(id uint64) error {
+	key := Acatui(t.name, ":", id)
+	if t.format != topicFormatRaw {
+		size, err := t.deleteMessage(key)
+		if err != nil {
+			return err
+		}
+		if t.getOptions().MaxBytes > 0 {
+			atomic.AddUint64(&t.bytes, ^(size - 1))
+		}
+		return nil
+	}
+	if t.getOptions().MaxBytes > 0 {
+		data, err := t.q.getData(key)
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&t.bytes, ^uint64(len(data)-1))
+	}
+	return t.q.delData(key)
+}
+
+// countBytes sums the bytes of the messages kept by a loaded topic.
+func (t *topic) countBytes() error {
+	var bytes uint64
+	for i := t.head; i < t.tail; i++ {
+		data, err := t.getData(i)
+		if err != nil {
+			return err
+		}
+		bytes += uint64(len(data))
+	}
+	atomic.StoreUint64(&t.bytes, bytes)
+	return nil
+}
+
+func (t *topic) getOptions() TopicOptions {
+	t.optionsLock.RLock()
+	defer t.optionsLock.RUnlock()
+	return t.options
+}
+
+// setOptions changes the options to the ones registered in the cluster.
+// The pushes are blocked meanwhile, and the bytes are counted if the max
+// bytes was not set before.
+func (t *topic) setOptions(o TopicOptions) error {
+	t.pushLock.Lock()
+	defer t.pushLock.Unlock()
+	t.linesLock.Lock()
+	defer t.linesLock.Unlock()
+	t.headLock.Lock()
+	defer t.headLock.Unlock()
 
-	err = t.exportTopic()
+	old := t.getOptions()
+	if o.MaxBytes > 0 && old.MaxBytes == 0 {
+		err := t.countBytes()
+		if err != nil {
+			return err
+		}
+	}
+	t.optionsLock.Lock()
+	t.options = o
+	t.optionsLock.Unlock()
+
+	err := t.exportTopic()
 	if err != nil {
-		t.linesLock.Lock()
-		delete(t.lines, name)
-		t.linesLock.Unlock()
+		t.optionsLock.Lock()
+		t.options = old
+		t.optionsLock.Unlock()
 		return err
 	}
+	log.Printf("topic[%s] options changed: %s", t.name, o)
+	return nil
+}
 
-	if !fromEtcd {
-		t.q.registerLine(t.name, l.name, l.recycle.String())
+func (t *topic) full(head, n, size uint64) bool {
+	o := t.getOptions()
+	if o.MaxMessages > 0 && t.getTail()-head+n > o.MaxMessages {
+		return true
 	}
+	if o.MaxBytes > 0 && atomic.LoadUint64(&t.bytes)+size > o.MaxBytes {
+		return true
+	}
+	return false
+}
 
-	log.Printf("topic[%s] line[%s:%v] created.", t.name, name, recycle)
+// dropOldest drops the oldest messages until n messages of size bytes can
+// be pushed. The lines behind the new head skip the dropped messages.
+func (t *topic) dropOldest(n, size uint64) error {
+	t.linesLock.RLock()
+	defer t.linesLock.RUnlock()
+	t.headLock.Lock()
+	defer t.headLock.Unlock()
+
+	tail := t.getTail()
+	for t.head < tail && t.full(t.head, n, size) {
+		err := t.delMessage(t.head)
+		if err != nil {
+			return err
+		}
+		t.head++
+	}
+	err := t.exportHead()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t.lines {
+		l.skipTo(t.head)
+	}
 	return nil
 }
 
-func (t *topic) push(data []byte) error {
+// makeRoom makes room for n messages of size bytes by the policy of the
+// topic. The consumed messages are cleaned first.
+func (t *topic) makeRoom(n, size uint64) error {
+	o := t.getOptions()
+	if !o.limited() {
+		return nil
+	}
+	if (o.MaxMessages > 0 && n > o.MaxMessages) || (o.MaxBytes > 0 && size > o.MaxBytes) {
+		return NewError(
+			ErrTopicFull,
+			`messages exceed the capacity of topic `+t.name,
+		)
+	}
+	if !t.full(t.getHead(), n, size) {
+		return nil
+	}
+
+	t.clean()
+	switch o.Policy {
+	case PolicyDrop:
+		return t.dropOldest(n, size)
+	case PolicyBlock:
+		deadline := time.Now().Add(TopicBlockTimeout)
+		for t.full(t.getHead(), n, size) {
+			if time.Now().After(deadline) {
+				return NewError(
+					ErrTopicFull,
+					`topic `+t.name+` blocked for `+TopicBlockTimeout.String(),
+				)
+			}
+			select {
+			case <-t.quit:
+				return NewError(
+					ErrTopicFull,
+					`topic `+t.name+` closed`,
+				)
+			case <-time.After(TopicBlockInterval):
+			}
+			t.clean()
+		}
+		return nil
+	}
+
+	if t.full(t.getHead(), n, size) {
+		return NewError(
+			ErrTopicFull,
+			`topic `+t.name+` is full`,
+		)
+	}
+	return nil
+}
+
+// push pushes the message with its media type, which may be blank.
+func (t *topic) push(data []byte, mediaType string) error {
+	t.pushLock.Lock()
+	defer t.pushLock.Unlock()
+	err := t.makeRoom(1, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+
 	t.tailLock.Lock()
 	defer t.tailLock.Unlock()
 
-	key := Acatui(t.name, ":", t.tail)
-	err := t.q.setData(key, data)
+	err = t.setDataMeta(t.tail, data, messageMeta{mediaType: mediaType})
 	if err != nil {
 		return err
 	}
@@ -377,41 +598,68 @@ func (t *topic) push(data []byte) error {
 		return err
 	}
 
+	if t.getOptions().MaxBytes > 0 {
+		atomic.AddUint64(&t.bytes, uint64(len(data)))
+	}
 	return nil
 }
 
 func (t *topic) mPush(datas [][]byte) error {
+	_, err := t.append(datas, nil)
+	return err
+}
+
+// append pushes the messages and returns the id of the first one. The
+// metas of imported messages may be kept by metas.
+func (t *topic) append(datas [][]byte, metas []messageMeta) (uint64, error) {
+	var size uint64
+	for _, data := range datas {
+		size += uint64(len(data))
+	}
+	t.pushLock.Lock()
+	defer t.pushLock.Unlock()
+	err := t.makeRoom(uint64(len(datas)), size)
+	if err != nil {
+		return 0, err
+	}
+
 	t.tailLock.Lock()
 	defer t.tailLock.Unlock()
 
 	oldTail := t.tail
-	for _, data := range datas {
-		key := Acatui(t.name, ":", t.tail)
-		err := t.q.setData(key, data)
+	for i, data := range datas {
+		if metas != nil {
+			err = t.setDataMeta(t.tail, data, metas[i])
+		} else {
+			err = t.setData(t.tail, data)
+		}
 		if err != nil {
 			t.tail = oldTail
-			return err
+			return 0, err
 		}
 		// log.Printf("topic[%s] %s pushed.", t.name, string(data))
 		t.tail++
 	}
 
-	err := t.exportTail()
+	err = t.exportTail()
 	if err != nil {
 		t.tail = oldTail
-		return err
+		return 0, err
 	}
 
-	return nil
+	if t.getOptions().MaxBytes > 0 {
+		atomic.AddUint64(&t.bytes, size)
+	}
+	return oldTail, nil
 }
 
-func (t *topic) pop(name string) (uint64, []byte, error) {
+func (t *topic) pop(name string) (uint64, []byte, string, error) {
 	t.linesLock.RLock()
 	l, ok := t.lines[name]
 	t.linesLock.RUnlock()
 	if !ok {
 		// log.Printf("topic[%s] line[%s] not existed.", t.name, name)
-		return 0, nil, NewError(
+		return 0, nil, "", NewError(
 			ErrLineNotExisted,
 			`topic pop`,
 		)
@@ -420,13 +668,13 @@ func (t *topic) pop(name string) (uint64, []byte, error) {
 	return l.pop()
 }
 
-func (t *topic) mPop(name string, n int) ([]uint64, [][]byte, error) {
+func (t *topic) mPop(name string, n int) ([]uint64, [][]byte, []string, error) {
 	t.linesLock.RLock()
 	l, ok := t.lines[name]
 	t.linesLock.RUnlock()
 	if !ok {
 		// log.Printf("topic[%s] line[%s] not existed.", t.name, name)
-		return nil, nil, NewError(
+		return nil, nil, nil, NewError(
 			ErrLineNotExisted,
 			`topic mPop`,
 		)
@@ -480,6 +728,16 @@ func (t *topic) stat() *QueueStat {
 	qs.Head = t.head
 	qs.Tail = t.tail
 	qs.Count = qs.Tail - qs.Head
+	o := t.getOptions()
+	if o.limited() {
+		qs.Policy = o.Policy
+		qs.MaxMessages = o.MaxMessages
+		qs.MaxBytes = o.MaxBytes
+		qs.Bytes = atomic.LoadUint64(&t.bytes)
+		qs.Fill = t.fill(o, qs.Count, qs.Bytes)
+	}
+	qs.MaxMessageSize = o.MaxMessageSize
+	qs.Compression = o.Compression
 
 	qs.Lines = make([]*QueueStat, 0)
 	for _, l := range t.lines {
@@ -490,6 +748,20 @@ func (t *topic) stat() *QueueStat {
 	return qs
 }
 
+// fill returns the fill level of the capacity in percent.
+func (t *topic) fill(o TopicOptions, count, bytes uint64) string {
+	var fill float64
+	if o.MaxMessages > 0 {
+		fill = float64(count) / float64(o.MaxMessages)
+	}
+	if o.MaxBytes > 0 {
+		if f := float64(bytes) / float64(o.MaxBytes); f > fill {
+			fill = f
+		}
+	}
+	return strconv.FormatFloat(fill*100, 'f', 1, 64) + "%"
+}
+
 func (t *topic) emptyLine(name string) error {
 	t.linesLock.RLock()
 	l, ok := t.lines[name]
@@ -522,6 +794,7 @@ func (t *topic) empty() error {
 	t.tailLock.RLock()
 	defer t.tailLock.RUnlock()
 	t.head = t.tail
+	atomic.StoreUint64(&t.bytes, 0)
 	err := t.exportHead()
 	if err != nil {
 		return err
@@ -538,8 +811,8 @@ func (t *topic) close() {
 
 func (t *topic) removeLine(name string, fromEtcd bool) error {
 	t.linesLock.RLock()
-	defer t.linesLock.RUnlock()
-	l, ok := t.lines[name]
+	_, ok := t.lines[name]
+	t.linesLock.RUnlock()
 	if !ok {
 		// log.Printf("topic[%s] line[%s] not existed.", t.name, name)
 		return NewError(
@@ -548,17 +821,35 @@ func (t *topic) removeLine(name string, fromEtcd bool) error {
 		)
 	}
 
+	// unregistered first, so that the line is not created again by the
+	// registry. The registry lock is held, not the lines lock.
+	if !fromEtcd {
+		err := t.q.unRegisterLine(t.name, name)
+		if err != nil && !isError(err, ErrLineNotExisted) {
+			return err
+		}
+	}
+
+	t.linesLock.Lock()
+	l, ok := t.lines[name]
+	if !ok {
+		t.linesLock.Unlock()
+		return NewError(
+			ErrLineNotExisted,
+			`topic statLine`,
+		)
+	}
 	delete(t.lines, name)
 	err := t.exportTopic()
 	if err != nil {
-		t.linesLock.Lock()
 		t.lines[name] = l
-		t.linesLock.Unlock()
-		return err
 	}
-
-	if !fromEtcd {
-		t.q.unRegisterLine(t.name, name)
+	t.linesLock.Unlock()
+	if err != nil {
+		if !fromEtcd {
+			t.q.registerLine(t.name, name, l.recycle.String())
+		}
+		return err
 	}
 
 	return l.remove()
@@ -580,10 +871,9 @@ func (t *topic) removeLines() error {
 
 func (t *topic) removeMsgData() error {
 	for i := t.head; i < t.tail; i++ {
-		key := Acatui(t.name, ":", i)
-		err := t.q.delData(key)
+		err := t.delMessage(i)
 		if err != nil {
-			log.Printf("topic[%s] del data[%s] error; %s", t.name, key, err)
+			log.Printf("topic[%s] del data[%d] error; %s", t.name, i, err)
 			continue
 		}
 	}
@@ -0,0 +1,84 @@
+package route
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RingReplicas is the count of the virtual nodes of a server.
+	RingReplicas int = 160
+	// Slots is the count of the slots reported in the redis MOVED errors.
+	Slots uint32 = 16384
+)
+
+// Ring hashes the topics to the servers consistently, so that only the
+// topics of a server move when it joins or leaves.
+type Ring struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+func hash(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+// NewRing returns the ring of the servers.
+func NewRing(servers []string) *Ring {
+	r := new(Ring)
+	r.nodes = make(map[uint32]string)
+	for _, server := range servers {
+		for i := 0; i < RingReplicas; i++ {
+			h := hash(strconv.Itoa(i) + server)
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = server
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Get returns the server of the key, or "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// Slot returns the slot of the key like redis cluster does, which is the
+// crc16 of the key, or of its hash tag between the first { and }.
+func Slot(key string) uint32 {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return uint32(crc16(key)) % Slots
+}
+
+// crc16 is the CRC-16/XMODEM checksum used by redis cluster.
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
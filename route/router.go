@@ -0,0 +1,114 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ModeRedirect string = "redirect"
+	ModeProxy    string = "proxy"
+
+	RefreshInterval time.Duration = 3 * time.Second
+)
+
+// Router finds the server owning a topic among the servers of the
+// cluster. The requests of the topics owned by others are redirected or
+// proxied to the owners by the entrances.
+type Router struct {
+	self    string
+	mode    string
+	servers func() ([]string, error)
+	ring    *Ring
+	mu      sync.RWMutex
+	stop    chan bool
+}
+
+// New returns the router of the server self. The servers are listed by
+// the function, which is called every RefreshInterval once started.
+func New(self, mode string, servers func() ([]string, error)) (*Router, error) {
+	if mode != ModeRedirect && mode != ModeProxy {
+		return nil, errors.New("unknown route mode: " + mode)
+	}
+	r := new(Router)
+	r.self = self
+	r.mode = mode
+	r.servers = servers
+	r.ring = NewRing(nil)
+	r.stop = make(chan bool)
+	return r, nil
+}
+
+// Mode returns the route mode, redirect or proxy.
+func (r *Router) Mode() string {
+	return r.mode
+}
+
+// Refresh rebuilds the ring by the servers listed.
+func (r *Router) Refresh() error {
+	servers, err := r.servers()
+	if err != nil {
+		return err
+	}
+	ring := NewRing(servers)
+	r.mu.Lock()
+	r.ring = ring
+	r.mu.Unlock()
+	return nil
+}
+
+// Start refreshes the ring in the background until stopped.
+func (r *Router) Start() {
+	err := r.Refresh()
+	if err != nil {
+		log.Printf("router refresh error: %s", err)
+	}
+	go func() {
+		ticker := time.NewTicker(RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := r.Refresh()
+				if err != nil {
+					log.Printf("router refresh error: %s", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Router) Stop() {
+	close(r.stop)
+}
+
+// TopicOf returns the topic of a key like foo, foo/x or foo/x/1.
+func TopicOf(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// Owner returns the server owning the topic of the key, or "" if it is
+// owned by this server. A nil router owns everything, and so does an
+// empty ring.
+func (r *Router) Owner(key string) string {
+	topic := TopicOf(key)
+	if r == nil || topic == "" {
+		return ""
+	}
+	r.mu.RLock()
+	owner := r.ring.Get(topic)
+	r.mu.RUnlock()
+	if owner == r.self {
+		return ""
+	}
+	return owner
+}
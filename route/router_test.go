@@ -0,0 +1,82 @@
+package route
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var servers = []string{"127.0.0.1:8808", "127.0.0.1:8818", "127.0.0.1:8828"}
+
+func TestRing(t *testing.T) {
+	Convey("Test Consistent Hashing Ring", t, func() {
+		So(NewRing(nil).Get("foo"), ShouldEqual, "")
+
+		r := NewRing(servers)
+		owners := make(map[string]string)
+		counts := make(map[string]int)
+		for i := 0; i < 3000; i++ {
+			topic := "topic" + strconv.Itoa(i)
+			owners[topic] = r.Get(topic)
+			counts[owners[topic]]++
+		}
+		for _, server := range servers {
+			So(counts[server], ShouldBeGreaterThan, 500)
+		}
+
+		// only the topics of the server left move
+		r = NewRing(servers[:2])
+		for topic, owner := range owners {
+			if owner != servers[2] {
+				So(r.Get(topic), ShouldEqual, owner)
+			}
+		}
+
+		So(crc16("123456789"), ShouldEqual, 0x31c3)
+		So(Slot("foo"), ShouldEqual, 12182)
+		So(Slot("{foo}/x"), ShouldEqual, Slot("foo"))
+	})
+}
+
+func TestRouter(t *testing.T) {
+	Convey("Test Router Owners", t, func() {
+		_, err := New(servers[0], "forward", nil)
+		So(err, ShouldNotBeNil)
+
+		var failed error
+		r, err := New(servers[0], ModeRedirect, func() ([]string, error) {
+			return servers, failed
+		})
+		So(err, ShouldBeNil)
+		So(r.Mode(), ShouldEqual, ModeRedirect)
+		// nothing is routed until refreshed
+		So(r.Owner("foo"), ShouldEqual, "")
+		So(r.Refresh(), ShouldBeNil)
+
+		ring := NewRing(servers)
+		remote := ""
+		for i := 0; i < 100; i++ {
+			topic := "topic" + strconv.Itoa(i)
+			owner := ring.Get(topic)
+			if owner == servers[0] {
+				owner = ""
+			} else {
+				remote = topic
+			}
+			So(r.Owner(topic), ShouldEqual, owner)
+			So(r.Owner(topic+"/x/1"), ShouldEqual, owner)
+		}
+		So(r.Owner(""), ShouldEqual, "")
+		So(TopicOf("/foo/x"), ShouldEqual, "foo")
+
+		// the ring is kept if the servers are not listed
+		failed = errors.New("etcd down")
+		So(r.Refresh(), ShouldNotBeNil)
+		So(r.Owner(remote), ShouldEqual, ring.Get(remote))
+
+		var nilRouter *Router
+		So(nilRouter.Owner("foo"), ShouldEqual, "")
+	})
+}
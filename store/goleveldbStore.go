@@ -59,6 +59,28 @@ func (l *LevelStore) Del(key string) error {
 	// return nil
 }
 
+// Snapshot walks the keys of a leveldb snapshot in order.
+func (l *LevelStore) Snapshot(walk func(key string, data []byte) error) error {
+	snap, err := l.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		// the iterator reuses its buffers
+		data := make([]byte, len(iter.Value()))
+		copy(data, iter.Value())
+		err = walk(string(iter.Key()), data)
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
 func (l *LevelStore) Close() error {
 	err := l.db.Close()
 	if err != nil {
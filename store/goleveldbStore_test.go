@@ -42,6 +42,24 @@ func TestGetLevel(t *testing.T) {
 	})
 }
 
+func TestSnapshotLevel(t *testing.T) {
+	Convey("Test Level Store Snapshot", t, func() {
+		err = ldb.Set("fop", []byte("baz"))
+		So(err, ShouldBeNil)
+		var keys []string
+		err = ldb.(Snapshotter).Snapshot(func(key string, data []byte) error {
+			keys = append(keys, key+"="+string(data))
+			return ldb.Set(key, []byte("changed"))
+		})
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []string{"foo=bar", "fop=baz"})
+		err = ldb.Set("foo", []byte("bar"))
+		So(err, ShouldBeNil)
+		err = ldb.Del("fop")
+		So(err, ShouldBeNil)
+	})
+}
+
 func TestDelLevel(t *testing.T) {
 	Convey("Test Level Store Del", t, func() {
 		err = ldb.Del("foo")
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	memSnapFile   = "mem.snap"
+	memLogFile    = "mem.log"
+	memOldLogFile = "mem.log.old"
+
+	opSet byte = 1
+	opDel byte = 2
+)
+
+var errBadRecord = errors.New("memdb bad record")
+
+// NewDurableMemStore keeps the map in memory, and appends the mutations
+// to a log file in dir. The map is snapshotted every interval, which
+// starts a new log. On startup the snapshot and the logs are replayed.
+func NewDurableMemStore(dir string, interval time.Duration) (*MemStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := NewMemStore()
+	if err != nil {
+		return nil, err
+	}
+	ms.dir = dir
+
+	err = ms.replay()
+	if err != nil {
+		return nil, err
+	}
+	ms.log, err = os.OpenFile(ms.file(memLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		ms.stop = make(chan bool)
+		ms.wg.Add(1)
+		go ms.snapshotLoop(interval)
+	}
+	return ms, nil
+}
+
+func (m *MemStore) file(name string) string {
+	return path.Join(m.dir, name)
+}
+
+// A record is: length uint32 | crc32 uint32 | op | key length uvarint |
+// key | data. The length and crc are of the rest.
+func encodeRecord(op byte, key string, data []byte) []byte {
+	body := make([]byte, 1+binary.MaxVarintLen64+len(key)+len(data))
+	body[0] = op
+	n := 1 + binary.PutUvarint(body[1:], uint64(len(key)))
+	n += copy(body[n:], key)
+	n += copy(body[n:], data)
+	body = body[:n]
+
+	record := make([]byte, 8+n)
+	binary.LittleEndian.PutUint32(record, uint32(n))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+	copy(record[8:], body)
+	return record
+}
+
+// readRecord returns io.EOF at the end, and io.ErrUnexpectedEOF or
+// errBadRecord for a record cut short or broken.
+func readRecord(r *bufio.Reader) (byte, string, []byte, int, error) {
+	var hdr [8]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return 0, "", nil, 0, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[:])
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, "", nil, 0, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(hdr[4:]) || n < 2 {
+		return 0, "", nil, 0, errBadRecord
+	}
+	size, m := binary.Uvarint(body[1:])
+	if m <= 0 || uint64(len(body)-1-m) < size {
+		return 0, "", nil, 0, errBadRecord
+	}
+	key := string(body[1+m : 1+m+int(size)])
+	data := body[1+m+int(size):]
+	return body[0], key, data, 8 + int(n), nil
+}
+
+// append writes the record to the log under the lock.
+func (m *MemStore) append(op byte, key string, data []byte) error {
+	_, err := m.log.Write(encodeRecord(op, key, data))
+	return err
+}
+
+// replayFile applies the records of the file to the map, and returns the
+// size of the records applied. A log may end with a record cut short by a
+// crash, which is ignored.
+func (m *MemStore) replayFile(name string, isLog bool) (int64, error) {
+	f, err := os.Open(m.file(name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		op, key, data, n, err := readRecord(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			if isLog {
+				log.Printf("memdb %s broken at %d: %s", name, offset, err)
+				return offset, nil
+			}
+			return 0, err
+		}
+		switch op {
+		case opSet:
+			m.db[key] = data
+		case opDel:
+			delete(m.db, key)
+		default:
+			return 0, errBadRecord
+		}
+		offset += int64(n)
+	}
+}
+
+// replay loads the snapshot, the log of a snapshot not finished and the
+// current log in order. The logs may have the mutations the snapshot has
+// already, which lead to the same values again.
+func (m *MemStore) replay() error {
+	_, err := m.replayFile(memSnapFile, false)
+	if err != nil {
+		return err
+	}
+	_, err = m.replayFile(memOldLogFile, true)
+	if err != nil {
+		return err
+	}
+	offset, err := m.replayFile(memLogFile, true)
+	if err != nil {
+		return err
+	}
+	// cut the broken tail off, so that the records appended are read
+	err = os.Truncate(m.file(memLogFile), offset)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Printf("memdb replayed %d keys.", len(m.db))
+	return nil
+}
+
+// snapshot writes the map to the snapshot file, and removes the logs
+// before it. The map is copied and the log is rotated under the lock,
+// then written without it.
+func (m *MemStore) snapshot() error {
+	m.mu.Lock()
+	db := make(map[string][]byte, len(m.db))
+	for key, data := range m.db {
+		db[key] = data
+	}
+	// the old log of a failed snapshot is kept until a snapshot succeeds
+	_, err := os.Stat(m.file(memOldLogFile))
+	if os.IsNotExist(err) {
+		err = m.rotate()
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := m.file(memSnapFile + ".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, data := range db {
+		_, err = w.Write(encodeRecord(opSet, key, data))
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, m.file(memSnapFile))
+	if err != nil {
+		return err
+	}
+	err = os.Remove(m.file(memOldLogFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Printf("memdb snapshot %d keys succ.", len(db))
+	return nil
+}
+
+// rotate renames the log to the old one and opens a new log.
+func (m *MemStore) rotate() error {
+	err := m.log.Sync()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(m.file(memLogFile), m.file(memOldLogFile))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(m.file(memLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		// keep appending to it as the log
+		os.Rename(m.file(memOldLogFile), m.file(memLogFile))
+		return err
+	}
+	m.log.Close()
+	m.log = f
+	return nil
+}
+
+func (m *MemStore) snapshotLoop(interval time.Duration) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := m.snapshot()
+			if err != nil {
+				log.Printf("memdb snapshot error: %s", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// closeLog snapshots the map at last, so that the next start replays it
+// fast.
+func (m *MemStore) closeLog() error {
+	if m.stop != nil {
+		close(m.stop)
+		m.wg.Wait()
+	}
+	err := m.snapshot()
+	if err != nil {
+		log.Printf("memdb snapshot error: %s", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err = m.log.Close()
+	if err != nil {
+		log.Printf("memdb close error: %s", err)
+		return err
+	}
+	return nil
+}
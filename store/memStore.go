@@ -2,12 +2,20 @@ package store
 
 import (
 	"errors"
+	"os"
+	"sort"
 	"sync"
 )
 
 type MemStore struct {
 	mu sync.RWMutex
 	db map[string][]byte
+
+	// set by NewDurableMemStore only
+	dir  string
+	log  *os.File
+	stop chan bool
+	wg   sync.WaitGroup
 }
 
 func NewMemStore() (*MemStore, error) {
@@ -19,6 +27,9 @@ func NewMemStore() (*MemStore, error) {
 }
 
 func (m *MemStore) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	data, ok := m.db[key]
 	if !ok {
 		return nil, errors.New(ErrNotExisted)
@@ -30,20 +41,62 @@ func (m *MemStore) Set(key string, data []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.log != nil {
+		err := m.append(opSet, key, data)
+		if err != nil {
+			return err
+		}
+	}
 	m.db[key] = data
 	return nil
 }
 
 func (m *MemStore) Del(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	_, ok := m.db[key]
 	if !ok {
 		return errors.New(ErrNotExisted)
 	}
+	if m.log != nil {
+		err := m.append(opDel, key, nil)
+		if err != nil {
+			return err
+		}
+	}
 
 	delete(m.db, key)
 	return nil
 }
 
-func (m *MemStore) Close() error {
+// Snapshot copies the keys under the lock, and walks them in order. The
+// values are not modified in place, so they are shared.
+func (m *MemStore) Snapshot(walk func(key string, data []byte) error) error {
+	m.mu.RLock()
+	db := make(map[string][]byte, len(m.db))
+	for key, data := range m.db {
+		db[key] = data
+	}
+	m.mu.RUnlock()
+
+	keys := make([]string, 0, len(db))
+	for key := range db {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := walk(key, db[key])
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (m *MemStore) Close() error {
+	if m.log == nil {
+		return nil
+	}
+	return m.closeLog()
+}
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -38,6 +41,24 @@ func TestGetMem(t *testing.T) {
 	})
 }
 
+func TestSnapshotMem(t *testing.T) {
+	Convey("Test Mem Store Snapshot", t, func() {
+		err = mdb.Set("fop", []byte("baz"))
+		So(err, ShouldBeNil)
+		var keys []string
+		err = mdb.(Snapshotter).Snapshot(func(key string, data []byte) error {
+			keys = append(keys, key+"="+string(data))
+			return mdb.Set(key, []byte("changed"))
+		})
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []string{"foo=bar", "fop=baz"})
+		err = mdb.Set("foo", []byte("bar"))
+		So(err, ShouldBeNil)
+		err = mdb.Del("fop")
+		So(err, ShouldBeNil)
+	})
+}
+
 func TestDelMem(t *testing.T) {
 	Convey("Test Mem Store Del", t, func() {
 		err = mdb.Del("foo")
@@ -54,3 +75,60 @@ func TestCloseMem(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+const (
+	memPath = "/tmp/uq.store.test.mem"
+)
+
+func TestDurableMem(t *testing.T) {
+	Convey("Test Durable Mem Store", t, func() {
+		os.RemoveAll(memPath)
+		defer os.RemoveAll(memPath)
+
+		ms, err := NewDurableMemStore(memPath, time.Hour)
+		So(err, ShouldBeNil)
+		So(ms.Set("foo", []byte("bar")), ShouldBeNil)
+		So(ms.Set("fop", []byte("baz")), ShouldBeNil)
+		So(ms.Del("fop"), ShouldBeNil)
+		So(ms.Del("fop"), ShouldNotBeNil)
+
+		// replays the log without closing, with a record cut short
+		f, err := os.OpenFile(path.Join(memPath, memLogFile), os.O_WRONLY|os.O_APPEND, 0644)
+		So(err, ShouldBeNil)
+		_, err = f.Write(encodeRecord(opSet, "cut", []byte("short"))[:10])
+		So(err, ShouldBeNil)
+		f.Close()
+		ms2, err := NewDurableMemStore(memPath, 0)
+		So(err, ShouldBeNil)
+		data, err := ms2.Get("foo")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "bar")
+		_, err = ms2.Get("fop")
+		So(err, ShouldNotBeNil)
+		_, err = ms2.Get("cut")
+		So(err, ShouldNotBeNil)
+		So(ms2.Set("new", []byte("1")), ShouldBeNil)
+
+		// snapshots and starts a new log
+		So(ms2.snapshot(), ShouldBeNil)
+		So(ms2.Set("foo", []byte("bar2")), ShouldBeNil)
+		So(ms2.Close(), ShouldBeNil)
+		info, err := os.Stat(path.Join(memPath, memLogFile))
+		So(err, ShouldBeNil)
+		So(info.Size(), ShouldEqual, 0)
+		_, err = os.Stat(path.Join(memPath, memOldLogFile))
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		ms3, err := NewDurableMemStore(memPath, 0)
+		So(err, ShouldBeNil)
+		data, err = ms3.Get("foo")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "bar2")
+		data, err = ms3.Get("new")
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "1")
+		So(ms3.Close(), ShouldBeNil)
+		close(ms.stop)
+		ms.log.Close()
+	})
+}
@@ -11,3 +11,9 @@ type Storage interface {
 	Del(key string) error
 	Close() error
 }
+
+// Snapshotter walks a consistent snapshot of the storage, so that it can
+// be backed up while serving.
+type Snapshotter interface {
+	Snapshot(walk func(key string, data []byte) error) error
+}
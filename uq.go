@@ -1,9 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -13,26 +18,76 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/buaazp/uq/acl"
 	"github.com/buaazp/uq/admin"
+	"github.com/buaazp/uq/cluster"
 	"github.com/buaazp/uq/entry"
+	"github.com/buaazp/uq/limit"
 	"github.com/buaazp/uq/queue"
+	"github.com/buaazp/uq/route"
 	"github.com/buaazp/uq/store"
 	. "github.com/buaazp/uq/utils"
 )
 
 var (
-	ip        string
-	host      string
-	port      int
-	adminPort int
-	pprofPort int
-	protocol  string
-	db        string
-	dir       string
-	logFile   string
-	etcd      string
-	cluster   string
+	ip          string
+	host        string
+	port        int
+	adminPort   int
+	pprofPort   int
+	protocol    string
+	db          string
+	dir         string
+	logFile     string
+	etcd        string
+	clusterName string
+
+	listRecycle string
+	aclFile     string
+
+	tlsCert          string
+	tlsKey           string
+	tlsClientCA      string
+	adminTLSCert     string
+	adminTLSKey      string
+	adminTLSClientCA string
+
+	unixPath      string
+	adminUnixPath string
+
+	connRate   string
+	clientRate string
+	topicRate  string
+
+	maxMessageSize int
+	chunkSize      int
+
+	replicaPort    int
+	replicas       string
+	replicaSecret  string
+	replicaTLSCert string
+	replicaTLSKey  string
+	replicaTLSCA   string
+	routeMode      string
+
+	raftAddr    string
+	raftPeers   string
+	raftDir     string
+	raftSecret  string
+	raftTLSCert string
+	raftTLSKey  string
+	raftTLSCA   string
+
+	backupFile  string
+	restoreFile string
+	adminToken  string
+	adminCA     string
+
+	memSnapshot string
+
+	wsOrigins string
 )
 
 func init() {
@@ -41,12 +96,263 @@ func init() {
 	flag.IntVar(&port, "port", 8808, "listen port")
 	flag.IntVar(&adminPort, "admin-port", 8809, "admin listen port")
 	flag.IntVar(&pprofPort, "pprof-port", 8080, "pprof listen port")
-	flag.StringVar(&protocol, "protocol", "redis", "frontend interface type [redis/mc/http]")
+	flag.StringVar(&protocol, "protocol", "redis", "frontend interface type [redis/mc/mcq/http/grpc]")
 	flag.StringVar(&db, "db", "goleveldb", "backend storage type [goleveldb/memdb]")
 	flag.StringVar(&dir, "dir", "./data", "backend storage path")
 	flag.StringVar(&logFile, "log", "", "uq log path")
 	flag.StringVar(&etcd, "etcd", "", "etcd service location")
-	flag.StringVar(&cluster, "cluster", "uq", "cluster name in etcd")
+	flag.StringVar(&clusterName, "cluster", "uq", "cluster name in etcd")
+	flag.StringVar(&raftAddr, "raft", "", "raft address to coordinate the cluster without etcd")
+	flag.StringVar(&raftPeers, "raft-peers", "", "raft addresses of all the servers in the cluster")
+	flag.StringVar(&raftDir, "raft-dir", "", "raft data path, default <dir>/raft")
+	flag.StringVar(&raftSecret, "raft-secret", "", "secret shared by the raft peers of the cluster")
+	flag.StringVar(&raftTLSCert, "raft-tls-cert", "", "tls certificate file of the raft address, also presented to the other peers")
+	flag.StringVar(&raftTLSKey, "raft-tls-key", "", "tls key file of the raft address")
+	flag.StringVar(&raftTLSCA, "raft-tls-ca", "", "ca file to verify the certificates of the raft peers")
+	flag.StringVar(&listRecycle, "list-recycle", "", "recycle of lines created by redis list commands")
+	flag.StringVar(&aclFile, "acl", "", "acl file of users and their rights")
+	flag.StringVar(&unixPath, "unix", "", "unix socket path of the entrance, -port 0 to listen on it only")
+	flag.StringVar(&adminUnixPath, "admin-unix", "", "unix socket path of the admin server, -admin-port 0 to listen on it only")
+	flag.StringVar(&tlsCert, "tls-cert", "", "tls certificate file of the entrance")
+	flag.StringVar(&tlsKey, "tls-key", "", "tls key file of the entrance")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "ca file to verify the client certificates of the entrance")
+	flag.StringVar(&adminTLSCert, "admin-tls-cert", "", "tls certificate file of the admin server")
+	flag.StringVar(&adminTLSKey, "admin-tls-key", "", "tls key file of the admin server")
+	flag.StringVar(&adminTLSClientCA, "admin-tls-client-ca", "", "ca file to verify the client certificates of the admin server")
+	flag.StringVar(&connRate, "conn-rate", "", "push rate limit of each connection as <messages>[:<bytes>] per second")
+	flag.StringVar(&clientRate, "client-rate", "", "push rate limit of each authenticated client as <messages>[:<bytes>] per second")
+	flag.StringVar(&topicRate, "topic-rate", "", "push rate limit of each topic as <messages>[:<bytes>] per second")
+	flag.IntVar(&maxMessageSize, "max-message-size", queue.DefaultMaxMessageSize, "max size of a message in bytes")
+	flag.IntVar(&chunkSize, "chunk-size", queue.DefaultChunkSize, "max size of a stored value, larger messages are split into chunks")
+	flag.IntVar(&replicaPort, "replica-port", 0, "port to receive the topics replicated from other nodes, 0 to disable")
+	flag.StringVar(&replicas, "replicas", "", "replica-port addresses of the nodes to replicate the topics to")
+	flag.StringVar(&replicaSecret, "replica-secret", "", "secret shared by the replica ports of the cluster")
+	flag.StringVar(&replicaTLSCert, "replica-tls-cert", "", "tls certificate file of the replica port, also presented to the replica ports of other nodes")
+	flag.StringVar(&replicaTLSKey, "replica-tls-key", "", "tls key file of the replica port")
+	flag.StringVar(&replicaTLSCA, "replica-tls-ca", "", "ca file to verify the certificates of the replica ports")
+	flag.StringVar(&routeMode, "route", "", "route the requests to the owners of the topics in the cluster [redirect/proxy]")
+	flag.StringVar(&backupFile, "backup", "", "write a snapshot of the uq serving at -ip and -admin-port to the file, and exit")
+	flag.StringVar(&restoreFile, "restore", "", "restore the blank storage from a snapshot file before starting")
+	flag.StringVar(&adminToken, "admin-token", "", "bearer token of -backup, export and import to the admin server")
+	flag.StringVar(&adminCA, "admin-ca", "", "ca file of -backup, export and import to verify the admin server by https")
+	flag.StringVar(&wsOrigins, "ws-origins", "", "origins allowed to open the websocket streams of the http entry besides its own host, * for any")
+	flag.StringVar(&memSnapshot, "mem-snapshot", "", "snapshot interval of memdb, which then logs the mutations under -dir to survive restarts")
+}
+
+type aclSetter interface {
+	SetACL(access *acl.ACL)
+}
+
+type unixSetter interface {
+	SetUnixSocket(path string)
+}
+
+type tlsSetter interface {
+	SetTLSConfig(config *tls.Config)
+}
+
+type replicaSetter interface {
+	SetReplica(r admin.Replica)
+}
+
+type migratorSetter interface {
+	SetMigrator(m admin.Migrator)
+}
+
+type backupSetter interface {
+	SetBackup(b admin.Backup)
+}
+
+type exporterSetter interface {
+	SetExporter(e admin.Exporter)
+}
+
+type limiterSetter interface {
+	SetLimiter(l *limit.Limiter)
+}
+
+type routerSetter interface {
+	SetRouter(router *route.Router)
+}
+
+type clusterSetter interface {
+	SetCluster(admins func() ([]string, error))
+}
+
+// newLimiter returns a nil limiter if no rate is set.
+func newLimiter() (*limit.Limiter, error) {
+	if connRate == "" && clientRate == "" && topicRate == "" {
+		return nil, nil
+	}
+	conn, err := limit.ParseRate(connRate)
+	if err != nil {
+		return nil, err
+	}
+	client, err := limit.ParseRate(clientRate)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := limit.ParseRate(topicRate)
+	if err != nil {
+		return nil, err
+	}
+	return limit.New(conn, client, topic), nil
+}
+
+// loadTLS returns a nil config if no certificate is given. The reloader
+// is returned to reload the certificate on SIGHUP.
+func loadTLS(certFile, keyFile, clientCAFile string) (*tls.Config, *CertReloader, error) {
+	if certFile == "" {
+		return nil, nil, nil
+	}
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := NewTLSConfig(reloader, clientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, reloader, nil
+}
+
+// adminRequest sends the request to the admin server at -ip and
+// -admin-port with -admin-token. It is sent by https if -admin-ca or
+// -admin-tls-cert is set, and the certificate is presented in case the
+// admin server verifies the clients.
+func adminRequest(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	scheme := "http"
+	client := http.DefaultClient
+	if adminCA != "" || adminTLSCert != "" {
+		var reloader *CertReloader
+		if adminTLSCert != "" {
+			r, err := NewCertReloader(adminTLSCert, adminTLSKey)
+			if err != nil {
+				return nil, err
+			}
+			reloader = r
+		}
+		config, err := NewClientTLSConfig(reloader, adminCA)
+		if err != nil {
+			return nil, err
+		}
+		scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	req, err := http.NewRequest(method, scheme+"://"+Addrcat(ip, adminPort)+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	return client.Do(req)
+}
+
+// backup gets a snapshot from the admin server and writes it to the file.
+func backup(file string) error {
+	resp, err := adminRequest("GET", "/v1/admin/backup", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(resp.Status + " " + strings.TrimSpace(string(data)))
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// exportTopic gets the topic from the admin server and writes it to the
+// file as NDJSON.
+func exportTopic(topic, file string) error {
+	resp, err := adminRequest("GET", "/v1/admin/export/"+topic, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(resp.Status + " " + strings.TrimSpace(string(data)))
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importTopic posts the file exported to the admin server, and prints the
+// ids the messages get if they are not kept.
+func importTopic(topic, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resp, err := adminRequest("POST", "/v1/admin/import/"+topic, "application/x-ndjson", f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status + " " + strings.TrimSpace(string(data)))
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
+// command runs 'uq export|import [flags] <topic> <file>' against the uq
+// serving at -ip and -admin-port.
+func command(name string, args []string) {
+	flag.CommandLine.Parse(args)
+	if flag.NArg() != 2 {
+		fmt.Printf("usage: uq %s [flags] <topic> <file>\n", name)
+		os.Exit(2)
+	}
+	topic, file := flag.Arg(0), flag.Arg(1)
+
+	var err error
+	if name == "export" {
+		err = exportTopic(topic, file)
+	} else {
+		err = importTopic(topic, file)
+	}
+	if err != nil {
+		fmt.Printf("%s error: %s\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s succ.\n", name, topic)
+}
+
+func restore(storage store.Storage, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return queue.Restore(storage, f)
 }
 
 func belong(single string, team []string) bool {
@@ -63,14 +369,89 @@ func checkArgs() bool {
 		fmt.Printf("db mode %s is not supported!\n", db)
 		return false
 	}
-	if !belong(protocol, []string{"redis", "mc", "http"}) {
+	if !belong(protocol, []string{"redis", "mc", "mcq", "http", "grpc"}) {
 		fmt.Printf("protocol %s is not supported!\n", protocol)
 		return false
 	}
+	if (port == 0 && unixPath == "") || (adminPort == 0 && adminUnixPath == "") {
+		fmt.Printf("port 0 needs a unix socket path!\n")
+		return false
+	}
+	if port == 0 && (etcd != "" || raftAddr != "") {
+		fmt.Printf("cluster needs a tcp port!\n")
+		return false
+	}
+	if etcd != "" && raftAddr != "" {
+		fmt.Printf("cluster is coordinated by etcd or raft, not both!\n")
+		return false
+	}
+	if routeMode != "" && !belong(routeMode, []string{route.ModeRedirect, route.ModeProxy}) {
+		fmt.Printf("route mode %s is not supported!\n", routeMode)
+		return false
+	}
+	if routeMode != "" && etcd == "" && raftAddr == "" {
+		fmt.Printf("route needs a cluster of etcd or raft!\n")
+		return false
+	}
+	if routeMode != "" && protocol == "mcq" {
+		fmt.Printf("route is not supported by mcq!\n")
+		return false
+	}
+	if routeMode == route.ModeProxy && !belong(protocol, []string{"redis", "http"}) {
+		fmt.Printf("route proxy is supported by redis and http only!\n")
+		return false
+	}
+	if (tlsCert == "") != (tlsKey == "") || (adminTLSCert == "") != (adminTLSKey == "") ||
+		(replicaTLSCert == "") != (replicaTLSKey == "") || (raftTLSCert == "") != (raftTLSKey == "") {
+		fmt.Printf("tls certificate and key should be set together!\n")
+		return false
+	}
+	if (tlsClientCA != "" && tlsCert == "") || (adminTLSClientCA != "" && adminTLSCert == "") ||
+		(replicaTLSCA != "" && replicaTLSCert == "") || (raftTLSCA != "" && raftTLSCert == "") {
+		fmt.Printf("tls client ca needs tls certificate!\n")
+		return false
+	}
+	if (replicaPort > 0 || replicas != "") && replicaSecret == "" {
+		fmt.Printf("replication needs a replica secret!\n")
+		return false
+	}
+	if raftAddr != "" && raftSecret == "" {
+		fmt.Printf("raft needs a raft secret!\n")
+		return false
+	}
+	if maxMessageSize <= 0 {
+		fmt.Printf("max message size should be positive!\n")
+		return false
+	}
+	if chunkSize <= 0 {
+		fmt.Printf("chunk size should be positive!\n")
+		return false
+	}
+	if listRecycle != "" {
+		if _, err := time.ParseDuration(listRecycle); err != nil {
+			fmt.Printf("list recycle %s is not valid: %s\n", listRecycle, err)
+			return false
+		}
+	}
+	if memSnapshot != "" {
+		if db != "memdb" {
+			fmt.Printf("mem snapshot needs memdb!\n")
+			return false
+		}
+		if d, err := time.ParseDuration(memSnapshot); err != nil || d <= 0 {
+			fmt.Printf("mem snapshot %s is not valid!\n", memSnapshot)
+			return false
+		}
+	}
 	return true
 }
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		command(os.Args[1], os.Args[2:])
+		return
+	}
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	defer func() {
 		fmt.Printf("byebye! uq see u later! 😄\n")
@@ -95,16 +476,83 @@ func main() {
 
 	flag.Parse()
 
+	if backupFile != "" {
+		err = backup(backupFile)
+		if err != nil {
+			fmt.Printf("backup error: %s\n", err)
+			return
+		}
+		fmt.Printf("backup to %s succ.\n", backupFile)
+		return
+	}
+
 	if !checkArgs() {
 		return
 	}
 	fmt.Printf("uq started! 😄\n")
 
+	tlsConfig, reloader, err := loadTLS(tlsCert, tlsKey, tlsClientCA)
+	if err != nil {
+		fmt.Printf("tls load error: %s\n", err)
+		return
+	}
+	adminTLSConfig, adminReloader, err := loadTLS(adminTLSCert, adminTLSKey, adminTLSClientCA)
+	if err != nil {
+		fmt.Printf("admin tls load error: %s\n", err)
+		return
+	}
+	replicaTLSConfig, replicaReloader, err := loadTLS(replicaTLSCert, replicaTLSKey, replicaTLSCA)
+	if err != nil {
+		fmt.Printf("replica tls load error: %s\n", err)
+		return
+	}
+	var replicaClientTLSConfig *tls.Config
+	if replicaTLSConfig != nil {
+		replicaClientTLSConfig, err = NewClientTLSConfig(replicaReloader, replicaTLSCA)
+		if err != nil {
+			fmt.Printf("replica tls load error: %s\n", err)
+			return
+		}
+	}
+	raftTLSConfig, raftReloader, err := loadTLS(raftTLSCert, raftTLSKey, raftTLSCA)
+	if err != nil {
+		fmt.Printf("raft tls load error: %s\n", err)
+		return
+	}
+	var raftClientTLSConfig *tls.Config
+	if raftTLSConfig != nil {
+		raftClientTLSConfig, err = NewClientTLSConfig(raftReloader, raftTLSCA)
+		if err != nil {
+			fmt.Printf("raft tls load error: %s\n", err)
+			return
+		}
+	}
+
+	var access *acl.ACL
+	if aclFile != "" {
+		access, err = acl.Load(aclFile)
+		if err != nil {
+			fmt.Printf("acl load error: %s\n", err)
+			return
+		}
+	}
+
+	limiter, err := newLimiter()
+	if err != nil {
+		fmt.Printf("rate limit error: %s\n", err)
+		return
+	}
+
 	var storage store.Storage
 	if db == "goleveldb" {
 		dbpath := path.Clean(path.Join(dir, "uq.db"))
 		log.Printf("dbpath: %s", dbpath)
 		storage, err = store.NewLevelStore(dbpath)
+	} else if db == "memdb" && memSnapshot != "" {
+		interval, _ := time.ParseDuration(memSnapshot)
+		mempath := path.Clean(path.Join(dir, "uq.mem"))
+		log.Printf("mempath: %s", mempath)
+		storage, err = store.NewDurableMemStore(mempath, interval)
 	} else if db == "memdb" {
 		storage, err = store.NewMemStore()
 	} else {
@@ -115,26 +563,87 @@ func main() {
 		fmt.Printf("store init error: %s\n", err)
 		return
 	}
+	if restoreFile != "" {
+		err = restore(storage, restoreFile)
+		if err != nil {
+			fmt.Printf("restore error: %s\n", err)
+			storage.Close()
+			return
+		}
+	}
 
 	var etcdServers []string
 	if etcd != "" {
 		etcdServers = strings.Split(etcd, ",")
 	}
-	var messageQueue queue.MessageQueue
-	messageQueue, err = queue.NewUnitedQueue(storage, ip, port, etcdServers, cluster)
+	unitedQueue, err := queue.NewUnitedQueue(storage, ip, port, etcdServers, clusterName)
 	if err != nil {
 		fmt.Printf("queue init error: %s\n", err)
 		storage.Close()
 		return
 	}
+	if adminPort != 0 {
+		unitedQueue.SetAdminAddr(Addrcat(ip, adminPort))
+	}
+	if raftAddr != "" {
+		if raftDir == "" {
+			raftDir = path.Join(dir, "raft")
+		}
+		coordinator, err := cluster.NewRaft(raftAddr, strings.Split(raftPeers, ","), raftDir, raftSecret, raftTLSConfig, raftClientTLSConfig)
+		if err != nil {
+			fmt.Printf("raft init error: %s\n", err)
+			unitedQueue.Close()
+			return
+		}
+		unitedQueue.SetCoordinator(coordinator)
+	}
+	unitedQueue.SetMaxMessageSize(maxMessageSize)
+	unitedQueue.SetChunkSize(chunkSize)
+	unitedQueue.SetReplicaAuth(replicaSecret, replicaClientTLSConfig)
+	if replicas != "" {
+		unitedQueue.Replicate(Addrcat(ip, port), strings.Split(replicas, ","))
+	}
+	var replicaListener net.Listener
+	if replicaPort > 0 {
+		replicaListener, err = net.Listen("tcp", Addrcat(host, replicaPort))
+		if err != nil {
+			fmt.Printf("replica listen error: %s\n", err)
+			unitedQueue.Close()
+			return
+		}
+		defer replicaListener.Close()
+		if replicaTLSConfig != nil {
+			replicaListener = tls.NewListener(replicaListener, replicaTLSConfig)
+		}
+		go unitedQueue.ServeReplica(replicaListener)
+	}
+	entry.MaxBodyLength = maxMessageSize
+	var messageQueue queue.MessageQueue = unitedQueue
+	if limiter != nil {
+		messageQueue = limit.NewQueue(messageQueue, limiter)
+	}
 
 	var entrance entry.Entrance
 	if protocol == "http" {
-		entrance, err = entry.NewHttpEntry(host, port, messageQueue)
+		var httpEntry *entry.HttpEntry
+		httpEntry, err = entry.NewHttpEntry(host, port, messageQueue)
+		if err == nil && wsOrigins != "" {
+			httpEntry.SetOrigins(strings.Split(wsOrigins, ","))
+		}
+		entrance = httpEntry
 	} else if protocol == "mc" {
 		entrance, err = entry.NewMcEntry(host, port, messageQueue)
+	} else if protocol == "mcq" {
+		entrance, err = entry.NewMcqEntry(host, port, messageQueue)
+	} else if protocol == "grpc" {
+		entrance, err = entry.NewGrpcEntry(host, port, messageQueue)
 	} else if protocol == "redis" {
-		entrance, err = entry.NewRedisEntry(host, port, messageQueue)
+		var redisEntry *entry.RedisEntry
+		redisEntry, err = entry.NewRedisEntry(host, port, messageQueue)
+		if err == nil {
+			redisEntry.SetListRecycle(listRecycle)
+		}
+		entrance = redisEntry
 	} else {
 		fmt.Printf("protocol %s is not supported!\n", protocol)
 		return
@@ -144,6 +653,29 @@ func main() {
 		messageQueue.Close()
 		return
 	}
+	if access != nil {
+		entrance.(aclSetter).SetACL(access)
+	}
+	if tlsConfig != nil {
+		entrance.(tlsSetter).SetTLSConfig(tlsConfig)
+	}
+	if unixPath != "" {
+		entrance.(unixSetter).SetUnixSocket(unixPath)
+	}
+	if limiter != nil {
+		entrance.(limiterSetter).SetLimiter(limiter)
+	}
+	if routeMode != "" {
+		router, err := route.New(Addrcat(ip, port), routeMode, unitedQueue.Servers)
+		if err != nil {
+			fmt.Printf("router init error: %s\n", err)
+			messageQueue.Close()
+			return
+		}
+		router.Start()
+		defer router.Stop()
+		entrance.(routerSetter).SetRouter(router)
+	}
 
 	stop := make(chan os.Signal)
 	entryFailed := make(chan bool)
@@ -171,6 +703,42 @@ func main() {
 		entrance.Stop()
 		return
 	}
+	if access != nil {
+		adminServer.(aclSetter).SetACL(access)
+	}
+	if adminTLSConfig != nil {
+		adminServer.(tlsSetter).SetTLSConfig(adminTLSConfig)
+	}
+	if adminUnixPath != "" {
+		adminServer.(unixSetter).SetUnixSocket(adminUnixPath)
+	}
+	if replicaListener != nil {
+		adminServer.(replicaSetter).SetReplica(unitedQueue)
+	}
+	adminServer.(migratorSetter).SetMigrator(unitedQueue)
+	adminServer.(backupSetter).SetBackup(unitedQueue)
+	adminServer.(exporterSetter).SetExporter(unitedQueue)
+	if (etcd != "" || raftAddr != "") && adminPort != 0 {
+		adminServer.(clusterSetter).SetCluster(unitedQueue.Admins)
+	}
+
+	// reload the certificates on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			for _, r := range []*CertReloader{reloader, adminReloader, replicaReloader, raftReloader} {
+				if r == nil {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					log.Printf("tls reload error: %s", err)
+				} else {
+					log.Printf("tls certificate reloaded")
+				}
+			}
+		}
+	}()
 
 	// start admin server
 	go func(c chan bool) {
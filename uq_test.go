@@ -1,6 +1,15 @@
 package main
 
 import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -16,3 +25,41 @@ func TestArgs(t *testing.T) {
 		So(checkArgs(), ShouldEqual, false)
 	})
 }
+
+func TestAdminRequest(t *testing.T) {
+	Convey("Test Export By Https With Token", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(req.URL.Path))
+		}))
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "uq.cmd.test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		caFile := path.Join(dir, "ca.pem")
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		So(ioutil.WriteFile(caFile, ca, 0644), ShouldBeNil)
+
+		h, p, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+		So(err, ShouldBeNil)
+		ip = h
+		adminPort, _ = strconv.Atoi(p)
+		adminCA = caFile
+		defer func() { adminCA, adminToken = "", "" }()
+
+		file := path.Join(dir, "foo.ndjson")
+		err = exportTopic("foo", file)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "401")
+		adminToken = "t0k3n"
+		err = exportTopic("foo", file)
+		So(err, ShouldBeNil)
+		data, err := ioutil.ReadFile(file)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "/v1/admin/export/foo")
+	})
+}
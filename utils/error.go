@@ -7,15 +7,25 @@ import (
 )
 
 const (
-	ErrNone            = 100
-	ErrTopicNotExisted = 101
-	ErrLineNotExisted  = 102
-	ErrNotDelivered    = 103
-	ErrBadKey          = 104
-	ErrTopicExisted    = 105
-	ErrLineExisted     = 106
-	ErrBadRequest      = 400
-	ErrInternalError   = 500
+	ErrNone             = 100
+	ErrTopicNotExisted  = 101
+	ErrLineNotExisted   = 102
+	ErrNotDelivered     = 103
+	ErrBadKey           = 104
+	ErrTopicExisted     = 105
+	ErrLineExisted      = 106
+	ErrTopicFull        = 107
+	ErrMessageTooLarge  = 108
+	ErrMoved            = 109
+	ErrDraining         = 110
+	ErrCrossOwner       = 111
+	ErrBadRequest       = 400
+	ErrUnauthorized     = 401
+	ErrForbidden        = 403
+	ErrNotFound         = 404
+	ErrMethodNotAllowed = 405
+	ErrTooManyRequests  = 429
+	ErrInternalError    = 500
 )
 
 var errorMap = map[int]string{
@@ -30,17 +40,48 @@ var errorMap = map[int]string{
 	ErrTopicExisted: "Topic Has Existed",
 	ErrLineExisted:  "Line Has Existed",
 	ErrBadRequest:   "Bad Client Request",
+	ErrCrossOwner:   "Keys Owned By Several Servers",
+
+	// 401, 403
+	ErrUnauthorized: "Unauthorized",
+	ErrForbidden:    "Forbidden",
+
+	// 307
+	ErrMoved: "Moved",
+
+	// 404, 405
+	ErrNotFound:         "Not Found",
+	ErrMethodNotAllowed: "Method Not Allowed",
+
+	// 413, 429
+	ErrMessageTooLarge: "Message Too Large",
+	ErrTooManyRequests: "Too Many Requests",
+
+	// 507
+	ErrTopicFull: "Topic Is Full",
+
+	// 503
+	ErrDraining: "Node Draining",
 
 	// 500
 	ErrInternalError: "Internal Error",
 }
 
 var errorStatus = map[int]int{
-	ErrNone:            http.StatusNotFound,
-	ErrTopicNotExisted: http.StatusNotFound,
-	ErrLineNotExisted:  http.StatusNotFound,
-	ErrNotDelivered:    http.StatusNotFound,
-	ErrInternalError:   http.StatusInternalServerError,
+	ErrNone:             http.StatusNotFound,
+	ErrTopicNotExisted:  http.StatusNotFound,
+	ErrLineNotExisted:   http.StatusNotFound,
+	ErrNotDelivered:     http.StatusNotFound,
+	ErrTopicFull:        http.StatusInsufficientStorage,
+	ErrMoved:            http.StatusTemporaryRedirect,
+	ErrMessageTooLarge:  http.StatusRequestEntityTooLarge,
+	ErrUnauthorized:     http.StatusUnauthorized,
+	ErrForbidden:        http.StatusForbidden,
+	ErrNotFound:         http.StatusNotFound,
+	ErrMethodNotAllowed: http.StatusMethodNotAllowed,
+	ErrTooManyRequests:  http.StatusTooManyRequests,
+	ErrDraining:         http.StatusServiceUnavailable,
+	ErrInternalError:    http.StatusInternalServerError,
 }
 
 type Error struct {
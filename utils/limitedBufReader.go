@@ -1,6 +1,9 @@
 package utils
 
-import "io"
+import (
+	"io"
+	"io/ioutil"
+)
 
 type limitedBufferReader struct {
 	r io.Reader
@@ -23,3 +26,32 @@ func (r *limitedBufferReader) Read(p []byte) (n int, err error) {
 	}
 	return r.r.Read(np)
 }
+
+// ReadBody reads a body of n bytes declared by a protocol. A body larger
+// than max is discarded without being buffered, so the stream keeps in
+// sync, and ErrMessageTooLarge is returned.
+func ReadBody(r io.Reader, n, max int) ([]byte, error) {
+	if n < 0 {
+		return nil, NewError(
+			ErrBadRequest,
+			`bad body length: `+ItoaQuick(n),
+		)
+	}
+	if n > max {
+		_, err := io.CopyN(ioutil.Discard, r, int64(n))
+		if err != nil {
+			return nil, err
+		}
+		return nil, NewError(
+			ErrMessageTooLarge,
+			`message of `+ItoaQuick(n)+` bytes exceeds `+ItoaQuick(max),
+		)
+	}
+
+	body := make([]byte, n)
+	_, err := io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
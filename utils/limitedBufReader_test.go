@@ -17,3 +17,22 @@ func TestLimitedBufferReaderRead(t *testing.T) {
 		So(n, ShouldEqual, ln)
 	})
 }
+
+func TestReadBody(t *testing.T) {
+	Convey("Test ReadBody", t, func() {
+		buf := bytes.NewBufferString("hello\r\nworld")
+		body, err := ReadBody(buf, 5, 5)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldEqual, "hello")
+		buf.Next(2)
+
+		_, err = ReadBody(buf, 5, 4)
+		So(err, ShouldNotBeNil)
+		So(err.(*Error).ErrorCode, ShouldEqual, ErrMessageTooLarge)
+		// the body is discarded
+		So(buf.Len(), ShouldEqual, 0)
+
+		_, err = ReadBody(buf, -1, 4)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,42 +1,108 @@
 package utils
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// deadlineListener is a listener whose Accept can time out, such as
+// *net.TCPListener and *net.UnixListener.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
 type StopListener struct {
-	*net.TCPListener          //Wrapped listener
-	stop             chan int //Channel used only to indicate listener should shutdown
+	listeners []deadlineListener //Wrapped listeners
+	stop      chan int           //Channel used only to indicate listener should shutdown
+	tlsConfig *tls.Config        //Accepted connections are served over TLS if set
+
+	once  sync.Once
+	conns chan acceptResult //Merged connections of several listeners
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
 }
 
 var StoppedError = errors.New("Listener stopped")
 
-func NewStopListener(l net.Listener) (*StopListener, error) {
-	tcpL, ok := l.(*net.TCPListener)
+func NewStopListener(ls ...net.Listener) (*StopListener, error) {
+	return NewTLSStopListener(nil, ls...)
+}
 
-	if !ok {
-		return nil, errors.New("Cannot wrap listener")
+// NewTLSStopListener returns a StopListener accepting connections from
+// all the listeners, whose accepted connections are wrapped as TLS server
+// connections of the config. The TLS handshake is done on the first read
+// or write of the connection, so a slow client does not block Accept. A
+// nil config serves plain connections.
+func NewTLSStopListener(config *tls.Config, ls ...net.Listener) (*StopListener, error) {
+	if len(ls) == 0 {
+		return nil, errors.New("No listener to wrap")
 	}
 
 	retval := &StopListener{}
-	retval.TCPListener = tcpL
+	for _, l := range ls {
+		dl, ok := l.(deadlineListener)
+		if !ok {
+			return nil, errors.New("Cannot wrap listener")
+		}
+		retval.listeners = append(retval.listeners, dl)
+	}
 	retval.stop = make(chan int)
+	retval.tlsConfig = config
 
 	return retval, nil
 }
 
-func (sl *StopListener) Accept() (net.Conn, error) {
+// ListenAll listens on the tcp address of host and port, and on the unix
+// socket path if it is set. A zero port with a unix socket path listens
+// on the unix socket only. A stale socket file is removed first.
+func ListenAll(host string, port int, unixPath string) ([]net.Listener, error) {
+	ls := make([]net.Listener, 0, 2)
+	if port != 0 || unixPath == "" {
+		l, err := net.Listen("tcp", Addrcat(host, port))
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+
+	if unixPath != "" {
+		if fi, err := os.Stat(unixPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(unixPath)
+		}
+		l, err := net.Listen("unix", unixPath)
+		if err != nil {
+			for _, one := range ls {
+				one.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+func (sl *StopListener) acceptOne(l deadlineListener) (net.Conn, error) {
 	for {
 		//Wait up to one second for a new connection
-		sl.SetDeadline(time.Now().Add(time.Second))
+		l.SetDeadline(time.Now().Add(time.Second))
 
-		newConn, err := sl.TCPListener.Accept()
+		newConn, err := l.Accept()
 
 		//Check for the channel being closed
 		select {
 		case <-sl.stop:
+			if newConn != nil {
+				newConn.Close()
+			}
 			return nil, StoppedError
 		default:
 			//If the channel is still open, continue as normal
@@ -47,15 +113,78 @@ func (sl *StopListener) Accept() (net.Conn, error) {
 
 			//If this is a timeout, then continue to wait for
 			//new connections
-			if ok && netErr.Timeout() && netErr.Temporary() {
+			if ok && netErr.Timeout() {
 				continue
 			}
 		}
 
+		if err == nil && sl.tlsConfig != nil {
+			return tls.Server(newConn, sl.tlsConfig), nil
+		}
 		return newConn, err
 	}
 }
 
+func (sl *StopListener) Accept() (net.Conn, error) {
+	if len(sl.listeners) == 1 {
+		return sl.acceptOne(sl.listeners[0])
+	}
+
+	// accept from every listener in its own goroutine
+	sl.once.Do(func() {
+		sl.conns = make(chan acceptResult)
+		for _, l := range sl.listeners {
+			go func(l deadlineListener) {
+				for {
+					conn, err := sl.acceptOne(l)
+					select {
+					case sl.conns <- acceptResult{conn, err}:
+					case <-sl.stop:
+						if conn != nil {
+							conn.Close()
+						}
+						return
+					}
+					if err != nil {
+						return
+					}
+				}
+			}(l)
+		}
+	})
+
+	select {
+	case r := <-sl.conns:
+		return r.conn, r.err
+	case <-sl.stop:
+		return nil, StoppedError
+	}
+}
+
+func (sl *StopListener) Close() error {
+	var err error
+	for _, l := range sl.listeners {
+		if e := l.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Addr returns the address of the first listener.
+func (sl *StopListener) Addr() net.Addr {
+	return sl.listeners[0].Addr()
+}
+
+// String returns the addresses of all the listeners.
+func (sl *StopListener) String() string {
+	addrs := make([]string, len(sl.listeners))
+	for i, l := range sl.listeners {
+		addrs[i] = l.Addr().Network() + "://" + l.Addr().String()
+	}
+	return strings.Join(addrs, ", ")
+}
+
 func (sl *StopListener) Stop() {
 	close(sl.stop)
 }
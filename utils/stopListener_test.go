@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStopListenerUnix(t *testing.T) {
+	Convey("Test Stop Listener On Tcp And Unix Socket", t, func() {
+		dir, err := ioutil.TempDir("", "uq-unix")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		sock := path.Join(dir, "uq.sock")
+
+		// a stale socket file is replaced
+		stale, err := net.Listen("unix", sock)
+		So(err, ShouldBeNil)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		ls, err := ListenAll("127.0.0.1", 8890, sock)
+		So(err, ShouldBeNil)
+		So(len(ls), ShouldEqual, 2)
+		sl, err := NewStopListener(ls...)
+		So(err, ShouldBeNil)
+		So(sl.String(), ShouldEqual, "tcp://127.0.0.1:8890, unix://"+sock)
+
+		for _, network := range []string{"tcp", "unix"} {
+			addr := "127.0.0.1:8890"
+			if network == "unix" {
+				addr = sock
+			}
+			c, err := net.Dial(network, addr)
+			So(err, ShouldBeNil)
+			conn, err := sl.Accept()
+			So(err, ShouldBeNil)
+			So(conn.LocalAddr().Network(), ShouldEqual, network)
+			conn.Close()
+			c.Close()
+		}
+
+		sl.Stop()
+		_, err = sl.Accept()
+		So(err, ShouldEqual, StoppedError)
+		So(sl.Close(), ShouldBeNil)
+		_, err = os.Stat(sock)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		ls, err = ListenAll("127.0.0.1", 0, sock)
+		So(err, ShouldBeNil)
+		So(len(ls), ShouldEqual, 1)
+		So(ls[0].Addr().Network(), ShouldEqual, "unix")
+		ls[0].Close()
+	})
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// CertReloader holds a certificate which can be reloaded from its files
+// while the listeners are serving, e.g. on SIGHUP.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := new(CertReloader)
+	c.certFile = certFile
+	c.keyFile = keyFile
+	err := c.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate files again. The old certificate is kept
+// if the files are bad.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func (c *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// NewTLSConfig returns a server TLS config serving the certificate of the
+// reloader. If clientCAFile is set, the clients must present certificates
+// signed by it.
+func NewTLSConfig(reloader *CertReloader, clientCAFile string) (*tls.Config, error) {
+	config := new(tls.Config)
+	config.MinVersion = tls.VersionTLS12
+	config.GetCertificate = reloader.GetCertificate
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// NewClientTLSConfig returns a client TLS config presenting the
+// certificate of the reloader, which may be nil. If caFile is set, the
+// servers must present certificates signed by it.
+func NewClientTLSConfig(reloader *CertReloader, caFile string) (*tls.Config, error) {
+	config := new(tls.Config)
+	config.MinVersion = tls.VersionTLS12
+	if reloader != nil {
+		config.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificate in " + file)
+	}
+	return pool, nil
+}
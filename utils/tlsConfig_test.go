@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// genCert generates a certificate signed by parent, or a self-signed CA
+// if parent is nil. It returns the PEM of the certificate and the key.
+func genCert(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	So(err, ShouldBeNil)
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	So(err, ShouldBeNil)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return cert, key, certPem, keyPem
+}
+
+func TestCertReloader(t *testing.T) {
+	Convey("Test Cert Reloader", t, func() {
+		dir, err := ioutil.TempDir("", "uq-tls")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		certFile := path.Join(dir, "cert.pem")
+		keyFile := path.Join(dir, "key.pem")
+
+		_, _, certPem, keyPem := genCert("one", nil, nil)
+		ioutil.WriteFile(certFile, certPem, 0644)
+		ioutil.WriteFile(keyFile, keyPem, 0600)
+		reloader, err := NewCertReloader(certFile, keyFile)
+		So(err, ShouldBeNil)
+		cert, err := reloader.GetCertificate(nil)
+		So(err, ShouldBeNil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		So(err, ShouldBeNil)
+		So(leaf.Subject.CommonName, ShouldEqual, "one")
+
+		_, _, certPem, keyPem = genCert("two", nil, nil)
+		ioutil.WriteFile(certFile, certPem, 0644)
+		ioutil.WriteFile(keyFile, keyPem, 0600)
+		So(reloader.Reload(), ShouldBeNil)
+		cert, _ = reloader.GetCertificate(nil)
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		So(err, ShouldBeNil)
+		So(leaf.Subject.CommonName, ShouldEqual, "two")
+
+		// a bad file keeps the old certificate
+		ioutil.WriteFile(keyFile, []byte("bad"), 0600)
+		So(reloader.Reload(), ShouldNotBeNil)
+		cert2, _ := reloader.GetCertificate(nil)
+		So(cert2, ShouldEqual, cert)
+	})
+}
+
+func TestTLSStopListener(t *testing.T) {
+	Convey("Test TLS Stop Listener With Client Certificate", t, func() {
+		dir, err := ioutil.TempDir("", "uq-tls")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ca, caKey, caPem, _ := genCert("ca", nil, nil)
+		_, _, certPem, keyPem := genCert("server", ca, caKey)
+		_, _, clientPem, clientKeyPem := genCert("client", ca, caKey)
+		certFile := path.Join(dir, "cert.pem")
+		keyFile := path.Join(dir, "key.pem")
+		caFile := path.Join(dir, "ca.pem")
+		ioutil.WriteFile(certFile, certPem, 0644)
+		ioutil.WriteFile(keyFile, keyPem, 0600)
+		ioutil.WriteFile(caFile, caPem, 0644)
+
+		reloader, err := NewCertReloader(certFile, keyFile)
+		So(err, ShouldBeNil)
+		config, err := NewTLSConfig(reloader, caFile)
+		So(err, ShouldBeNil)
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		sl, err := NewTLSStopListener(config, l)
+		So(err, ShouldBeNil)
+		defer sl.Stop()
+		go func() {
+			for {
+				conn, err := sl.Accept()
+				if err != nil {
+					return
+				}
+				go func(c net.Conn) {
+					defer c.Close()
+					buf := make([]byte, 4)
+					n, err := c.Read(buf)
+					if err == nil {
+						c.Write(buf[:n])
+					}
+				}(conn)
+			}
+		}()
+
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caPem)
+		clientCert, err := tls.X509KeyPair(clientPem, clientKeyPem)
+		So(err, ShouldBeNil)
+
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{clientCert},
+		})
+		So(err, ShouldBeNil)
+		_, err = conn.Write([]byte("ping"))
+		So(err, ShouldBeNil)
+		buf := make([]byte, 4)
+		_, err = conn.Read(buf)
+		So(err, ShouldBeNil)
+		So(string(buf), ShouldEqual, "ping")
+		conn.Close()
+
+		// without a client certificate the handshake fails
+		conn, err = tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: pool})
+		if err == nil {
+			conn.Write([]byte("ping"))
+			_, err = conn.Read(buf)
+			conn.Close()
+		}
+		So(err, ShouldNotBeNil)
+	})
+}